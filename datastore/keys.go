@@ -0,0 +1,167 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
+)
+
+// ErrQuotaExceeded is returned by IncUsage when the counter reached the limit
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// KeysDAO data-access obj for API keys and their usage counters
+type KeysDAO struct {
+	Keys   *mongo.Collection
+	Usages *mongo.Collection
+}
+
+// APIKey record, entry in mongo. The key itself is never stored, only its hash
+type APIKey struct {
+	ID         bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name       string        `json:"name" bson:"name"`
+	Hash       string        `json:"-" bson:"hash"`
+	Prefix     string        `json:"prefix" bson:"prefix"` // first characters of the key, to tell keys apart
+	Enabled    bool          `json:"enabled" bson:"enabled"`
+	Endpoints  []string      `json:"endpoints,omitempty" bson:"endpoints,omitempty"` // allowed endpoints, all if empty
+	RateLimit  int           `json:"rate_limit" bson:"rate_limit"`                   // requests per minute, 0 is unlimited
+	DailyQuota int           `json:"daily_quota" bson:"daily_quota"`                 // requests per UTC day, 0 is unlimited
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// keyUsage is a daily requests counter of a key
+type keyUsage struct {
+	KeyID    bson.ObjectID `bson:"key_id"`
+	Day      string        `bson:"day"` // UTC day, like 2024-01-31
+	Requests int64         `bson:"requests"`
+}
+
+// HashKey returns hash of API key as stored in mongo
+func HashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// Create inserts new key
+func (k KeysDAO) Create(ctx context.Context, key APIKey) (APIKey, error) {
+	defer metrics.ObserveMongo("keys_create", time.Now())
+	ctx, span := startSpan(ctx, "keys", "create")
+	defer span.End()
+	key.ID = bson.NewObjectID()
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+	if _, err := k.Keys.InsertOne(ctx, key); err != nil {
+		return APIKey{}, fmt.Errorf("insert key %s: %w", key.Name, err)
+	}
+	return key, nil
+}
+
+// GetByHash returns key by its hash, both enabled and disabled
+func (k KeysDAO) GetByHash(ctx context.Context, hash string) (APIKey, bool) {
+	defer metrics.ObserveMongo("keys_get", time.Now())
+	ctx, span := startSpan(ctx, "keys", "get")
+	defer span.End()
+	var key APIKey
+	if err := k.Keys.FindOne(ctx, bson.M{"hash": hash}).Decode(&key); err != nil {
+		return APIKey{}, false
+	}
+	return key, true
+}
+
+// All returns all keys, newest first
+func (k KeysDAO) All(ctx context.Context) []APIKey {
+	defer metrics.ObserveMongo("keys_all", time.Now())
+	ctx, span := startSpan(ctx, "keys", "all")
+	defer span.End()
+	cursor, err := k.Keys.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		log.Printf("[WARN] failed to retrieve keys, error=%v", err)
+		return []APIKey{}
+	}
+	result := []APIKey{}
+	if err = cursor.All(ctx, &result); err != nil {
+		log.Printf("[WARN] failed to retrieve keys, error=%v", err)
+		return []APIKey{}
+	}
+	return result
+}
+
+// GetByID returns key by id
+func (k KeysDAO) GetByID(ctx context.Context, id bson.ObjectID) (APIKey, bool) {
+	defer metrics.ObserveMongo("keys_get_by_id", time.Now())
+	ctx, span := startSpan(ctx, "keys", "get_by_id")
+	defer span.End()
+	var key APIKey
+	err := k.Keys.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	return key, err == nil
+}
+
+// SetEnabled enables or revokes key
+func (k KeysDAO) SetEnabled(ctx context.Context, id bson.ObjectID, enabled bool) error {
+	defer metrics.ObserveMongo("keys_set_enabled", time.Now())
+	ctx, span := startSpan(ctx, "keys", "set_enabled")
+	defer span.End()
+	res, err := k.Keys.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"enabled": enabled}})
+	if err != nil {
+		return fmt.Errorf("update key %s: %w", id.Hex(), err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("key %s not found", id.Hex())
+	}
+	return nil
+}
+
+// IncUsage increments requests counter of the key for the day and returns the new value. With limit above zero
+// the counter isn't incremented past the limit and ErrQuotaExceeded is returned instead.
+func (k KeysDAO) IncUsage(ctx context.Context, id bson.ObjectID, day string, limit int) (int64, error) {
+	defer metrics.ObserveMongo("keys_inc_usage", time.Now())
+	ctx, span := startSpan(ctx, "keys", "inc_usage")
+	defer span.End()
+	filter := bson.M{"key_id": id, "day": day}
+	if limit > 0 {
+		filter["requests"] = bson.M{"$lt": limit}
+	}
+	var usage keyUsage
+	err := k.Usages.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"requests": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&usage)
+	if limit > 0 && mongo.IsDuplicateKeyError(err) {
+		// the counter of the day reached the limit, so the upsert tried to insert another one
+		return 0, ErrQuotaExceeded
+	}
+	if err != nil {
+		return 0, fmt.Errorf("increment usage of key %s: %w", id.Hex(), err)
+	}
+	return usage.Requests, nil
+}
+
+// Usage returns requests count of all keys for the day
+func (k KeysDAO) Usage(ctx context.Context, day string) map[bson.ObjectID]int64 {
+	defer metrics.ObserveMongo("keys_usage", time.Now())
+	ctx, span := startSpan(ctx, "keys", "usage")
+	defer span.End()
+	res := map[bson.ObjectID]int64{}
+	cursor, err := k.Usages.Find(ctx, bson.M{"day": day})
+	if err != nil {
+		log.Printf("[WARN] failed to retrieve keys usage, error=%v", err)
+		return res
+	}
+	var usage []keyUsage
+	if err = cursor.All(ctx, &usage); err != nil {
+		log.Printf("[WARN] failed to retrieve keys usage, error=%v", err)
+		return res
+	}
+	for _, u := range usage {
+		res[u.KeyID] = u.Requests
+	}
+	return res
+}
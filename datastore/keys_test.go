@@ -0,0 +1,106 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/testutils/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestKeysCreateAndGet(t *testing.T) {
+	keys := setupKeys(t)
+
+	key, err := keys.Create(context.Background(), APIKey{Name: "reader", Hash: HashKey("uk_test"), Prefix: "uk_test",
+		Enabled: true, Endpoints: []string{"parser"}, RateLimit: 10, DailyQuota: 100})
+	require.NoError(t, err)
+	assert.NotEqual(t, bson.NilObjectID, key.ID)
+	assert.False(t, key.CreatedAt.IsZero())
+
+	got, found := keys.GetByHash(context.Background(), HashKey("uk_test"))
+	require.True(t, found)
+	assert.Equal(t, key.ID, got.ID)
+	assert.Equal(t, "reader", got.Name)
+	assert.Equal(t, []string{"parser"}, got.Endpoints)
+	assert.Equal(t, 10, got.RateLimit)
+	assert.Equal(t, 100, got.DailyQuota)
+
+	_, found = keys.GetByHash(context.Background(), HashKey("uk_other"))
+	assert.False(t, found)
+
+	got, found = keys.GetByID(context.Background(), key.ID)
+	require.True(t, found)
+	assert.Equal(t, "reader", got.Name)
+
+	_, err = keys.Create(context.Background(), APIKey{Name: "dup", Hash: HashKey("uk_test")})
+	require.Error(t, err, "hash is unique")
+}
+
+func TestKeysAllAndSetEnabled(t *testing.T) {
+	keys := setupKeys(t)
+
+	older, err := keys.Create(context.Background(), APIKey{Name: "older", Hash: HashKey("k1"), Enabled: true,
+		CreatedAt: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	_, err = keys.Create(context.Background(), APIKey{Name: "newer", Hash: HashKey("k2"), Enabled: true})
+	require.NoError(t, err)
+
+	all := keys.All(context.Background())
+	require.Len(t, all, 2)
+	assert.Equal(t, "newer", all[0].Name)
+	assert.Equal(t, "older", all[1].Name)
+
+	require.NoError(t, keys.SetEnabled(context.Background(), older.ID, false))
+	got, found := keys.GetByID(context.Background(), older.ID)
+	require.True(t, found)
+	assert.False(t, got.Enabled)
+
+	require.Error(t, keys.SetEnabled(context.Background(), bson.NewObjectID(), false))
+}
+
+func TestKeysUsage(t *testing.T) {
+	keys := setupKeys(t)
+	k1, k2 := bson.NewObjectID(), bson.NewObjectID()
+
+	for i := 1; i <= 3; i++ {
+		n, err := keys.IncUsage(context.Background(), k1, "2024-01-31", 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), n)
+	}
+	n, err := keys.IncUsage(context.Background(), k2, "2024-01-31", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = keys.IncUsage(context.Background(), k1, "2024-02-01", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "counter is per day")
+
+	n, err = keys.IncUsage(context.Background(), k2, "2024-01-31", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "within limit")
+	_, err = keys.IncUsage(context.Background(), k2, "2024-01-31", 2)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	_, err = keys.IncUsage(context.Background(), k1, "2024-02-02", 1)
+	require.NoError(t, err, "first request of the day within limit")
+
+	assert.Equal(t, map[bson.ObjectID]int64{k1: 3, k2: 2}, keys.Usage(context.Background(), "2024-01-31"),
+		"request over limit is not counted")
+	assert.Empty(t, keys.Usage(context.Background(), "2024-02-03"))
+}
+
+func TestHashKey(t *testing.T) {
+	assert.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", HashKey("test"))
+	assert.NotEqual(t, HashKey("test"), HashKey("test2"))
+}
+
+func setupKeys(t *testing.T) KeysDAO {
+	t.Helper()
+	mc := containers.NewMongoTestContainer(context.Background(), t, 5)
+	t.Cleanup(func() { mc.Close(context.Background()) }) //nolint:errcheck
+
+	server, err := New(mc.URI, "test_ureadability", 0)
+	require.NoError(t, err)
+	return server.GetStores().Keys
+}
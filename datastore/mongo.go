@@ -4,12 +4,14 @@ package datastore
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
 // MongoServer top level mongo ops
@@ -18,13 +20,16 @@ type MongoServer struct {
 	dbName string
 }
 
-// New MongoServer
-func New(connectionURI, dbName string, delay time.Duration) (*MongoServer, error) {
-	log.Printf("[INFO] connect to mongo server with db=%s, delay=%s", dbName, delay)
-	if delay > 0 {
-		log.Printf("[DEBUG] initial mongo delay=%s", delay)
-		time.Sleep(delay)
-	}
+const (
+	pingTimeout     = 5 * time.Second // max time of a single ping attempt
+	pingRetryDelay  = 500 * time.Millisecond
+	pingMaxRetryGap = 5 * time.Second
+)
+
+// New MongoServer, waits up to timeout for mongo to become reachable, pinging it with backoff.
+// With zero timeout mongo is pinged once.
+func New(connectionURI, dbName string, timeout time.Duration) (*MongoServer, error) {
+	log.Printf("[INFO] connect to mongo server with db=%s, timeout=%s", dbName, timeout)
 	if connectionURI == "" {
 		return nil, errors.New("env MONGO_URI not defined and --mongo not passed")
 	}
@@ -34,12 +39,45 @@ func New(connectionURI, dbName string, delay time.Duration) (*MongoServer, error
 		return nil, err
 	}
 
-	return &MongoServer{client: client, dbName: dbName}, nil
+	res := &MongoServer{client: client, dbName: dbName}
+	deadline := time.Now().Add(timeout)
+	delay := pingRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = res.Ping(context.Background())
+		if err == nil {
+			break
+		}
+		if time.Now().Add(delay).After(deadline) {
+			_ = client.Disconnect(context.Background())
+			return nil, fmt.Errorf("mongo is not reachable after %d attempts: %w", attempt, err)
+		}
+		log.Printf("[WARN] mongo is not reachable, attempt %d, retry in %s, %v", attempt, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, pingMaxRetryGap)
+	}
+	return res, nil
+}
+
+// Ping checks mongo connectivity
+func (m *MongoServer) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return m.client.Ping(ctx, readpref.Primary())
+}
+
+// Close disconnects from mongo, waiting for in-progress operations up to ctx deadline
+func (m *MongoServer) Close(ctx context.Context) error {
+	if err := m.client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("disconnect from mongo: %w", err)
+	}
+	return nil
 }
 
 // Stores contains all DAO instances
 type Stores struct {
 	Rules RulesDAO
+	Keys  KeysDAO
+	Users UsersDAO
 }
 
 // GetStores initialize collections and make indexes
@@ -48,10 +86,29 @@ func (m *MongoServer) GetStores() Stores {
 		{Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "domain", Value: 1}}},
 		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "domain", Value: 1}, {Key: "enabled", Value: 1}}},
 		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "match_urls", Value: 1}}},
+		{Keys: bson.D{{Key: "use_cloudflare", Value: 1}, {Key: "domain", Value: 1}}},
+		{Keys: bson.D{{Key: "health.ok", Value: 1}, {Key: "domain", Value: 1}}},
+		{Keys: bson.D{{Key: "health.checked_at", Value: -1}}},
+		// search of RulesQuery, words are indexed as is, without stemming and stop words
+		{Keys: bson.D{{Key: "domain", Value: "text"}, {Key: "content", Value: "text"}, {Key: "match_urls", Value: "text"},
+			{Key: "user", Value: "text"}}, Options: options.Index().SetName("rules_search").SetDefaultLanguage("none")},
+	}
+
+	kIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	uIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key_id", Value: 1}, {Key: "day", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "day", Value: 1}}},
+	}
+	usersIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
 	}
 
 	return Stores{
 		Rules: RulesDAO{Collection: m.collection("rules", rIndexes)},
+		Keys:  KeysDAO{Keys: m.collection("keys", kIndexes), Usages: m.collection("keys_usage", uIndexes)},
+		Users: UsersDAO{Collection: m.collection("users", usersIndexes)},
 	}
 }
 
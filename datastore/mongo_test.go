@@ -20,12 +20,15 @@ func TestNew(t *testing.T) {
 		assert.NotNil(t, server)
 		assert.NotNil(t, server.client)
 		assert.Equal(t, "test_ureadability", server.dbName)
+		require.NoError(t, server.Close(context.Background()))
+		assert.Error(t, server.Ping(context.Background()), "disconnected")
 	})
 
-	t.Run("with delay", func(t *testing.T) {
-		server, err := New(mc.URI, "test_ureadability", 10*time.Millisecond)
+	t.Run("with timeout", func(t *testing.T) {
+		server, err := New(mc.URI, "test_ureadability", 10*time.Second)
 		require.NoError(t, err)
 		assert.NotNil(t, server)
+		assert.NoError(t, server.Ping(context.Background()))
 	})
 
 	t.Run("wrong connection string", func(t *testing.T) {
@@ -41,6 +44,18 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestNewUnreachable(t *testing.T) {
+	st := time.Now()
+	server, err := New("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100", "test_ureadability", time.Second)
+	require.Error(t, err)
+	assert.Nil(t, server)
+	assert.Contains(t, err.Error(), "mongo is not reachable after")
+	assert.Less(t, time.Since(st), 3*time.Second)
+
+	_, err = New("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100", "test_ureadability", 0)
+	require.ErrorContains(t, err, "mongo is not reachable after 1 attempts")
+}
+
 func TestGetStores(t *testing.T) {
 	mc := containers.NewMongoTestContainer(context.Background(), t, 5)
 	defer mc.Close(context.Background()) //nolint:errcheck
@@ -51,4 +66,6 @@ func TestGetStores(t *testing.T) {
 	stores := server.GetStores()
 	assert.NotNil(t, stores.Rules)
 	assert.NotNil(t, stores.Rules.Collection)
+	assert.NotNil(t, stores.Keys.Keys)
+	assert.NotNil(t, stores.Keys.Usages)
 }
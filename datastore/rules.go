@@ -4,13 +4,23 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
+var tracer = otel.Tracer("github.com/ukeeper/ukeeper-readability/datastore")
+
 // RulesDAO data-access obj for custom parsing rules, implements Rules
 type RulesDAO struct {
 	*mongo.Collection
@@ -29,10 +39,63 @@ type Rule struct {
 	User          string        `json:"user"`
 	Enabled       bool          `json:"enabled"`
 	UseCloudflare bool          `json:"use_cloudflare,omitempty" bson:"use_cloudflare,omitempty"` // route fetch via Cloudflare Browser Rendering
+	UserAgent     string        `json:"user_agent,omitempty" bson:"user_agent,omitempty"`         // custom User-Agent for fetching
+	Headers       []string      `json:"headers,omitempty" bson:"headers,omitempty"`               // extra request headers, "Name: value" per entry
+	Cookies       []string      `json:"cookies,omitempty" bson:"cookies,omitempty"`               // request cookies, "name=value" per entry
+	NextPage      string        `json:"next_page,omitempty" bson:"next_page,omitempty"`           // selector of the next page link for multi-page articles
+	Health        *RuleHealth   `json:"health,omitempty" bson:"health,omitempty"`                 // outcome of the last extraction with the rule
+}
+
+// RuleHealth is the outcome of the last extraction made with the rule
+type RuleHealth struct {
+	OK        bool      `json:"ok" bson:"ok"` // rule selector extracted content, false if it fell back to the general parser
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at" bson:"checked_at"`
+}
+
+// rule health filter values of RulesQuery
+const (
+	RuleHealthOK      = "ok"
+	RuleHealthFailing = "failing"
+	RuleHealthUnknown = "unknown" // rule wasn't used yet
+)
+
+// default and max page size of RulesQuery
+const (
+	RulesPageSize    = 50
+	RulesMaxPageSize = 500
+)
+
+// RulesQuery defines filters, sorting and pagination of rules list. Zero value matches all rules sorted by domain.
+type RulesQuery struct {
+	Search     string // case-insensitive phrase of whole words in domain, content selector, match urls or user
+	Domain     string // exact domain of the rule
+	Enabled    *bool
+	Cloudflare *bool
+	User       string // user who saved the rule
+	Health     string // one of RuleHealthOK, RuleHealthFailing or RuleHealthUnknown, empty for any
+	Sort       string // domain, user, created or checked, with "-" prefix for descending order
+	Page       int    // 1-based page number
+	PageSize   int    // RulesPageSize if not set, limited by RulesMaxPageSize
+}
+
+// clearableFields are optional fields of the rule form omitted from the document when empty, removed on Save
+// if cleared, so the old value is not kept
+var clearableFields = map[string]func(Rule) bool{
+	"user_agent": func(r Rule) bool { return r.UserAgent == "" },
+	"headers":    func(r Rule) bool { return len(r.Headers) == 0 },
+	"cookies":    func(r Rule) bool { return len(r.Cookies) == 0 },
+	"next_page":  func(r Rule) bool { return r.NextPage == "" },
 }
 
+// sortFields maps RulesQuery.Sort keys to document fields
+var sortFields = map[string]string{"domain": "domain", "user": "user", "created": "_id", "checked": "health.checked_at"}
+
 // Get rule by url. Checks if found in mongo, matching by domain
 func (r RulesDAO) Get(ctx context.Context, rURL string) (Rule, bool) {
+	defer metrics.ObserveMongo("get", time.Now())
+	ctx, span := startSpan(ctx, "rules", "get")
+	defer span.End()
 	u, err := url.Parse(rURL)
 	if err != nil {
 		log.Printf("[WARN] failed to parse url=%s, error=%v", rURL, err)
@@ -58,6 +121,9 @@ func (r RulesDAO) Get(ctx context.Context, rURL string) (Rule, bool) {
 
 // GetByID returns record by id
 func (r RulesDAO) GetByID(ctx context.Context, id bson.ObjectID) (Rule, bool) {
+	defer metrics.ObserveMongo("get_by_id", time.Now())
+	ctx, span := startSpan(ctx, "rules", "get_by_id")
+	defer span.End()
 	var rule Rule
 	err := r.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
 	return rule, err == nil
@@ -65,7 +131,20 @@ func (r RulesDAO) GetByID(ctx context.Context, id bson.ObjectID) (Rule, bool) {
 
 // Save upsert rule
 func (r RulesDAO) Save(ctx context.Context, rule Rule) (Rule, error) {
-	ch, err := r.UpdateOne(ctx, bson.M{"domain": rule.Domain}, bson.M{"$set": rule}, options.UpdateOne().SetUpsert(true))
+	defer metrics.ObserveMongo("save", time.Now())
+	ctx, span := startSpan(ctx, "rules", "save")
+	defer span.End()
+	update := bson.M{"$set": rule}
+	unset := bson.M{}
+	for field, empty := range clearableFields {
+		if empty(rule) {
+			unset[field] = ""
+		}
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	ch, err := r.UpdateOne(ctx, bson.M{"domain": rule.Domain}, update, options.UpdateOne().SetUpsert(true))
 	if err != nil {
 		log.Printf("[WARN] failed to save, error=%v, article=%v", err, rule)
 		return rule, err
@@ -88,12 +167,18 @@ func (r RulesDAO) Save(ctx context.Context, rule Rule) (Rule, error) {
 
 // Disable marks enabled=false, by id
 func (r RulesDAO) Disable(ctx context.Context, id bson.ObjectID) error {
+	defer metrics.ObserveMongo("disable", time.Now())
+	ctx, span := startSpan(ctx, "rules", "disable")
+	defer span.End()
 	_, err := r.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"enabled": false}})
 	return err
 }
 
 // All returns list of all rules, both enabled and disabled
 func (r RulesDAO) All(ctx context.Context) []Rule {
+	defer metrics.ObserveMongo("all", time.Now())
+	ctx, span := startSpan(ctx, "rules", "all")
+	defer span.End()
 	cursor, err := r.Find(ctx, bson.M{})
 	if err != nil {
 		log.Printf("[WARN] failed to retrieve all rules, error=%v", err)
@@ -107,6 +192,117 @@ func (r RulesDAO) All(ctx context.Context) []Rule {
 	return result
 }
 
+// List returns page of rules matching the query and total number of matching rules
+func (r RulesDAO) List(ctx context.Context, q RulesQuery) (rules []Rule, total int64, err error) {
+	defer metrics.ObserveMongo("list", time.Now())
+	ctx, span := startSpan(ctx, "rules", "list")
+	defer span.End()
+	filter := q.filter()
+	if total, err = r.CountDocuments(ctx, filter); err != nil {
+		return nil, 0, fmt.Errorf("count rules: %w", err)
+	}
+	skip, limit := q.window()
+	cursor, err := r.Find(ctx, filter, options.Find().SetSort(q.sort()).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		return nil, 0, fmt.Errorf("find rules: %w", err)
+	}
+	rules = []Rule{}
+	if err = cursor.All(ctx, &rules); err != nil {
+		return nil, 0, fmt.Errorf("decode rules: %w", err)
+	}
+	return rules, total, nil
+}
+
+// Users returns sorted list of users who saved rules
+func (r RulesDAO) Users(ctx context.Context) []string {
+	defer metrics.ObserveMongo("users", time.Now())
+	ctx, span := startSpan(ctx, "rules", "users")
+	defer span.End()
+	var res []string
+	if err := r.Distinct(ctx, "user", bson.M{"user": bson.M{"$nin": bson.A{"", nil}}}).Decode(&res); err != nil {
+		log.Printf("[WARN] failed to retrieve rule users, error=%v", err)
+		return []string{}
+	}
+	slices.Sort(res)
+	return res
+}
+
+// SetHealth records outcome of extraction made with the rule
+func (r RulesDAO) SetHealth(ctx context.Context, id bson.ObjectID, health RuleHealth) error {
+	defer metrics.ObserveMongo("set_health", time.Now())
+	ctx, span := startSpan(ctx, "rules", "set_health")
+	defer span.End()
+	_, err := r.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"health": health}})
+	return err
+}
+
+// filter makes mongo filter from the query
+func (q RulesQuery) filter() bson.M {
+	filter := bson.M{}
+	// searched as a phrase with the text index, so dashes and dots of the search don't negate or split the words
+	if search := strings.TrimSpace(strings.NewReplacer(`"`, " ", `\`, " ").Replace(q.Search)); search != "" {
+		filter["$text"] = bson.M{"$search": `"` + search + `"`}
+	}
+	if q.Domain != "" {
+		filter["domain"] = q.Domain
+	}
+	if q.Enabled != nil {
+		filter["enabled"] = *q.Enabled
+	}
+	if q.Cloudflare != nil {
+		filter["use_cloudflare"] = *q.Cloudflare
+		if !*q.Cloudflare {
+			filter["use_cloudflare"] = bson.M{"$ne": true} // false is omitted from the document
+		}
+	}
+	if q.User != "" {
+		filter["user"] = q.User
+	}
+	switch q.Health {
+	case RuleHealthOK:
+		filter["health.ok"] = true
+	case RuleHealthFailing:
+		filter["health.ok"] = false
+	case RuleHealthUnknown:
+		filter["health"] = bson.M{"$exists": false}
+	}
+	return filter
+}
+
+// sort makes mongo sort from the query, unknown keys sort by domain
+func (q RulesQuery) sort() bson.D {
+	key, order := strings.TrimPrefix(q.Sort, "-"), 1
+	if strings.HasPrefix(q.Sort, "-") {
+		order = -1
+	}
+	field, ok := sortFields[key]
+	if !ok {
+		field, order = "domain", 1
+	}
+	res := bson.D{{Key: field, Value: order}}
+	if field != "_id" {
+		res = append(res, bson.E{Key: "_id", Value: 1}) // stable order of pages
+	}
+	return res
+}
+
+// window returns number of rules to skip and page size
+func (q RulesQuery) window() (skip, limit int64) {
+	size := q.PageSize
+	if size <= 0 {
+		size = RulesPageSize
+	}
+	size = min(size, RulesMaxPageSize)
+	page := max(q.Page, 1)
+	return int64((page - 1) * size), int64(size)
+}
+
+// startSpan starts span of collection operation
+func startSpan(ctx context.Context, collection, op string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, collection+"."+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "mongodb"), attribute.String("db.operation.name", op)))
+}
+
 func (s Rule) String() string {
 	return fmt.Sprintf("{id=%s, domain=%s, content=%s, enabled=%v}", s.ID.Hex(), s.Domain, s.Content, s.Enabled)
 }
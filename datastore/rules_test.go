@@ -3,7 +3,9 @@ package datastore
 import (
 	"context"
 	"math/rand/v2"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-pkgz/testutils/containers"
 	"github.com/stretchr/testify/assert"
@@ -59,6 +61,30 @@ func TestRulesSave(t *testing.T) {
 		assert.Equal(t, rule.TestURLs, saved.TestURLs)
 	})
 
+	t.Run("cleared fields are removed", func(t *testing.T) {
+		rule := Rule{Domain: randDomain(), Content: "article", Enabled: true, UserAgent: "agent/1.0",
+			Headers: []string{"X-Test: 1"}, Cookies: []string{"consent=yes"}, NextPage: "a.next"}
+		saved, err := rules.Save(context.Background(), rule)
+		require.NoError(t, err)
+		got, found := rules.GetByID(context.Background(), saved.ID)
+		require.True(t, found)
+		assert.Equal(t, "agent/1.0", got.UserAgent)
+		assert.Equal(t, []string{"X-Test: 1"}, got.Headers)
+		assert.Equal(t, []string{"consent=yes"}, got.Cookies)
+		assert.Equal(t, "a.next", got.NextPage)
+
+		rule.UserAgent, rule.Headers, rule.Cookies, rule.NextPage = "", nil, nil, ""
+		_, err = rules.Save(context.Background(), rule)
+		require.NoError(t, err)
+		got, found = rules.GetByID(context.Background(), saved.ID)
+		require.True(t, found)
+		assert.Empty(t, got.UserAgent)
+		assert.Empty(t, got.Headers)
+		assert.Empty(t, got.Cookies)
+		assert.Empty(t, got.NextPage)
+		assert.Equal(t, "article", got.Content)
+	})
+
 	t.Run("save with canceled context", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
@@ -202,6 +228,114 @@ func TestRulesAll(t *testing.T) {
 	})
 }
 
+func TestRulesList(t *testing.T) {
+	rules := setupRules(t)
+	ctx := context.Background()
+	suffix := "." + randDomain()
+	for _, r := range []Rule{
+		{Domain: "b" + suffix, Content: "article", User: "admin", Enabled: true, UseCloudflare: true},
+		{Domain: "a" + suffix, Content: ".post-body", User: "editor", Enabled: true},
+		{Domain: "c" + suffix, Content: "#main", User: "admin", Enabled: false},
+	} {
+		saved, err := rules.Save(ctx, r)
+		require.NoError(t, err)
+		if saved.Domain == "a"+suffix {
+			require.NoError(t, rules.SetHealth(ctx, saved.ID, RuleHealth{OK: false, Error: "nothing extracted", CheckedAt: time.Now()}))
+		}
+		if saved.Domain == "b"+suffix {
+			require.NoError(t, rules.SetHealth(ctx, saved.ID, RuleHealth{OK: true, CheckedAt: time.Now()}))
+		}
+	}
+	domains := func(rr []Rule) (res []string) {
+		for _, r := range rr {
+			res = append(res, strings.TrimSuffix(r.Domain, suffix))
+		}
+		return res
+	}
+	yes, no := true, false
+
+	tbl := []struct {
+		name  string
+		q     RulesQuery
+		want  []string
+		total int64
+	}{
+		{name: "search domain", q: RulesQuery{Search: suffix}, want: []string{"a", "b", "c"}, total: 3},
+		{name: "search domain desc", q: RulesQuery{Search: " " + suffix, Sort: "-domain"}, want: []string{"c", "b", "a"}, total: 3},
+		{name: "search selector", q: RulesQuery{Search: "POST-BODY"}, want: []string{"a"}, total: 1},
+		{name: "enabled", q: RulesQuery{Search: suffix, Enabled: &yes}, want: []string{"a", "b"}, total: 2},
+		{name: "disabled", q: RulesQuery{Search: suffix, Enabled: &no}, want: []string{"c"}, total: 1},
+		{name: "domain", q: RulesQuery{Domain: "c" + suffix, Enabled: &no}, want: []string{"c"}, total: 1},
+		{name: "domain not matched", q: RulesQuery{Domain: "c" + suffix, Enabled: &yes}, want: nil, total: 0},
+		{name: "cloudflare", q: RulesQuery{Search: suffix, Cloudflare: &yes}, want: []string{"b"}, total: 1},
+		{name: "direct", q: RulesQuery{Search: suffix, Cloudflare: &no}, want: []string{"a", "c"}, total: 2},
+		{name: "user", q: RulesQuery{Search: suffix, User: "admin", Sort: "-created"}, want: []string{"c", "b"}, total: 2},
+		{name: "healthy", q: RulesQuery{Search: suffix, Health: RuleHealthOK}, want: []string{"b"}, total: 1},
+		{name: "failing", q: RulesQuery{Search: suffix, Health: RuleHealthFailing}, want: []string{"a"}, total: 1},
+		{name: "unchecked", q: RulesQuery{Search: suffix, Health: RuleHealthUnknown}, want: []string{"c"}, total: 1},
+		{name: "second page", q: RulesQuery{Search: suffix, Page: 2, PageSize: 2}, want: []string{"c"}, total: 3},
+		{name: "after last page", q: RulesQuery{Search: suffix, Page: 5, PageSize: 2}, want: nil, total: 3},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, total, err := rules.List(ctx, tt.q)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, domains(res))
+			assert.Equal(t, tt.total, total)
+		})
+	}
+
+	t.Run("health stored", func(t *testing.T) {
+		res, _, err := rules.List(ctx, RulesQuery{Search: "a" + suffix})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		require.NotNil(t, res[0].Health)
+		assert.False(t, res[0].Health.OK)
+		assert.Equal(t, "nothing extracted", res[0].Health.Error)
+
+		// saving the rule from the form keeps its health
+		_, err = rules.Save(ctx, Rule{Domain: "a" + suffix, Content: "article", Enabled: true})
+		require.NoError(t, err)
+		found, ok := rules.Get(ctx, "https://a"+suffix+"/page")
+		require.True(t, ok)
+		assert.NotNil(t, found.Health)
+	})
+
+	t.Run("users", func(t *testing.T) {
+		users := rules.Users(ctx)
+		assert.Equal(t, []string{"admin", "editor"}, users)
+	})
+}
+
+func TestRulesQuery(t *testing.T) {
+	yes, no := true, false
+	q := RulesQuery{Search: " a.b ", Domain: "a.b", Enabled: &yes, Cloudflare: &no, User: "admin", Health: RuleHealthUnknown}
+	filter := q.filter()
+	assert.Equal(t, bson.M{"$search": `"a.b"`}, filter["$text"])
+	assert.Equal(t, "a.b", filter["domain"])
+	assert.Equal(t, true, filter["enabled"])
+	assert.Equal(t, bson.M{"$ne": true}, filter["use_cloudflare"])
+	assert.Equal(t, "admin", filter["user"])
+	assert.Equal(t, bson.M{"$exists": false}, filter["health"])
+	assert.Equal(t, bson.M{}, RulesQuery{Health: "bad"}.filter())
+	assert.Equal(t, bson.M{"$text": bson.M{"$search": `"a b"`}}, RulesQuery{Search: `a"b`}.filter(), "quotes are dropped")
+	assert.Equal(t, bson.M{}, RulesQuery{Search: ` " `}.filter())
+
+	assert.Equal(t, bson.D{{Key: "domain", Value: 1}, {Key: "_id", Value: 1}}, RulesQuery{}.sort())
+	assert.Equal(t, bson.D{{Key: "domain", Value: 1}, {Key: "_id", Value: 1}}, RulesQuery{Sort: "-password"}.sort())
+	assert.Equal(t, bson.D{{Key: "health.checked_at", Value: -1}, {Key: "_id", Value: 1}}, RulesQuery{Sort: "-checked"}.sort())
+	assert.Equal(t, bson.D{{Key: "_id", Value: -1}}, RulesQuery{Sort: "-created"}.sort())
+
+	skip, limit := RulesQuery{}.window()
+	assert.Equal(t, int64(0), skip)
+	assert.Equal(t, int64(RulesPageSize), limit)
+	skip, limit = RulesQuery{Page: 3, PageSize: 10}.window()
+	assert.Equal(t, int64(20), skip)
+	assert.Equal(t, int64(10), limit)
+	_, limit = RulesQuery{PageSize: 100000}.window()
+	assert.Equal(t, int64(RulesMaxPageSize), limit)
+}
+
 func TestRuleString(t *testing.T) {
 	rule := Rule{
 		ID:      bson.NewObjectID(),
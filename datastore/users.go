@@ -0,0 +1,151 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
+)
+
+// Role of admin UI user
+type Role string
+
+// user roles, each one includes permissions of the previous
+const (
+	RoleViewer Role = "viewer" // view rules and preview extraction
+	RoleEditor Role = "editor" // save and toggle rules
+	RoleAdmin  Role = "admin"  // manage users and API keys
+)
+
+// Roles lists all roles, from the least to the most privileged
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+// level returns role's position in Roles, -1 for unknown role
+func (r Role) level() int {
+	for i, role := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Valid checks role is known
+func (r Role) Valid() bool { return r.level() >= 0 }
+
+// Allows checks role grants permissions of the required one
+func (r Role) Allows(required Role) bool { return r.Valid() && r.level() >= required.level() }
+
+// UsersDAO data-access obj for admin UI users
+type UsersDAO struct {
+	*mongo.Collection
+}
+
+// User record, entry in mongo
+type User struct {
+	ID           bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name         string        `json:"name" bson:"name"`
+	PasswordHash string        `json:"-" bson:"password_hash"` // bcrypt hash
+	Role         Role          `json:"role" bson:"role"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// SetPassword sets bcrypt hash of the password
+func (u *User) SetPassword(password string) error {
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword verifies password against the stored hash
+func (u User) CheckPassword(password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// Get returns user by name
+func (u UsersDAO) Get(ctx context.Context, name string) (User, bool) {
+	defer metrics.ObserveMongo("users_get", time.Now())
+	ctx, span := startSpan(ctx, "users", "get")
+	defer span.End()
+	var user User
+	err := u.FindOne(ctx, bson.M{"name": name}).Decode(&user)
+	return user, err == nil
+}
+
+// All returns all users, sorted by name
+func (u UsersDAO) All(ctx context.Context) []User {
+	defer metrics.ObserveMongo("users_all", time.Now())
+	ctx, span := startSpan(ctx, "users", "all")
+	defer span.End()
+	cursor, err := u.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		log.Printf("[WARN] failed to retrieve users, error=%v", err)
+		return []User{}
+	}
+	result := []User{}
+	if err = cursor.All(ctx, &result); err != nil {
+		log.Printf("[WARN] failed to retrieve users, error=%v", err)
+		return []User{}
+	}
+	return result
+}
+
+// Save upserts user by name
+func (u UsersDAO) Save(ctx context.Context, user User) (User, error) {
+	defer metrics.ObserveMongo("users_save", time.Now())
+	ctx, span := startSpan(ctx, "users", "save")
+	defer span.End()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	set := bson.M{"password_hash": user.PasswordHash, "role": user.Role}
+	var saved User
+	err := u.FindOneAndUpdate(ctx, bson.M{"name": user.Name},
+		bson.M{"$set": set, "$setOnInsert": bson.M{"created_at": user.CreatedAt}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&saved)
+	if err != nil {
+		return User{}, fmt.Errorf("save user %s: %w", user.Name, err)
+	}
+	return saved, nil
+}
+
+// Delete removes user by name
+func (u UsersDAO) Delete(ctx context.Context, name string) error {
+	defer metrics.ObserveMongo("users_delete", time.Now())
+	ctx, span := startSpan(ctx, "users", "delete")
+	defer span.End()
+	res, err := u.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return fmt.Errorf("delete user %s: %w", name, err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("user %s not found", name)
+	}
+	return nil
+}
+
+// Count returns number of users
+func (u UsersDAO) Count(ctx context.Context) (int64, error) {
+	defer metrics.ObserveMongo("users_count", time.Now())
+	ctx, span := startSpan(ctx, "users", "count")
+	defer span.End()
+	n, err := u.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pkgz/testutils/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsersSaveAndGet(t *testing.T) {
+	users := setupUsers(t)
+
+	user := User{Name: "john", Role: RoleEditor}
+	require.NoError(t, user.SetPassword("secret"))
+	saved, err := users.Save(context.Background(), user)
+	require.NoError(t, err)
+	assert.False(t, saved.ID.IsZero())
+	assert.False(t, saved.CreatedAt.IsZero())
+
+	got, found := users.Get(context.Background(), "john")
+	require.True(t, found)
+	assert.Equal(t, saved.ID, got.ID)
+	assert.Equal(t, RoleEditor, got.Role)
+	assert.True(t, got.CheckPassword("secret"))
+
+	// update keeps id and creation time
+	got.Role = RoleAdmin
+	updated, err := users.Save(context.Background(), got)
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, updated.ID)
+	assert.Equal(t, saved.CreatedAt.Unix(), updated.CreatedAt.Unix())
+	assert.Equal(t, RoleAdmin, updated.Role)
+
+	_, found = users.Get(context.Background(), "jane")
+	assert.False(t, found)
+}
+
+func TestUsersAllCountDelete(t *testing.T) {
+	users := setupUsers(t)
+
+	n, err := users.Count(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	for _, name := range []string{"bob", "alice"} {
+		_, err = users.Save(context.Background(), User{Name: name, Role: RoleViewer})
+		require.NoError(t, err)
+	}
+	all := users.All(context.Background())
+	require.Len(t, all, 2)
+	assert.Equal(t, "alice", all[0].Name)
+	assert.Equal(t, "bob", all[1].Name)
+
+	n, err = users.Count(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	require.NoError(t, users.Delete(context.Background(), "bob"))
+	require.Error(t, users.Delete(context.Background(), "bob"))
+	assert.Len(t, users.All(context.Background()), 1)
+}
+
+func TestUserPassword(t *testing.T) {
+	var user User
+	assert.False(t, user.CheckPassword(""), "no password set")
+	require.Error(t, user.SetPassword(""))
+	require.NoError(t, user.SetPassword("secret"))
+	assert.NotContains(t, user.PasswordHash, "secret")
+	assert.True(t, user.CheckPassword("secret"))
+	assert.False(t, user.CheckPassword("Secret"))
+}
+
+func TestRoleAllows(t *testing.T) {
+	tbl := []struct {
+		role, required Role
+		allowed        bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleEditor, RoleViewer, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleAdmin, RoleEditor, true},
+		{RoleAdmin, RoleAdmin, true},
+		{Role("root"), RoleViewer, false},
+		{Role(""), RoleViewer, false},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.allowed, tt.role.Allows(tt.required), "%s requires %s", tt.role, tt.required)
+	}
+	assert.True(t, RoleAdmin.Valid())
+	assert.False(t, Role("root").Valid())
+}
+
+func setupUsers(t *testing.T) UsersDAO {
+	t.Helper()
+	mc := containers.NewMongoTestContainer(context.Background(), t, 5)
+	t.Cleanup(func() { mc.Close(context.Background()) }) //nolint:errcheck
+
+	server, err := New(mc.URI, "test_ureadability", 0)
+	require.NoError(t, err)
+	return server.GetStores().Users
+}
@@ -0,0 +1,236 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// archive modes of ExtractOptions.Archive
+const (
+	ArchiveInline = "inline" // images of rich content inlined as data URIs
+	ArchiveZip    = "zip"    // zip bundle with index.html and images, in Archive.Bundle
+)
+
+// DefaultMaxArchiveSize is the total size of archived images used when UReadability's MaxArchiveSize is not set
+const DefaultMaxArchiveSize = 50 << 20
+
+// archiveConcurrency is the number of images downloaded at once for an archive
+const archiveConcurrency = 4
+
+// Archive is a self-contained copy of the article, kept even after the origin disappears
+type Archive struct {
+	Hash    string   `json:"hash"`              // sha256 of title and text, the same for the same article on different urls
+	Images  int      `json:"images"`            // number of images stored in the archive
+	Skipped []string `json:"skipped,omitempty"` // images left as links, failed to download or over the limits
+	Bundle  []byte   `json:"bundle,omitempty"`  // zip with index.html and images, set for ArchiveZip
+}
+
+// archivedImage is an image of rich content downloaded for the archive
+type archivedImage struct {
+	src  string
+	img  *ProxiedImage
+	name string // file name in zip bundle
+}
+
+// imageBudget limits images downloaded for an archive or all chapters of EPUB book
+type imageBudget struct {
+	size       int64                     // total size of images left, in bytes
+	count      int                       // number of images left, unlimited if negative
+	counted    map[string]bool           // file names of stored images, the same image on different urls is counted once
+	downloaded map[string]*archivedImage // images by url, not downloaded again
+}
+
+// newImageBudget returns budget of MaxArchiveSize in total and count images, unlimited if count is negative
+func (f *UReadability) newImageBudget(count int) *imageBudget {
+	size := f.MaxArchiveSize
+	if size <= 0 {
+		size = DefaultMaxArchiveSize
+	}
+	return &imageBudget{size: size, count: count, counted: map[string]bool{}, downloaded: map[string]*archivedImage{}}
+}
+
+// archive makes rich content of the response self-contained. Images are downloaded with MaxImageSize limit
+// each and MaxArchiveSize in total, and either inlined as data URIs or put into zip bundle with the html.
+// Sources of images, which are remote, are dropped; images failed to download stay as links.
+func (f *UReadability) archive(ctx context.Context, rb *Response, mode string) {
+	ctx, span := tracer.Start(ctx, "extract.archive")
+	defer span.End()
+	diag, started := diagnostics(ctx), time.Now()
+	defer diag.stage("archive", started)
+
+	rb.Archive = &Archive{Hash: contentHash(rb.Title, rb.Content)}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rb.Rich))
+	if err != nil {
+		log.Printf("[WARN] failed to parse content to archive, %v", err)
+		return
+	}
+
+	images := f.downloadArchiveImages(ctx, doc, f.newImageBudget(-1))
+	doc.Find("picture source, img[srcset]").Each(func(_ int, s *goquery.Selection) {
+		if s.Is("source") {
+			s.Remove()
+			return
+		}
+		s.RemoveAttr("srcset").RemoveAttr("sizes")
+	})
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		ai, ok := images[s.AttrOr("src", "")]
+		if !ok || ai.img == nil {
+			return
+		}
+		if mode == ArchiveInline {
+			s.SetAttr("src", "data:"+ai.img.ContentType+";base64,"+base64.StdEncoding.EncodeToString(ai.img.Data))
+			return
+		}
+		s.SetAttr("src", ai.name)
+	})
+	for src, ai := range images {
+		if ai.img == nil {
+			rb.Archive.Skipped = append(rb.Archive.Skipped, src)
+			delete(images, src)
+		}
+	}
+	slices.Sort(rb.Archive.Skipped)
+	rb.Archive.Images = len(images)
+
+	rich, err := doc.Find("body").Html()
+	if err != nil {
+		log.Printf("[WARN] failed to render archived content, %v", err)
+		return
+	}
+	rb.Rich = rich
+	if mode == ArchiveZip {
+		if rb.Archive.Bundle, err = zipBundle(rb, images); err != nil {
+			log.Printf("[WARN] failed to make archive bundle for %s, %v", rb.URL, err)
+		}
+	}
+	span.SetAttributes(attribute.Int("archive.images", rb.Archive.Images), attribute.Int("archive.skipped", len(rb.Archive.Skipped)))
+	log.Printf("[DEBUG] archived %s with %d images, %d skipped", rb.URL, rb.Archive.Images, len(rb.Archive.Skipped))
+}
+
+// downloadArchiveImages downloads http images of the document once per url, images of the url downloaded
+// before with the same budget are reused. Images failed to download or over the budget, taken in document
+// order, are returned without img.
+func (f *UReadability) downloadArchiveImages(ctx context.Context, doc *goquery.Document, budget *imageBudget) map[string]*archivedImage {
+	images := map[string]*archivedImage{}
+	var order []*archivedImage
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		src := s.AttrOr("src", "")
+		if _, seen := images[src]; seen || (!strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://")) {
+			return
+		}
+		if ai, ok := budget.downloaded[src]; ok {
+			images[src] = ai
+			return
+		}
+		images[src] = &archivedImage{src: src}
+		budget.downloaded[src] = images[src]
+		if budget.count >= 0 && len(order) >= budget.count {
+			return // not downloaded, over the number of images left
+		}
+		order = append(order, images[src])
+	})
+
+	limit := f.MaxImageSize
+	if limit <= 0 {
+		limit = DefaultMaxImageSize
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, archiveConcurrency)
+	for _, ai := range order {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			img, _, err := downloadImage(ctx, f.imageHTTPClient(), f.Policy, ai.src, limit)
+			if err != nil {
+				log.Printf("[WARN] can't archive image %s, %v", ai.src, err)
+				return
+			}
+			ai.img = img
+		})
+	}
+	wg.Wait()
+
+	for _, ai := range order {
+		if ai.img == nil {
+			continue
+		}
+		sum := sha256.Sum256(ai.img.Data)
+		ai.name = "images/" + hex.EncodeToString(sum[:8]) + imageExt(ai.img.ContentType)
+		if budget.counted[ai.name] {
+			continue
+		}
+		if int64(len(ai.img.Data)) > budget.size || budget.count == 0 {
+			log.Printf("[WARN] skip archive image %s, over the total size or number of images", ai.src)
+			ai.img = nil
+			continue
+		}
+		budget.size -= int64(len(ai.img.Data))
+		budget.count--
+		budget.counted[ai.name] = true
+	}
+	return images
+}
+
+// zipBundle returns zip with index.html of the article and its images
+func zipBundle(rb *Response, images map[string]*archivedImage) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("index.html")
+	if err != nil {
+		return nil, err
+	}
+	title := html.EscapeString(rb.Title)
+	if _, err = fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>"+
+		"<link rel=\"canonical\" href=\"%s\"></head>\n<body><article><h1>%s</h1>\n%s\n</article></body></html>\n",
+		title, html.EscapeString(rb.URL), title, rb.Rich); err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{} // the same image on different urls is stored once
+	for _, ai := range images {
+		files[ai.name] = ai.img.Data
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if w, err = zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}); err != nil { // images are compressed already
+			return nil, err
+		}
+		if _, err = w.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// contentHash returns hex sha256 of the title and text with collapsed whitespace, so the same article
+// saved from different urls or with different markup gets the same hash
+func contentHash(title, content string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(title), " ") + "\n" + strings.Join(strings.Fields(content), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// imageExt returns file extension of the image type, one of proxyImageTypes
+func imageExt(contentType string) string {
+	if contentType == "image/jpeg" {
+		return ".jpg"
+	}
+	return "." + strings.TrimPrefix(contentType, "image/")
+}
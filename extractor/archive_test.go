@@ -0,0 +1,115 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractArchive(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 100)...)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.gif", "/a-copy.gif":
+			_, _ = w.Write(gif)
+		case "/b.png":
+			_, _ = w.Write(png)
+		case "/page.png":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>not an image</html>"))
+		default:
+			_, _ = w.Write([]byte(`<html><head><title>Saved  post</title></head><body><article>
+				<p>The article text is long enough, with commas, to be extracted, and it has images in it.</p>
+				<img src="/a.gif" alt="a"><img src="/a-copy.gif"><img src="/missing.gif">
+				<picture><source srcset="/b-2x.png 2x"><img src="/b.png" srcset="/b.png 1x, /b-2x.png 2x" alt="b"></picture>
+				<p>The second paragraph, with more commas, so all the images stay in the content. <img src="/page.png"></p>
+				</article></body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+
+	t.Run("inline", func(t *testing.T) {
+		res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{Archive: ArchiveInline})
+		require.NoError(t, err)
+		require.NotNil(t, res.Archive)
+		assert.Equal(t, 3, res.Archive.Images)
+		assert.Equal(t, []string{ts.URL + "/missing.gif", ts.URL + "/page.png"}, res.Archive.Skipped)
+		assert.Len(t, res.Archive.Hash, 64)
+		assert.Empty(t, res.Archive.Bundle)
+
+		assert.Contains(t, res.Rich, `<img src="data:image/gif;base64,`+base64.StdEncoding.EncodeToString(gif)+`" alt="a"/>`)
+		assert.Contains(t, res.Rich, `<img src="data:image/png;base64,`+base64.StdEncoding.EncodeToString(png)+`" alt="b"/>`)
+		assert.Contains(t, res.Rich, `<img src="`+ts.URL+`/missing.gif"/>`, "failed image stays as link")
+		assert.NotContains(t, res.Rich, "srcset")
+		assert.NotContains(t, res.Rich, "<source")
+		assert.Equal(t, ts.URL+"/b.png", res.Image, "metadata keeps original urls")
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{Archive: ArchiveZip})
+		require.NoError(t, err)
+		require.NotNil(t, res.Archive)
+		assert.Equal(t, 3, res.Archive.Images)
+
+		zr, err := zip.NewReader(bytes.NewReader(res.Archive.Bundle), int64(len(res.Archive.Bundle)))
+		require.NoError(t, err)
+		files := map[string]string{}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			files[f.Name] = string(data)
+		}
+		require.Len(t, files, 3, "index and two images, copy of the same image stored once")
+		index := files["index.html"]
+		assert.Contains(t, index, "<title>Saved  post</title>")
+		assert.Contains(t, index, `<link rel="canonical" href="`+ts.URL+`/post">`)
+		for name, data := range files {
+			if name == "index.html" {
+				continue
+			}
+			assert.True(t, strings.HasPrefix(name, "images/"), name)
+			assert.Contains(t, index, `src="`+name+`"`)
+			assert.Contains(t, res.Rich, `src="`+name+`"`)
+			assert.Contains(t, []string{string(gif), string(png)}, data)
+		}
+
+		again, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{Archive: ArchiveZip})
+		require.NoError(t, err)
+		assert.Equal(t, res.Archive.Bundle, again.Archive.Bundle, "bundle is the same for the same article")
+	})
+
+	t.Run("total size limit", func(t *testing.T) {
+		small := UReadability{TimeOut: 30 * time.Second, MaxArchiveSize: int64(len(gif) + 10)}
+		res, err := small.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{Archive: ArchiveInline})
+		require.NoError(t, err)
+		assert.Equal(t, 2, res.Archive.Images, "both urls of the same gif")
+		assert.Contains(t, res.Archive.Skipped, ts.URL+"/b.png")
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		_, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{Archive: "tar"})
+		require.EqualError(t, err, `unknown archive mode "tar"`)
+	})
+}
+
+func TestContentHash(t *testing.T) {
+	h := contentHash("Title", "Some text,\n\n  with spaces")
+	assert.Equal(t, h, contentHash(" Title ", "Some text, with spaces"))
+	assert.NotEqual(t, h, contentHash("Other title", "Some text, with spaces"))
+	assert.NotEqual(t, h, contentHash("Title", "Some other text"))
+}
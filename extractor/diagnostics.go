@@ -0,0 +1,287 @@
+package extractor
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// maxDiagCandidates is the number of top scored readability candidates reported in diagnostics
+const maxDiagCandidates = 5
+
+// Diagnostics explains how the extraction result was produced, returned with ExtractOptions.Debug
+type Diagnostics struct {
+	Rule       RuleDiagnostics    `json:"rule"`
+	Retriever  string             `json:"retriever"`            // http, cloudflare or custom
+	Parser     string             `json:"parser"`               // rule, fallback, general or pdf
+	RuleError  string             `json:"rule_error,omitempty"` // why custom rule failed, set for fallback
+	Stages     []StageTiming      `json:"stages"`
+	Charset    CharsetDiagnostics `json:"charset"`
+	Candidates []CandidateScore   `json:"estimated_candidates,omitempty"` // approximated top readability candidates, best first
+	Images     []ImageCandidate   `json:"images,omitempty"`               // lead image candidates, best first
+	LeadImage  string             `json:"lead_image,omitempty"`
+}
+
+// RuleDiagnostics describes rule selection
+type RuleDiagnostics struct {
+	Matched bool   `json:"matched"`
+	ID      string `json:"id,omitempty"`
+	Domain  string `json:"domain,omitempty"`
+	Content string `json:"content,omitempty"` // content selector of the rule
+	Source  string `json:"source,omitempty"`  // "lookup" for rule found by domain, "request" for rule passed by caller
+	Reason  string `json:"reason,omitempty"`  // why no rule matched
+}
+
+// StageTiming is the duration of a single extraction stage
+type StageTiming struct {
+	Stage      string  `json:"stage"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// CharsetDiagnostics describes content type and charset detection of the page
+type CharsetDiagnostics struct {
+	HeaderContentType string `json:"header_content_type,omitempty"` // Content-Type response header
+	MetaContentType   string `json:"meta_content_type,omitempty"`   // content of http-equiv=Content-Type meta tag
+	Source            string `json:"source,omitempty"`              // where charset came from: header, meta or default
+	Charset           string `json:"charset,omitempty"`
+	Converted         bool   `json:"converted"` // body was converted to utf-8
+	Error             string `json:"error,omitempty"`
+}
+
+// CandidateScore is the approximated readability score of a content candidate node. go-readability keeps
+// its scores private, so they are recomputed by scoreCandidates and may differ from the node the library picks.
+type CandidateScore struct {
+	Path        string  `json:"path"` // css-like path of the node, like body > div#main.article
+	Score       float64 `json:"score"`
+	TextLength  int     `json:"text_length"`
+	LinkDensity float64 `json:"link_density"`
+}
+
+// ImageCandidate is an image considered for the lead image, ranked by size
+type ImageCandidate struct {
+	URL  string `json:"url"`
+	Size int    `json:"size"` // size in bytes, 0 if the image was skipped
+	Rank int    `json:"rank"`
+}
+
+type diagnosticsKey struct{}
+
+// withDiagnostics returns a copy of ctx collecting diagnostics into d, nil d disables collection
+func withDiagnostics(ctx context.Context, d *Diagnostics) context.Context {
+	return context.WithValue(ctx, diagnosticsKey{}, d)
+}
+
+// diagnostics returns diagnostics collector from ctx, nil if not set. All methods are safe to call on nil.
+func diagnostics(ctx context.Context) *Diagnostics {
+	d, _ := ctx.Value(diagnosticsKey{}).(*Diagnostics)
+	return d
+}
+
+// stage records duration of the stage started at given time
+func (d *Diagnostics) stage(name string, started time.Time) {
+	if d == nil {
+		return
+	}
+	d.Stages = append(d.Stages, StageTiming{Stage: name, DurationMS: float64(time.Since(started).Microseconds()) / 1000})
+}
+
+// parser records which parser produced the content and why the rule failed, if it did
+func (d *Diagnostics) parser(name string, ruleErr error) {
+	if d == nil {
+		return
+	}
+	d.Parser = name
+	if ruleErr != nil {
+		d.RuleError = ruleErr.Error()
+	}
+}
+
+// charset records charset detection details
+func (d *Diagnostics) charset(info CharsetDiagnostics) {
+	if d == nil {
+		return
+	}
+	d.Charset = info
+}
+
+// candidates records top readability candidates of the page body
+func (d *Diagnostics) candidates(body string) {
+	if d == nil {
+		return
+	}
+	d.Candidates = scoreCandidates(body, maxDiagCandidates)
+}
+
+// images records lead image candidates ranked by size, biggest first
+func (d *Diagnostics) images(sizes map[string]int, lead string) {
+	if d == nil {
+		return
+	}
+	for u, size := range sizes {
+		d.Images = append(d.Images, ImageCandidate{URL: u, Size: size})
+	}
+	sort.Slice(d.Images, func(i, j int) bool {
+		if d.Images[i].Size != d.Images[j].Size {
+			return d.Images[i].Size > d.Images[j].Size
+		}
+		if d.Images[i].URL == lead || d.Images[j].URL == lead { // lead image goes first among the same sized
+			return d.Images[i].URL == lead
+		}
+		return d.Images[i].URL < d.Images[j].URL
+	})
+	for i := range d.Images {
+		d.Images[i].Rank = i + 1
+	}
+	d.LeadImage = lead
+}
+
+// regexps of go-readability scoring, the library keeps candidate scores private
+var (
+	reUnlikelyCandidate = regexp.MustCompile(`(?i)combx|comment|community|hidden|disqus|modal|extra|foot|header|menu|remark|rss|` +
+		`shoutbox|sidebar|sponsor|ad-break|agegate|pagination|pager|popup`)
+	reMaybeCandidate = regexp.MustCompile(`(?i)and|article|body|column|main|shadow`)
+	reDivToPElements = regexp.MustCompile(`(?i)<(a|blockquote|dl|div|img|ol|p|pre|table|ul)`)
+	reNegativeWeight = regexp.MustCompile(`(?i)combx|comment|com-|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|` +
+		`shoutbox|sidebar|sponsor|shopping|tags|tool|widget`)
+	rePositiveWeight = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|pagination|post|text|blog|story`)
+)
+
+// scoreCandidates returns up to limit best scored readability candidates of the page body, an approximation
+// of go-readability scoring
+func scoreCandidates(body string, limit int) []CandidateScore {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	nodes := scoreNodes(doc)
+	res := make([]CandidateScore, 0, min(len(nodes), limit))
+	for _, n := range nodes[:min(len(nodes), limit)] {
+		res = append(res, CandidateScore{
+			Path:        nodePath(n.sel),
+			Score:       math.Round(n.score*100) / 100,
+			TextLength:  len(n.sel.Text()),
+			LinkDensity: math.Round(n.density*1000) / 1000,
+		})
+	}
+	return res
+}
+
+// scoredNode is a readability content candidate with its score, already reduced by link density
+type scoredNode struct {
+	sel     *goquery.Selection
+	score   float64
+	density float64
+}
+
+// scoreNodes reproduces the first scoring pass of go-readability and returns candidate nodes, best first.
+// The library retries with relaxed settings when the article is too short, such retries are not reflected here.
+// The document is modified the same way the library does it: unlikely candidates are removed and divs without
+// block elements become paragraphs.
+func scoreNodes(doc *goquery.Document) []scoredNode {
+	doc.Find("script,style,noscript").Remove()
+	doc.Find("*").Not("html,body").Each(func(_ int, s *goquery.Selection) {
+		str := s.AttrOr("class", "") + s.AttrOr("id", "")
+		if strings.Contains(strings.ToLower(str), "popupbody") || (reUnlikelyCandidate.MatchString(str) && !reMaybeCandidate.MatchString(str)) {
+			s.Remove()
+		}
+	})
+	doc.Find("div").Each(func(_ int, s *goquery.Selection) {
+		if inner, htmlErr := s.Html(); htmlErr == nil && !reDivToPElements.MatchString(inner) {
+			s.Get(0).Data = "p"
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	var order []*goquery.Selection
+	addCandidate := func(s *goquery.Selection) {
+		if _, ok := scores[s.Get(0)]; !ok {
+			scores[s.Get(0)] = nodeWeight(s)
+			order = append(order, s)
+		}
+	}
+	doc.Find("p,td").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")+1) + math.Min(float64(len(text)/100), 3)
+		parent := s.Parent()
+		addCandidate(parent)
+		scores[parent.Get(0)] += score
+		if grandparent := parent.Parent(); grandparent.Length() > 0 {
+			addCandidate(grandparent)
+			scores[grandparent.Get(0)] += score / 2
+		}
+	})
+
+	res := make([]scoredNode, 0, len(order))
+	for _, s := range order {
+		density := linkDensity(s)
+		res = append(res, scoredNode{sel: s, score: scores[s.Get(0)] * (1 - density), density: density})
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].score > res[j].score })
+	return res
+}
+
+// nodeWeight is the initial score of candidate node by its tag, class and id
+func nodeWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, attr := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if attr == "" {
+			continue
+		}
+		if reNegativeWeight.MatchString(attr) {
+			weight -= 25
+		}
+		if rePositiveWeight.MatchString(attr) {
+			weight += 25
+		}
+	}
+	switch {
+	case s.Is("div"):
+		weight += 5
+	case s.Is("blockquote,form,fieldset"):
+		weight = 3
+	case s.Is("th"):
+		weight -= 5
+	}
+	return weight
+}
+
+// linkDensity is the share of the node's text inside links
+func linkDensity(s *goquery.Selection) float64 {
+	textLen := len(s.Text())
+	if textLen == 0 {
+		return 0
+	}
+	return float64(len(s.Find("a").Text())) / float64(textLen)
+}
+
+// nodePath returns css-like path of the node from body, like body > div#main.article
+func nodePath(s *goquery.Selection) string {
+	var parts []string
+	for n := s.Get(0); n != nil && n.Type == html.ElementNode && n.Data != "html"; n = n.Parent {
+		part := n.Data
+		for _, a := range n.Attr {
+			switch a.Key {
+			case "id":
+				part += "#" + a.Val
+			case "class":
+				for c := range strings.FieldsSeq(a.Val) {
+					part += "." + c
+				}
+			}
+		}
+		parts = append(parts, part)
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,163 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/extractor/mocks"
+)
+
+func TestScoreCandidates(t *testing.T) {
+	para := "<p>" + strings.Repeat("Long enough paragraph, with commas, ", 4) + "</p>"
+	body := `<html><body><div id="main" class="article body">` + para + para + `</div>` +
+		`<div class="sidebar">` + para + `</div>` +
+		`<div class="links"><p><a href="/a">` + strings.Repeat("link text, ", 5) + `</a></p></div>` +
+		`<script>var x = "` + strings.Repeat("script, ", 10) + `";</script></body></html>`
+
+	res := scoreCandidates(body, 10)
+	require.Len(t, res, 3, "sidebar removed as unlikely candidate")
+	assert.Equal(t, "body > div#main.article.body", res[0].Path)
+	assert.InDelta(t, 25+25+5+2*11, res[0].Score, 0.01, "class and id weights, div bonus and two paragraphs")
+	assert.Equal(t, "body", res[1].Path)
+	assert.InDelta(t, 12.17, res[1].Score, 0.01, "half of children paragraphs scaled by link density")
+	assert.Equal(t, "body > div.links", res[2].Path)
+	assert.InDelta(t, 1, res[2].LinkDensity, 0.001)
+	assert.Zero(t, res[2].Score, "score scaled down by link density")
+
+	assert.Len(t, scoreCandidates(body, 2), 2)
+
+	assert.Empty(t, scoreCandidates("<p>short</p>", 5))
+}
+
+func TestNodePath(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div id="a"><section class="x  y"><p>t</p></section></div>`))
+	require.NoError(t, err)
+	assert.Equal(t, "body > div#a > section.x.y > p", nodePath(doc.Find("p")))
+}
+
+func TestDiagnosticsNil(t *testing.T) {
+	var d *Diagnostics
+	assert.NotPanics(t, func() {
+		d.stage("x", time.Now())
+		d.parser("general", nil)
+		d.charset(CharsetDiagnostics{})
+		d.candidates("<p>text</p>")
+		d.images(map[string]int{"a": 1}, "a")
+	})
+	assert.Nil(t, diagnostics(context.Background()))
+}
+
+func TestExtractDiagnostics(t *testing.T) {
+	para := "<p>" + strings.Repeat("This is a sentence long enough to be counted, ", 5) + "</p>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 500)))
+		case "/small.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 50)))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><title>Diag</title>` +
+				`<meta http-equiv="Content-Type" content="text/html; charset=windows-1251"></head>` +
+				`<body><div class="content">` + para + para + `<img src="/small.png"><img src="/big.png"></div></body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	rules := &mocks.RulesMock{
+		GetFunc: func(context.Context, string) (datastore.Rule, bool) { return datastore.Rule{}, false },
+		ListFunc: func(_ context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error) {
+			if q.Domain == host && q.Enabled != nil && !*q.Enabled {
+				return []datastore.Rule{{Domain: host, Enabled: false}}, 1, nil
+			}
+			return nil, 0, nil
+		},
+		SetHealthFunc: func(context.Context, bson.ObjectID, datastore.RuleHealth) error { return nil },
+	}
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Rules: rules}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		res, err := lr.Extract(context.Background(), ts.URL+"/article")
+		require.NoError(t, err)
+		assert.Nil(t, res.Diagnostics)
+		res, err = lr.ExtractWithOptions(context.Background(), ts.URL+"/article", ExtractOptions{})
+		require.NoError(t, err)
+		assert.Nil(t, res.Diagnostics)
+	})
+
+	t.Run("general parser", func(t *testing.T) {
+		res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/article", ExtractOptions{Debug: true})
+		require.NoError(t, err)
+		d := res.Diagnostics
+		require.NotNil(t, d)
+
+		assert.Equal(t, RuleDiagnostics{Reason: "rule for domain " + host + " is disabled"}, d.Rule)
+		assert.Equal(t, "http", d.Retriever)
+		assert.Equal(t, "general", d.Parser)
+		assert.Empty(t, d.RuleError)
+
+		stages := make([]string, 0, len(d.Stages))
+		for _, s := range d.Stages {
+			stages = append(stages, s.Stage)
+			assert.GreaterOrEqual(t, s.DurationMS, 0.0)
+		}
+		assert.Equal(t, []string{"rule_lookup", "retrieve", "charset", "parse", "normalize_links", "sanitize", "images"}, stages)
+
+		assert.Equal(t, CharsetDiagnostics{HeaderContentType: "text/html", MetaContentType: "text/html; charset=windows-1251",
+			Source: "meta", Charset: "windows-1251", Converted: true}, d.Charset)
+
+		require.NotEmpty(t, d.Candidates)
+		assert.Equal(t, "body > div.content", d.Candidates[0].Path)
+
+		assert.Equal(t, ts.URL+"/big.png", d.LeadImage)
+		assert.Equal(t, res.Image, d.LeadImage)
+		assert.Equal(t, []ImageCandidate{{URL: ts.URL + "/big.png", Size: 508, Rank: 1},
+			{URL: ts.URL + "/small.png", Size: 58, Rank: 2}}, d.Images)
+	})
+
+	t.Run("rule passed with request falls back", func(t *testing.T) {
+		rule := &datastore.Rule{ID: bson.NewObjectID(), Domain: host, Content: "div.missing"}
+		res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/article", ExtractOptions{Rule: rule, Debug: true})
+		require.NoError(t, err)
+		d := res.Diagnostics
+		assert.Equal(t, RuleDiagnostics{Matched: true, ID: rule.ID.Hex(), Domain: host, Content: "div.missing", Source: "request"}, d.Rule)
+		assert.Equal(t, "fallback", d.Parser)
+		assert.Contains(t, d.RuleError, "nothing extracted")
+		assert.NotEmpty(t, d.Candidates)
+		assert.Equal(t, "retrieve", d.Stages[0].Stage, "no lookup for the rule passed with request")
+	})
+
+	t.Run("rule found by lookup", func(t *testing.T) {
+		ruled := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Rules: &mocks.RulesMock{
+			GetFunc: func(context.Context, string) (datastore.Rule, bool) {
+				return datastore.Rule{Domain: host, Content: "div.content", Enabled: true}, true
+			},
+		}}
+		res, err := ruled.ExtractWithOptions(context.Background(), ts.URL+"/article", ExtractOptions{Debug: true})
+		require.NoError(t, err)
+		d := res.Diagnostics
+		assert.Equal(t, RuleDiagnostics{Matched: true, Domain: host, Content: "div.content", Source: "lookup"}, d.Rule)
+		assert.Equal(t, "rule", d.Parser)
+		assert.Empty(t, d.Candidates, "readability is not used")
+	})
+
+	t.Run("no rules storage", func(t *testing.T) {
+		plain := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200}
+		res, err := plain.ExtractWithOptions(context.Background(), ts.URL+"/article", ExtractOptions{Debug: true})
+		require.NoError(t, err)
+		assert.Equal(t, "rules storage is not configured", res.Diagnostics.Rule.Reason)
+	})
+}
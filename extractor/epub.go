@@ -0,0 +1,339 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	xhtml "golang.org/x/net/html"
+)
+
+// ErrNoArticles is returned when none of the urls of EPUB book could be extracted
+var ErrNoArticles = errors.New("no articles extracted")
+
+// epubImageTypes are image types embedded into EPUB, core media types of EPUB 3
+var epubImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// maxEPUBImages limits number of images embedded into EPUB book, all chapters together
+const maxEPUBImages = 500
+
+// EPUBBook is an EPUB 3 book made of extracted articles
+type EPUBBook struct {
+	Title    string
+	Data     []byte
+	Articles []string // urls of articles in the book
+	Skipped  []string // urls failed to extract
+}
+
+// epubChapter is an article of EPUB book
+type epubChapter struct {
+	ID        string
+	File      string
+	Title     string
+	Author    string
+	Published string // date part of publication time
+	Language  string
+	URL       string
+	Body      string // xhtml of the article
+}
+
+// EPUB extracts articles of urls and returns them as EPUB 3 book with table of contents, one chapter per article
+// with its title, author, source url and date, and images embedded. Articles are sanitized rich content, images
+// failed to download or over MaxArchiveSize and maxEPUBImages for the whole book are left out. Urls failed to extract are skipped, ErrNoArticles returned if all failed.
+// Title of the book defaults to the title of the only article or to "Reading list" with the date.
+func (f *UReadability) EPUB(ctx context.Context, title string, urls []string) (*EPUBBook, error) {
+	ctx, span := tracer.Start(ctx, "extract.epub")
+	defer span.End()
+
+	results := make([]*Response, len(urls))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, archiveConcurrency)
+	for i, u := range urls {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			rb, err := f.ExtractWithOptions(ctx, u, ExtractOptions{})
+			if err != nil {
+				log.Printf("[WARN] can't extract %s for epub, %v", u, err)
+				return
+			}
+			results[i] = rb
+		})
+	}
+	wg.Wait()
+
+	book := &EPUBBook{Title: strings.TrimSpace(title)}
+	var chapters []epubChapter
+	images := map[string]*archivedImage{} // by file name, shared by chapters
+	budget := f.newImageBudget(maxEPUBImages)
+	for i, rb := range results {
+		if rb == nil {
+			book.Skipped = append(book.Skipped, urls[i])
+			continue
+		}
+		book.Articles = append(book.Articles, urls[i])
+		ch := epubChapter{ID: fmt.Sprintf("article-%03d", len(chapters)+1), Title: strings.TrimSpace(rb.Title),
+			Author: rb.Metadata["author"], URL: rb.URL, Language: rb.Language}
+		ch.File = ch.ID + ".xhtml"
+		if ch.Title == "" {
+			ch.Title = rb.URL
+		}
+		if t, ok := parseMetaDate(rb.Metadata["published"]); ok {
+			ch.Published = t.Format("2006-01-02")
+		}
+		ch.Body = f.epubBody(ctx, rb.Rich, images, budget)
+		chapters = append(chapters, ch)
+	}
+	if len(chapters) == 0 {
+		return nil, ErrNoArticles
+	}
+	if book.Title == "" && len(chapters) == 1 {
+		book.Title = chapters[0].Title
+	}
+	if book.Title == "" {
+		book.Title = "Reading list " + time.Now().Format("2006-01-02")
+	}
+
+	data, err := epubPackage(book.Title, chapters, images)
+	if err != nil {
+		return nil, fmt.Errorf("make epub: %w", err)
+	}
+	book.Data = data
+	log.Printf("[INFO] made epub %q with %d articles, %d skipped", book.Title, len(book.Articles), len(book.Skipped))
+	return book, nil
+}
+
+// epubBody returns xhtml of the article with images embedded, downloaded with the budget of the book. Remote
+// media and images failed to download are removed, as EPUB readers don't load them.
+func (f *UReadability) epubBody(ctx context.Context, rich string, images map[string]*archivedImage, budget *imageBudget) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rich))
+	if err != nil {
+		log.Printf("[WARN] failed to parse content for epub, %v", err)
+		return ""
+	}
+	doc.Find("iframe, video, audio, picture source, object, embed").Remove()
+	doc.Find("img").RemoveAttr("srcset").RemoveAttr("sizes")
+
+	downloaded := f.downloadArchiveImages(ctx, doc, budget)
+	doc.Find("img").Each(func(_ int, s *goquery.Selection) {
+		ai, ok := downloaded[s.AttrOr("src", "")]
+		if !ok || ai.img == nil || !slices.Contains(epubImageTypes, ai.img.ContentType) {
+			s.Remove()
+			return
+		}
+		images[ai.name] = ai
+		s.SetAttr("src", ai.name)
+		if _, ok := s.Attr("alt"); !ok {
+			s.SetAttr("alt", "")
+		}
+	})
+
+	// x/net/html renders void elements self-closed and escapes text, so the output is well-formed xhtml
+	var buf bytes.Buffer
+	for _, node := range doc.Find("body").Contents().Nodes {
+		if err = xhtml.Render(&buf, node); err != nil {
+			log.Printf("[WARN] failed to render content for epub, %v", err)
+			return ""
+		}
+	}
+	return buf.String()
+}
+
+// epubPackage writes EPUB container: mimetype first and uncompressed, container.xml, package document,
+// navigation document, chapters and images
+func epubPackage(title string, chapters []epubChapter, images map[string]*archivedImage) ([]byte, error) {
+	var authors []string
+	for _, ch := range chapters {
+		if ch.Author != "" && !slices.Contains(authors, ch.Author) {
+			authors = append(authors, ch.Author)
+		}
+	}
+	var ids []string
+	for _, ch := range chapters {
+		ids = append(ids, ch.URL)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	language := chapters[0].Language // language of the book is set if all articles have the same one
+	for _, ch := range chapters {
+		if ch.Language != language {
+			language = ""
+		}
+	}
+	if language == "" {
+		language = "und"
+	}
+	types := map[string]string{}
+	for name, ai := range images {
+		types[name] = ai.img.ContentType
+	}
+	data := map[string]any{
+		"Title":    title,
+		"ID":       fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]),
+		"Language": language,
+		"Modified": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"Authors":  authors,
+		"Chapters": chapters,
+		"Images":   slices.Sorted(maps.Keys(images)),
+		"Types":    types,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.WriteString(w, "application/epub+zip"); err != nil {
+		return nil, err
+	}
+	if err = writeZipFile(zw, "META-INF/container.xml", epubContainer); err != nil {
+		return nil, err
+	}
+	for _, doc := range []struct{ name, tmpl string }{{"OEBPS/content.opf", epubOPF}, {"OEBPS/nav.xhtml", epubNav}} {
+		var out bytes.Buffer
+		if err = epubTemplates.ExecuteTemplate(&out, doc.tmpl, data); err != nil {
+			return nil, err
+		}
+		if err = writeZipFile(zw, doc.name, out.String()); err != nil {
+			return nil, err
+		}
+	}
+	if err = writeZipFile(zw, "OEBPS/style.css", epubStyle); err != nil {
+		return nil, err
+	}
+	for _, ch := range chapters {
+		var out bytes.Buffer
+		if err = epubTemplates.ExecuteTemplate(&out, epubChapterTmpl, ch); err != nil {
+			return nil, err
+		}
+		if err = writeZipFile(zw, "OEBPS/"+ch.File, out.String()); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(images)) {
+		if w, err = zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + name, Method: zip.Store}); err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(images[name].img.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZipFile adds compressed file to zip
+func writeZipFile(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubStyle = `body { font-family: serif; line-height: 1.5; }
+img { max-width: 100%; height: auto; }
+.article__meta { color: #666; font-size: 0.9em; }
+pre { white-space: pre-wrap; }
+`
+
+// names of epubTemplates
+const (
+	epubOPF         = "opf"
+	epubNav         = "nav"
+	epubChapterTmpl = "chapter"
+)
+
+// epubTemplates are package, navigation and chapter documents. text/template is used with explicit escaping,
+// as html/template escapes for html and would break xml declarations.
+var epubTemplates = template.Must(template.New("epub").Funcs(template.FuncMap{"esc": html.EscapeString}).Parse(
+	`{{define "opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{.ID}}</dc:identifier>
+    <dc:title>{{esc .Title}}</dc:title>
+    <dc:language>{{.Language}}</dc:language>
+{{- range .Authors}}
+    <dc:creator>{{esc .}}</dc:creator>
+{{- end}}
+{{- range .Chapters}}
+    <dc:source>{{esc .URL}}</dc:source>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range $i, $name := .Images}}
+    <item id="image-{{$i}}" href="{{$name}}" media-type="{{index $.Types $name}}"/>
+{{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="nav"/>
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+{{end}}
+
+{{define "nav"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{esc .Title}}</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{esc .Title}}</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{.File}}">{{esc .Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+{{end}}
+
+{{define "chapter"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"{{if .Language}} xml:lang="{{.Language}}" lang="{{.Language}}"{{end}}>
+<head><title>{{esc .Title}}</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body>
+<article>
+<h1>{{esc .Title}}</h1>
+<p class="article__meta">
+{{- if .Author}}{{esc .Author}}<br/>{{end}}
+{{- if .Published}}<time datetime="{{.Published}}">{{.Published}}</time><br/>{{end}}
+<a href="{{esc .URL}}">{{esc .URL}}</a></p>
+{{.Body}}
+</article>
+</body>
+</html>
+{{end}}`))
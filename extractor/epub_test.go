@@ -0,0 +1,165 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEPUB(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pic.gif":
+			_, _ = w.Write(gif)
+		case "/one":
+			_, _ = w.Write([]byte(`<html><head><title>First &amp; best</title><meta name="author" content="Ann">
+				<meta property="article:published_time" content="2024-03-05T10:20:30Z"></head><body><article>
+				<p>The first article text is long enough, with commas, to be extracted, and it has an image.</p>
+				<img src="/pic.gif" srcset="/pic.gif 1x, /pic-2x.gif 2x"><img src="/missing.gif" alt="gone"><br>
+				<p>The second paragraph, with more commas&nbsp;and <a href="/x?a=1&b=2">a link</a>, so the content is kept.</p>
+				</article></body></html>`))
+		case "/two":
+			_, _ = w.Write([]byte(`<html><head><title>Second</title></head><body><article>
+				<p>The second article text is long enough, with commas, to be extracted, and has the same image.</p>
+				<img src="/pic.gif"><video src="/v.mp4"></video>
+				</article></body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	book, err := lr.EPUB(context.Background(), "", []string{ts.URL + "/one", "http://bad host/", ts.URL + "/two"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ts.URL + "/one", ts.URL + "/two"}, book.Articles)
+	assert.Equal(t, []string{"http://bad host/"}, book.Skipped)
+	assert.True(t, strings.HasPrefix(book.Title, "Reading list "), book.Title)
+
+	zr, err := zip.NewReader(bytes.NewReader(book.Data), int64(len(book.Data)))
+	require.NoError(t, err)
+	require.NotEmpty(t, zr.File)
+	assert.Equal(t, "mimetype", zr.File[0].Name, "mimetype goes first")
+	assert.Equal(t, zip.Store, zr.File[0].Method, "mimetype is not compressed")
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xhtml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xml") {
+			assertWellFormed(t, f.Name, string(data))
+		}
+	}
+	assert.Equal(t, "application/epub+zip", files["mimetype"])
+	assert.Contains(t, files["META-INF/container.xml"], `full-path="OEBPS/content.opf"`)
+
+	opf := files["OEBPS/content.opf"]
+	assert.Contains(t, opf, "<dc:creator>Ann</dc:creator>")
+	assert.Contains(t, opf, "<dc:language>en</dc:language>")
+	assert.Contains(t, opf, "<dc:source>"+ts.URL+"/one</dc:source>")
+	assert.Contains(t, opf, `properties="nav"`)
+	assert.Contains(t, opf, `<itemref idref="article-002"/>`)
+	assert.Contains(t, opf, `media-type="image/gif"`)
+	assert.Equal(t, 1, strings.Count(opf, `media-type="image/gif"`), "the same image is stored once")
+
+	assert.Contains(t, files["OEBPS/nav.xhtml"], `<li><a href="article-001.xhtml">First &amp; best</a></li>`)
+	assert.Contains(t, files["OEBPS/nav.xhtml"], `<li><a href="article-002.xhtml">Second</a></li>`)
+
+	first := files["OEBPS/article-001.xhtml"]
+	assert.Contains(t, first, `<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">`)
+	assert.Contains(t, first, "<h1>First &amp; best</h1>")
+	assert.Contains(t, first, `Ann<br/><time datetime="2024-03-05">2024-03-05</time>`)
+	assert.Contains(t, first, `<a href="`+ts.URL+`/one">`)
+	assert.Regexp(t, `<img src="images/[0-9a-f]{16}\.gif" alt=""/>`, first)
+	assert.NotContains(t, first, "missing.gif", "image failed to download is removed")
+	assert.NotContains(t, first, "srcset")
+	assert.NotContains(t, files["OEBPS/article-002.xhtml"], "<video")
+}
+
+func TestEPUBImageBudget(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".gif") {
+			hits.Add(1)
+			_, _ = w.Write(append(gif, r.URL.Path...)) // different image for each url
+			return
+		}
+		_, _ = fmt.Fprintf(w, `<html><head><title>%[1]s</title></head><body><article>
+			<p>The article %[1]s is long enough, with commas, to be extracted, and it has an image in it.</p>
+			<img src="/%[1]s.gif"><img src="/shared.gif">
+			<p>The second paragraph, with more commas, so the images stay in the article content.</p>
+			</article></body></html>`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer ts.Close()
+
+	t.Run("size of the book", func(t *testing.T) {
+		lr := UReadability{TimeOut: 30 * time.Second, MaxArchiveSize: int64(3*len(gif) + 30)}
+		book, err := lr.EPUB(context.Background(), "", []string{ts.URL + "/one", ts.URL + "/two", ts.URL + "/three"})
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(book.Data), int64(len(book.Data)))
+		require.NoError(t, err)
+		var images int
+		for _, f := range zr.File {
+			if strings.HasPrefix(f.Name, "OEBPS/images/") {
+				images++
+			}
+		}
+		assert.Equal(t, 3, images, "images of two chapters and the shared one, the third chapter is over the limit")
+	})
+
+	t.Run("number of images", func(t *testing.T) {
+		hits.Store(0)
+		lr := UReadability{TimeOut: 30 * time.Second}
+		budget := lr.newImageBudget(2)
+		for _, name := range []string{"one", "two"} {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<img src="` + ts.URL + `/` + name + `.gif">` +
+				`<img src="` + ts.URL + `/shared.gif">`))
+			require.NoError(t, err)
+			images := lr.downloadArchiveImages(context.Background(), doc, budget)
+			require.Len(t, images, 2)
+			assert.NotNil(t, images[ts.URL+"/shared.gif"].img, "shared image is kept in both chapters")
+			assert.Equal(t, name == "one", images[ts.URL+"/"+name+".gif"].img != nil, name)
+		}
+		assert.Equal(t, int32(2), hits.Load(), "images over the count are not downloaded")
+	})
+}
+
+func TestEPUBNoArticles(t *testing.T) {
+	lr := UReadability{TimeOut: time.Second}
+	_, err := lr.EPUB(context.Background(), "title", []string{"http://bad host/"})
+	require.ErrorIs(t, err, ErrNoArticles)
+}
+
+// assertWellFormed checks the document is well-formed xml
+func assertWellFormed(t *testing.T, name, data string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(data))
+	dec.Strict = true
+	dec.Entity = map[string]string{} // xhtml has no named entities besides xml ones
+	for {
+		_, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		require.NoError(t, err, name)
+	}
+}
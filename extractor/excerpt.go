@@ -0,0 +1,253 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// snippet size limits, in characters
+const (
+	DefaultSnippetSize = 300  // used when neither ExtractOptions nor UReadability set the size
+	MaxSnippetSize     = 5000 // max size of ExtractOptions.SnippetSize
+)
+
+// excerpt parameters
+const (
+	minDescriptionSize = 50  // shorter descriptions are usually site slogans, not article summaries
+	minExcerptWords    = 5   // shorter paragraphs without sentence end are dates, bylines or captions
+	maxBylineSize      = 100 // longer paragraphs starting like a byline are regular text
+)
+
+// descriptionSelectors are meta tags with description of the article, most specific first
+var descriptionSelectors = []string{`meta[property="og:description"]`, `meta[name="twitter:description"]`,
+	`meta[name="description"]`}
+
+// excerptSkipClasses are common classes of bylines, dates and captions, matched as whole class names,
+// so wrappers like "post-metadata" or "updates" are not skipped with the article text in them
+var excerptSkipClasses = []string{"byline", "author", "author-name", "caption", "wp-caption-text", "image-caption",
+	"credit", "credits", "photo-credit", "date", "dateline", "post-date", "entry-date", "published", "meta",
+	"post-meta", "entry-meta", "article-meta"}
+
+// excerptSkipSelector matches elements of rich content which are not the article text
+var excerptSkipSelector = `figure, figcaption, caption, table, pre, time, address, h1, h2, h3, h4, h5, h6, ` +
+	`script, style, noscript, [class~="` + strings.Join(excerptSkipClasses, `"], [class~="`) + `"]`
+
+var (
+	reByline      = regexp.MustCompile(`(?i)^(by|posted by|written by|photo|photos|image|credit|source|via|автор|фото|источник)\b`)
+	reDateLine    = regexp.MustCompile(`(?i)\d{1,4}[./-]\d{1,2}[./-]\d{1,4}|\d{1,2}:\d{2}|\b(19|20)\d{2}\b`)
+	reSentenceEnd = regexp.MustCompile(`[.!?…。！？]["'»”’)\]]*$`)
+)
+
+// snippetSize returns size of excerpt, the size requested if set, otherwise SnippetSize or DefaultSnippetSize
+func (f *UReadability) snippetSize(requested int) int {
+	switch {
+	case requested > 0:
+		return requested
+	case f.SnippetSize > 0:
+		return f.SnippetSize
+	}
+	return DefaultSnippetSize
+}
+
+// pageDescriptions returns descriptions of the page from meta tags, most specific first
+func pageDescriptions(doc *goquery.Document) []string {
+	var res []string
+	for _, sel := range descriptionSelectors {
+		if d := strings.Join(strings.Fields(doc.Find(sel).First().AttrOr("content", "")), " "); d != "" {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// makeExcerpt returns excerpt of the article up to size characters. A description of the page is used if it's
+// long enough, differs from the title and is about the article text, without the last sentence if it's cut.
+// Otherwise whole leading sentences of rich content paragraphs are used, skipping headings, bylines, dates
+// and captions. A sentence longer than size is cut at word boundary, or at any character for languages
+// without spaces.
+func makeExcerpt(rich, text, title string, descriptions []string, size int) string {
+	for _, d := range descriptions {
+		if !goodDescription(d, title, text) {
+			continue
+		}
+		sentences := splitSentences(d)
+		if last := sentences[len(sentences)-1]; strings.HasSuffix(last, "…") || strings.HasSuffix(last, "...") {
+			sentences = sentences[:len(sentences)-1] // descriptions made by engines are cut with ellipsis
+		}
+		if len(sentences) > 0 {
+			return fitSentences(sentences, size)
+		}
+	}
+
+	var sentences []string
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(rich)); err == nil {
+		doc.Find(excerptSkipSelector).Remove()
+		doc.Find("p, li, blockquote, dd").Each(func(_ int, s *goquery.Selection) {
+			if s.Find("p, li, blockquote, dd").Length() > 0 { // text of nested paragraphs is taken from them
+				return
+			}
+			para := strings.Join(strings.Fields(s.Text()), " ")
+			if para == "" || para == strings.TrimSpace(title) || !articleParagraph(para) {
+				return
+			}
+			sentences = append(sentences, splitSentences(para)...)
+		})
+	}
+	if len(sentences) == 0 { // no paragraphs, like content of custom rules selecting text elements
+		sentences = splitSentences(strings.Join(strings.Fields(text), " "))
+	}
+	return fitSentences(sentences, size)
+}
+
+// goodDescription reports whether the description summarizes the article: long enough, not the title,
+// and most of its words are in the text, so it's not a generic description of the site
+func goodDescription(d, title, text string) bool {
+	if utf8.RuneCountInString(d) < minDescriptionSize || strings.EqualFold(d, strings.TrimSpace(title)) {
+		return false
+	}
+	text = strings.ToLower(text)
+	var words, found int
+	for _, w := range strings.FieldsFunc(strings.ToLower(d), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(w)
+		if !isCJK(runes[0]) {
+			if len(runes) >= 4 { // short words are too common to tell anything
+				words++
+				if strings.Contains(text, w) {
+					found++
+				}
+			}
+			continue
+		}
+		for i := 0; i+1 < len(runes); i++ { // languages without spaces are matched by pairs of characters
+			words++
+			if strings.Contains(text, string(runes[i:i+2])) {
+				found++
+			}
+		}
+	}
+	return words > 0 && found*2 >= words
+}
+
+// articleParagraph reports whether the paragraph is the article text, not a byline, date or caption
+func articleParagraph(para string) bool {
+	words, _, _ := textStats(para)
+	ended := reSentenceEnd.MatchString(para)
+	switch {
+	case reByline.MatchString(para) && utf8.RuneCountInString(para) <= maxBylineSize:
+		return false
+	case words < minExcerptWords && !ended:
+		return false
+	case words < 2*minExcerptWords && !ended && reDateLine.MatchString(para):
+		return false
+	}
+	return true
+}
+
+// splitSentences splits text into sentences by terminal punctuation followed by space and an upper case
+// letter or digit, so abbreviations and initials mostly stay inside sentences. Terminal punctuation
+// of languages without spaces ends a sentence without a space.
+func splitSentences(text string) []string {
+	var res []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '。', '！', '？':
+			end := closingEnd(runes, i+1)
+			res = append(res, strings.TrimSpace(string(runes[start:end])))
+			start, i = end, end-1
+		case '.', '!', '?', '…':
+			end := closingEnd(runes, i+1)
+			if end >= len(runes) || !unicode.IsSpace(runes[end]) {
+				continue
+			}
+			next := end
+			for next < len(runes) && unicode.IsSpace(runes[next]) {
+				next++
+			}
+			if next < len(runes) && unicode.IsLower(runes[next]) {
+				continue
+			}
+			if runes[i] == '.' && i-start >= 1 && initialBefore(runes[start:i]) {
+				continue
+			}
+			res = append(res, strings.TrimSpace(string(runes[start:end])))
+			start, i = next, next-1
+		}
+	}
+	if tail := strings.TrimSpace(string(runes[start:])); tail != "" {
+		res = append(res, tail)
+	}
+	return res
+}
+
+// closingEnd returns position after closing quotes and brackets following terminal punctuation
+func closingEnd(runes []rune, i int) int {
+	for i < len(runes) && strings.ContainsRune(`"'»”’)]`, runes[i]) {
+		i++
+	}
+	return i
+}
+
+// initialBefore reports whether the text ends with a single letter, like initial in "J. Smith"
+func initialBefore(runes []rune) bool {
+	n := len(runes)
+	return unicode.IsUpper(runes[n-1]) && (n == 1 || !unicode.IsLetter(runes[n-2]))
+}
+
+// fitSentences joins leading sentences fitting into size characters. The first sentence is cut
+// if it's longer than size, with "..." at the end.
+func fitSentences(sentences []string, size int) string {
+	var b strings.Builder
+	length := 0
+	for _, s := range sentences {
+		n := utf8.RuneCountInString(s)
+		sep := 0
+		if length > 0 && !noSpaceAfter(b.String()) {
+			sep = 1
+		}
+		if length+sep+n > size {
+			if length == 0 {
+				return truncateText(s, size)
+			}
+			break
+		}
+		if sep > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s)
+		length += sep + n
+	}
+	return b.String()
+}
+
+// noSpaceAfter reports whether text ends with terminal punctuation of languages without spaces
+func noSpaceAfter(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return r == '。' || r == '！' || r == '？' || isCJK(r)
+}
+
+// truncateText cuts text to size characters at the last space, keeping at least half of it, and marks
+// the cut with " ...". Text without spaces is cut at any character and marked with "…".
+func truncateText(text string, size int) string {
+	runes := []rune(text)
+	if len(runes) <= size {
+		return text
+	}
+	cut := runes[:max(size-len(" ..."), 1)]
+	for i := len(cut) - 1; i >= len(cut)/2; i-- {
+		if unicode.IsSpace(cut[i]) {
+			return strings.TrimRightFunc(string(cut[:i]), isTrailingPunct) + " ..."
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:max(size-1, 1)]), isTrailingPunct) + "…"
+}
+
+// isTrailingPunct reports whether the rune is punctuation or space dropped before "..."
+func isTrailingPunct(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(",;:-–—", r)
+}
@@ -0,0 +1,105 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeExcerpt(t *testing.T) {
+	const text = "The first sentence of the article. The second one is here! And the third sentence ends the paragraph."
+	tbl := []struct {
+		name         string
+		rich         string
+		text         string
+		descriptions []string
+		size         int
+		want         string
+	}{
+		{name: "whole sentences", rich: "<p>" + text + "</p>", size: 80,
+			want: "The first sentence of the article. The second one is here!"},
+		{name: "first sentence", rich: "<p>" + text + "</p>", size: 40, want: "The first sentence of the article."},
+		{name: "long sentence cut at space", rich: "<p>" + text + "</p>", size: 25, want: "The first sentence ..."},
+		{name: "everything fits", rich: "<p>" + text + "</p>", size: 500, want: text},
+		{name: "sentences of paragraphs", rich: "<p>Short one.</p><ul><li>Item of the list is here.</li></ul>", size: 100,
+			want: "Short one. Item of the list is here."},
+		{name: "skips headings, bylines, dates and captions", size: 100,
+			rich: `<h2>Heading</h2><p>By John Smith</p><p>March 3, 2024 10:20</p><p class="post-meta">Filed under news</p>
+				<figure><img src="a.jpg"><figcaption>The picture of a cat sitting here.</figcaption></figure>
+				<p>Photo: Reuters</p><p>Real text starts here.</p>`,
+			want: "Real text starts here."},
+		{name: "keeps wrappers with similar classes", size: 100,
+			rich: `<div class="post-metadata"><div class="updates authorship"><p class="entry-date">May 5</p>` +
+				`<p>Real text inside the wrapper.</p></div></div>`,
+			want: "Real text inside the wrapper."},
+		{name: "keeps abbreviations and initials", rich: "<p>Mr. J. Smith said e.g. this. Next sentence.</p>", size: 35,
+			want: "Mr. J. Smith said e.g. this."},
+		{name: "closing quotes", rich: `<p>He said "Stop." Then he left.</p>`, size: 16, want: `He said "Stop."`},
+		{name: "text without paragraphs", text: "Plain text here. And more of it.", size: 20, want: "Plain text here."},
+		{name: "chinese", rich: "<p>这是第一句话。这是第二句话。这是第三句话。</p>", size: 14, want: "这是第一句话。这是第二句话。"},
+		{name: "japanese cut", rich: "<p>これはとても長い日本語の文章で句読点がありません</p>", size: 10, want: "これはとても長い日…"},
+		{name: "good description", rich: "<p>" + text + "</p>", text: text, size: 200,
+			descriptions: []string{"The article with the first sentence and the second paragraph of it."},
+			want:         "The article with the first sentence and the second paragraph of it."},
+		{name: "description of the site", rich: "<p>" + text + "</p>", text: text, size: 40,
+			descriptions: []string{"Notes on various topics, by a person who writes about everything"},
+			want:         "The first sentence of the article."},
+		{name: "short description", rich: "<p>" + text + "</p>", text: text, size: 40,
+			descriptions: []string{"The first sentence"}, want: "The first sentence of the article."},
+		{name: "empty", size: 100, want: ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			got := makeExcerpt(tt.rich, tt.text, "Title", tt.descriptions, tt.size)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, len([]rune(got)), tt.size)
+		})
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tbl := []struct {
+		text string
+		want []string
+	}{
+		{"One. Two! Three? Four", []string{"One.", "Two!", "Three?", "Four"}},
+		{"Version 1.2 is out. Get it", []string{"Version 1.2 is out.", "Get it"}},
+		{"Wait… what? Yes.", []string{"Wait… what?", "Yes."}},
+		{"«Да.» Нет.", []string{"«Да.»", "Нет."}},
+		{"一句。二句！三句", []string{"一句。", "二句！", "三句"}},
+		{"", nil},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitSentences(tt.text))
+		})
+	}
+}
+
+func TestExtractSnippetSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>Post</title><meta name="description" content="Blog about things"></head>
+			<body><article><p>The article text is long enough, with commas, to be extracted, and it has two sentences.
+			The second paragraph, with more commas, so the content is kept for the excerpt.</p></article></body></html>`))
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	res, err := lr.Extract(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Excerpt, "The article text is long enough"), res.Excerpt)
+	assert.True(t, strings.HasSuffix(res.Excerpt, "for the excerpt."), "whole text fits default size: %s", res.Excerpt)
+
+	res, err = lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{SnippetSize: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "The article text is long enough, with commas, to be extracted, and it has two sentences.", res.Excerpt)
+
+	_, err = lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{SnippetSize: MaxSnippetSize + 1})
+	require.EqualError(t, err, "snippet size 5001 is out of range 0-5000, 0 for default")
+}
@@ -0,0 +1,327 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
+)
+
+// proxyImageTypes are image types served by ImageProxy, svg is not on the list as it can carry scripts
+var proxyImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/avif"}
+
+// maxResizePixels limits size of decoded image to resize, bigger images are served as is
+const maxResizePixels = 25_000_000
+
+// ImageProxy serves images of extracted articles through the service, so readers don't hit origin sites:
+// their addresses are not leaked, hotlink protection and mixed content don't break the images.
+// Proxied urls are signed with HMAC of Secret, so the proxy can't be used for arbitrary urls.
+type ImageProxy struct {
+	BaseURL   string          // public url of the service proxied urls are built with, like https://ukeeper.example.com
+	Secret    []byte          // key to sign proxied urls, must be the same on all instances
+	Policy    *OutboundPolicy // restricts fetched images; nil allows everything
+	MaxSize   int64           // max image size in bytes, bigger images are rejected; defaults to DefaultMaxImageSize
+	CacheSize int64           // max total size of cached images in bytes, 0 disables cache
+	Widths    []int           // widths images can be resized to with w parameter, resizing is disabled if empty
+
+	once     sync.Once
+	client   *http.Client
+	group    singleflight.Group
+	detached sync.WaitGroup // fetches left running by gone requests
+
+	mu    sync.Mutex
+	lru   *list.List               // cached images, most recently used first
+	cache map[string]*list.Element // cache key to element of lru
+	used  int64                    // total size of cached images
+}
+
+// ProxiedImage is an image served by ImageProxy
+type ProxiedImage struct {
+	Data        []byte
+	ContentType string
+}
+
+type cachedImage struct {
+	key string
+	img *ProxiedImage
+}
+
+// URL returns signed proxied url of the image, non-http urls are returned as is
+func (p *ImageProxy) URL(src string) string {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return src
+	}
+	return strings.TrimSuffix(p.BaseURL, "/") + "/img?u=" + url.QueryEscape(src) + "&sig=" + p.sign(src)
+}
+
+// Verify checks signature of proxied image url
+func (p *ImageProxy) Verify(src, sig string) bool {
+	return hmac.Equal([]byte(p.sign(src)), []byte(sig))
+}
+
+func (p *ImageProxy) sign(src string) string {
+	mac := hmac.New(sha256.New, p.Secret)
+	_, _ = mac.Write([]byte(src))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Fetch returns the image, resized down to width if it is not 0 and the image is wider. Concurrent requests
+// of the same image share a single fetch, made with its own timeout and not canceled if the request started it
+// goes away, and fetched images are cached. Errors are ContentError for too large
+// or not allowed types and ErrForbiddenTarget for urls rejected by the policy.
+func (p *ImageProxy) Fetch(ctx context.Context, src string, width int) (*ProxiedImage, error) {
+	if width != 0 && !slices.Contains(p.Widths, width) {
+		return nil, fmt.Errorf("width %d is not allowed", width)
+	}
+	p.once.Do(p.init)
+	key := src + "|" + strconv.Itoa(width)
+	if img, ok := p.cached(key); ok {
+		metrics.ObserveImageProxy("cached")
+		return img, nil
+	}
+	ch := p.group.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), httpDefaultTimeout)
+		defer cancel()
+		if width != 0 { // resized from the original, which is fetched once for all widths
+			orig, err := p.Fetch(ctx, src, 0)
+			if err != nil {
+				return nil, err
+			}
+			img := resizeImage(orig, width)
+			p.store(key, img)
+			return img, nil
+		}
+		img, err := p.fetch(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		p.store(key, img)
+		return img, nil
+	})
+	select {
+	case <-ctx.Done():
+		p.detached.Go(func() { <-ch })
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*ProxiedImage), nil
+	}
+}
+
+// Wait waits for fetches left running by gone requests
+func (p *ImageProxy) Wait() {
+	p.detached.Wait()
+}
+
+func (p *ImageProxy) init() {
+	p.lru, p.cache = list.New(), map[string]*list.Element{}
+	p.client = &http.Client{
+		Timeout:   httpDefaultTimeout,
+		Transport: p.Policy.Transport(http.DefaultTransport.(*http.Transport).Clone()),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return p.Policy.CheckURL(req.URL)
+		},
+	}
+}
+
+// fetch loads the image from origin, checking its size and type
+func (p *ImageProxy) fetch(ctx context.Context, src string) (*ProxiedImage, error) {
+	ctx, span := tracer.Start(ctx, "imgproxy.fetch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", src)))
+	defer span.End()
+	limit := p.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxImageSize
+	}
+	img, outcome, err := downloadImage(ctx, p.client, p.Policy, src, limit)
+	metrics.ObserveImageProxy(outcome)
+	span.SetAttributes(attribute.String("image.outcome", outcome))
+	return img, err
+}
+
+// downloadImage loads the image with the client, rejecting urls forbidden by the policy, images over limit bytes
+// and types other than proxyImageTypes. Outcome is the result reported to metrics: ok, forbidden, too_large,
+// not_image or error.
+func downloadImage(ctx context.Context, client *http.Client, policy *OutboundPolicy, src string,
+	limit int64) (img *ProxiedImage, outcome string, err error) {
+	if err = policy.CheckRequestURL(src); err != nil {
+		return nil, "forbidden", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, http.NoBody)
+	if err != nil {
+		return nil, "error", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenTarget) {
+			return nil, "forbidden", err
+		}
+		return nil, "error", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "error", fmt.Errorf("unexpected status %d from %s", resp.StatusCode, src)
+	}
+
+	if resp.ContentLength > limit {
+		return nil, "too_large", &ContentError{URL: src, Size: resp.ContentLength, Limit: limit, Err: ErrContentTooLarge}
+	}
+	br := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "error", err
+	}
+	contentType := proxyImageType(resp.Header.Get("Content-Type"), head)
+	if contentType == "" {
+		return nil, "not_image", &ContentError{URL: src, ContentType: resp.Header.Get("Content-Type"), Err: ErrUnsupportedContent}
+	}
+	data, err := readLimited(src, br, limit)
+	if err != nil {
+		if errors.Is(err, ErrContentTooLarge) {
+			return nil, "too_large", err
+		}
+		return nil, "error", err
+	}
+	return &ProxiedImage{Data: data, ContentType: contentType}, "ok", nil
+}
+
+// proxyImageType returns type of the image served to readers, by magic bytes, or by declared type if it can't be
+// sniffed, like avif. Empty if the type is not one of proxyImageTypes.
+func proxyImageType(contentType string, head []byte) string {
+	sniffed := mediaType(http.DetectContentType(head))
+	if slices.Contains(proxyImageTypes, sniffed) {
+		return sniffed
+	}
+	if declared := mediaType(contentType); sniffed == "application/octet-stream" && slices.Contains(proxyImageTypes, declared) {
+		return declared
+	}
+	return ""
+}
+
+// resizeImage scales jpeg or png image down to width keeping aspect ratio. Other types, narrower images and
+// images failed to decode are returned as is.
+func resizeImage(img *ProxiedImage, width int) *ProxiedImage {
+	if img.ContentType != "image/jpeg" && img.ContentType != "image/png" {
+		return img
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || cfg.Width <= width || cfg.Width*cfg.Height > maxResizePixels {
+		return img
+	}
+	orig, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		log.Printf("[WARN] can't decode image to resize, %v", err)
+		return img
+	}
+	height := max(1, cfg.Height*width/cfg.Width)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.BiLinear.Scale(dst, dst.Bounds(), orig, orig.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if img.ContentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		log.Printf("[WARN] can't encode resized image, %v", err)
+		return img
+	}
+	return &ProxiedImage{Data: buf.Bytes(), ContentType: img.ContentType}
+}
+
+// cached returns image from cache, moving it to the front of lru
+func (p *ImageProxy) cached(key string) (*ProxiedImage, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	el, ok := p.cache[key]
+	if !ok {
+		return nil, false
+	}
+	p.lru.MoveToFront(el)
+	return el.Value.(*cachedImage).img, true
+}
+
+// store puts image to cache, evicting least recently used images over CacheSize
+func (p *ImageProxy) store(key string, img *ProxiedImage) {
+	size := int64(len(img.Data))
+	if size > p.CacheSize {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cache[key]; ok {
+		return
+	}
+	p.cache[key] = p.lru.PushFront(&cachedImage{key: key, img: img})
+	p.used += size
+	for p.used > p.CacheSize {
+		el := p.lru.Back()
+		ci := p.lru.Remove(el).(*cachedImage)
+		delete(p.cache, ci.key)
+		p.used -= int64(len(ci.img.Data))
+	}
+}
+
+// rewrite replaces images of the response with proxied urls: src and srcset of images and picture sources
+// in rich content, the main image and all images
+func (p *ImageProxy) rewrite(rb *Response) {
+	rb.Image = p.URL(rb.Image)
+	for i, im := range rb.AllImages {
+		rb.AllImages[i] = p.URL(im)
+	}
+	if !strings.Contains(rb.Rich, "<img") && !strings.Contains(rb.Rich, "<source") {
+		return
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rb.Rich))
+	if err != nil {
+		log.Printf("[WARN] failed to parse content to proxy images, %v", err)
+		return
+	}
+	doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		s.SetAttr("src", p.URL(strings.TrimSpace(s.AttrOr("src", ""))))
+	})
+	doc.Find("img[srcset], picture source[srcset]").Each(func(_ int, s *goquery.Selection) {
+		var candidates []string
+		for _, c := range parseSrcset(s.AttrOr("srcset", "")) {
+			candidates = append(candidates, strings.TrimSpace(p.URL(c.url)+" "+c.descriptor))
+		}
+		s.SetAttr("srcset", strings.Join(candidates, ", "))
+	})
+	rich, err := doc.Find("body").Html()
+	if err != nil {
+		log.Printf("[WARN] failed to render content with proxied images, %v", err)
+		return
+	}
+	rb.Rich = rich
+}
@@ -0,0 +1,202 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageProxyURL(t *testing.T) {
+	p := &ImageProxy{BaseURL: "https://proxy.example.com/", Secret: []byte("secret")}
+	res := p.URL("https://example.com/a b.png?x=1&y=2")
+	assert.True(t, strings.HasPrefix(res, "https://proxy.example.com/img?u=https%3A%2F%2Fexample.com%2Fa+b.png%3Fx%3D1%26y%3D2&sig="), res)
+
+	u, err := url.Parse(res)
+	require.NoError(t, err)
+	assert.True(t, p.Verify(u.Query().Get("u"), u.Query().Get("sig")))
+	assert.False(t, p.Verify("https://example.com/other.png", u.Query().Get("sig")))
+	assert.False(t, p.Verify(u.Query().Get("u"), ""))
+	assert.False(t, (&ImageProxy{Secret: []byte("other")}).Verify(u.Query().Get("u"), u.Query().Get("sig")))
+
+	assert.Equal(t, "data:image/gif;base64,R0lGOD", p.URL("data:image/gif;base64,R0lGOD"))
+	assert.Empty(t, p.URL(""))
+}
+
+func TestImageProxyFetch(t *testing.T) {
+	var pngData bytes.Buffer
+	require.NoError(t, png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/pic.png":
+			_, _ = w.Write(pngData.Bytes())
+		case "/pic.avif":
+			w.Header().Set("Content-Type", "image/avif")
+			_, _ = w.Write([]byte("\x00\x00\x00\x1cftypavif"))
+		case "/pic.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+		case "/page.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("<html><body>not an image</body></html>"))
+		case "/slow.png":
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write(pngData.Bytes())
+		case "/big.png":
+			_, _ = w.Write(append(pngData.Bytes(), make([]byte, 2000)...))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	p := &ImageProxy{Secret: []byte("secret"), MaxSize: int64(pngData.Len()) + 1000, CacheSize: 1 << 20, Widths: []int{50, 400}}
+
+	t.Run("cached", func(t *testing.T) {
+		hits.Store(0)
+		for range 3 {
+			img, err := p.Fetch(context.Background(), ts.URL+"/pic.png", 0)
+			require.NoError(t, err)
+			assert.Equal(t, "image/png", img.ContentType)
+			assert.Equal(t, pngData.Bytes(), img.Data)
+		}
+		assert.Equal(t, int32(1), hits.Load())
+	})
+
+	t.Run("resized", func(t *testing.T) {
+		hits.Store(0)
+		img, err := p.Fetch(context.Background(), ts.URL+"/pic.png", 50)
+		require.NoError(t, err)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+		require.NoError(t, err)
+		assert.Equal(t, 50, cfg.Width)
+		assert.Equal(t, 25, cfg.Height)
+
+		img, err = p.Fetch(context.Background(), ts.URL+"/pic.png", 400)
+		require.NoError(t, err)
+		assert.Equal(t, pngData.Bytes(), img.Data, "narrower image is not resized")
+		assert.Equal(t, int32(0), hits.Load(), "resized from the cached original")
+
+		_, err = p.Fetch(context.Background(), ts.URL+"/pic.png", 100)
+		require.Error(t, err)
+	})
+
+	t.Run("avif by declared type", func(t *testing.T) {
+		img, err := p.Fetch(context.Background(), ts.URL+"/pic.avif", 50)
+		require.NoError(t, err)
+		assert.Equal(t, "image/avif", img.ContentType)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		for _, path := range []string{"/pic.svg", "/page.png"} {
+			_, err := p.Fetch(context.Background(), ts.URL+path, 0)
+			require.ErrorIs(t, err, ErrUnsupportedContent, path)
+		}
+		_, err := p.Fetch(context.Background(), ts.URL+"/big.png", 0)
+		require.ErrorIs(t, err, ErrContentTooLarge)
+		_, err = p.Fetch(context.Background(), ts.URL+"/missing.png", 0)
+		require.Error(t, err)
+
+		var ce *ContentError
+		assert.False(t, errors.As(err, &ce))
+	})
+
+	t.Run("shared fetch outlives canceled caller", func(t *testing.T) {
+		hits.Store(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			_, err := p.Fetch(ctx, ts.URL+"/slow.png", 0)
+			first <- err
+		}()
+		require.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond, "fetch started")
+		second := make(chan *ProxiedImage, 1)
+		go func() {
+			img, err := p.Fetch(context.Background(), ts.URL+"/slow.png", 0)
+			assert.NoError(t, err)
+			second <- img
+		}()
+		time.Sleep(10 * time.Millisecond) // second caller joins the fetch
+		cancel()
+		require.ErrorIs(t, <-first, context.Canceled)
+		img := <-second
+		require.NotNil(t, img)
+		assert.Equal(t, pngData.Bytes(), img.Data)
+		assert.Equal(t, int32(1), hits.Load(), "single fetch for both callers")
+	})
+
+	t.Run("forbidden by policy", func(t *testing.T) {
+		pp := &ImageProxy{Secret: []byte("secret"), Policy: &OutboundPolicy{}}
+		_, err := pp.Fetch(context.Background(), ts.URL+"/pic.png", 0)
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+}
+
+func TestImageProxyCacheEviction(t *testing.T) {
+	p := &ImageProxy{CacheSize: 10}
+	p.once.Do(p.init)
+	p.store("a", &ProxiedImage{Data: []byte("aaaa")})
+	p.store("b", &ProxiedImage{Data: []byte("bbbb")})
+	_, ok := p.cached("a") // moves a to the front, b is evicted next
+	assert.True(t, ok)
+	p.store("c", &ProxiedImage{Data: []byte("cccc")})
+	p.store("big", &ProxiedImage{Data: []byte("too big to be cached")})
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "big": false} {
+		_, ok = p.cached(key)
+		assert.Equal(t, want, ok, key)
+	}
+	assert.Equal(t, int64(8), p.used)
+}
+
+func TestExtractProxyImages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jpg") {
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write([]byte(strings.Repeat("x", 1000+len(r.URL.Path)*100))) // bb.jpg is the biggest
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>Pics</title></head><body><article>
+			<p>The article text is long enough, with commas, to be extracted, and it has images in it.</p>
+			<img src="/a.jpg" srcset="/a.jpg 1x, /a-2x.jpg 2x" alt="a">
+			<picture><source srcset="/bb.jpg" type="image/jpeg"><img src="/bb.jpg" alt="b"></picture>
+			</article></body></html>`))
+	}))
+	defer ts.Close()
+
+	proxy := &ImageProxy{BaseURL: "https://proxy.example.com", Secret: []byte("secret")}
+	lr := UReadability{TimeOut: 30 * time.Second, ImageProxy: proxy}
+
+	res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, res.Rich, `src="`+ts.URL+`/a.jpg"`, "not proxied without option")
+
+	res, err = lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{ProxyImages: true})
+	require.NoError(t, err)
+	assert.NotContains(t, res.Rich, `src="`+ts.URL)
+	assert.Contains(t, res.Rich, `src="`+strings.ReplaceAll(proxy.URL(ts.URL+"/a.jpg"), "&", "&amp;")+`"`)
+	assert.Contains(t, res.Rich, `srcset="`+strings.ReplaceAll(proxy.URL(ts.URL+"/a.jpg")+" 1x, "+
+		proxy.URL(ts.URL+"/a-2x.jpg")+" 2x", "&", "&amp;")+`"`)
+	assert.Contains(t, res.Rich, `<source srcset="`+strings.ReplaceAll(proxy.URL(ts.URL+"/bb.jpg"), "&", "&amp;")+`"`)
+	assert.Equal(t, proxy.URL(ts.URL+"/bb.jpg"), res.Image)
+	assert.Equal(t, []string{proxy.URL(ts.URL + "/a.jpg"), proxy.URL(ts.URL + "/bb.jpg")}, res.AllImages)
+
+	lr.ImageProxy = nil
+	res, err = lr.ExtractWithOptions(context.Background(), ts.URL+"/post", ExtractOptions{ProxyImages: true})
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/bb.jpg", res.Image, "ignored without configured proxy")
+}
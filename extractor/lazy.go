@@ -0,0 +1,178 @@
+package extractor
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+)
+
+// lazySrcAttrs are attributes lazy-loading scripts take the real url from, most common first.
+// Links of these attributes are normalized too, see linkAttrs.
+var lazySrcAttrs = []string{"data-src", "data-original", "data-lazy-src", "data-lazy", "data-echo"}
+
+// lazySrcsetAttrs are attributes lazy-loading scripts take the real srcset from, see srcsetAttrs
+var lazySrcsetAttrs = []string{"data-srcset", "data-lazy-srcset", "data-original-set"}
+
+// rePlaceholder matches file names of transparent 1x1 and spacer gifs shown until the real image is loaded
+var rePlaceholder = regexp.MustCompile(`(?i)(^|[_.-])(blank|spacer|pixel|transparent|clear|1x1)\.gif$`)
+
+// parsePage parses page body, the document is used for page metadata and to resolve lazy-loaded media with
+// resolveLazyMedia. Returns the document and the body, rendered from the document if any media was resolved.
+func parsePage(body string) (*goquery.Document, string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil, body, err
+	}
+	if resolveLazyMedia(doc) == 0 {
+		return doc, body, nil
+	}
+	res, err := doc.Html()
+	if err != nil {
+		log.Printf("[WARN] failed to render page with resolved media, %v", err)
+		return doc, body, nil
+	}
+	return doc, res, nil
+}
+
+// resolveLazyMedia replaces lazy-loading placeholders of the page with real media, so extracted content and
+// images don't end up with blank pictures. Images get src from lazy-loading attributes, the best srcset candidate
+// or <picture> sources, and images in <noscript> fallbacks replace placeholders next to them.
+// Returns number of resolved elements.
+func resolveLazyMedia(doc *goquery.Document) (resolved int) {
+	doc.Find("body noscript").Each(func(_ int, s *goquery.Selection) {
+		if resolveNoscript(s) {
+			resolved++
+		}
+	})
+	doc.Find("img, video, audio, source, iframe").Each(func(_ int, s *goquery.Selection) {
+		if resolveLazyElement(s) {
+			resolved++
+		}
+	})
+	if resolved > 0 {
+		log.Printf("[DEBUG] resolved %d lazy-loaded media", resolved)
+	}
+	return resolved
+}
+
+// resolveNoscript unwraps <noscript> fallback with images only, removing lazy-loaded placeholder image before it.
+// Scripting is enabled in the parser, so noscript content is a raw text.
+func resolveNoscript(s *goquery.Selection) bool {
+	inner, err := goquery.NewDocumentFromReader(strings.NewReader(s.Text()))
+	if err != nil {
+		return false
+	}
+	body := inner.Find("body")
+	imgs := body.Find("img")
+	if imgs.Length() == 0 || body.Find("*").Not("img, picture, source, a, span, div, figure").Length() > 0 {
+		return false
+	}
+	html, err := body.Html()
+	if err != nil {
+		return false
+	}
+	// placeholder before the fallback is replaced by the fallback, which has the real image
+	if prev := s.Prev(); prev.Is("img") && (!hasRealSrc(prev) || firstAttr(prev, lazySrcAttrs) != "" ||
+		firstAttr(prev, lazySrcsetAttrs) != "") {
+		prev.Remove()
+	}
+	s.ReplaceWithHtml(html)
+	return true
+}
+
+// resolveLazyElement sets src of media element from lazy-loading attributes, srcset or picture sources.
+// Returns true if the element is changed.
+func resolveLazyElement(s *goquery.Selection) bool {
+	changed := false
+	if srcset := strings.TrimSpace(firstAttr(s, lazySrcsetAttrs)); srcset != "" && strings.TrimSpace(s.AttrOr("srcset", "")) == "" {
+		s.SetAttr("srcset", srcset)
+		changed = true
+	}
+	if poster := strings.TrimSpace(s.AttrOr("data-poster", "")); poster != "" && s.Is("video") {
+		s.SetAttr("poster", poster)
+		changed = true
+	}
+	if s.Is("source") {
+		if src := strings.TrimSpace(firstAttr(s, lazySrcAttrs)); src != "" && !s.Parent().Is("picture") {
+			s.SetAttr("src", src)
+			changed = true
+		}
+		return changed
+	}
+
+	src := strings.TrimSpace(firstAttr(s, lazySrcAttrs))
+	if src == "" && s.Is("img") && !hasRealSrc(s) {
+		src = bestSrcsetURL(s.AttrOr("srcset", ""))
+		if src == "" && s.Parent().Is("picture") {
+			s.Parent().Find("source").EachWithBreak(func(_ int, source *goquery.Selection) bool {
+				src = bestSrcsetURL(firstNonEmpty(source.AttrOr("srcset", ""), firstAttr(source, lazySrcsetAttrs)))
+				return src == ""
+			})
+		}
+	}
+	if src == "" || isPlaceholder(src) || src == s.AttrOr("src", "") {
+		return changed
+	}
+	s.SetAttr("src", src)
+	return true
+}
+
+// hasRealSrc checks if the element has src which is not a placeholder
+func hasRealSrc(s *goquery.Selection) bool {
+	src := strings.TrimSpace(s.AttrOr("src", ""))
+	return src != "" && !isPlaceholder(src)
+}
+
+// isPlaceholder checks if the image url is an inline image, a blank page or a spacer gif
+func isPlaceholder(src string) bool {
+	if strings.HasPrefix(strings.ToLower(src), "data:") || strings.HasPrefix(src, "#") || strings.HasPrefix(src, "about:") {
+		return true
+	}
+	name := src
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	return rePlaceholder.MatchString(path.Base(name))
+}
+
+// bestSrcsetURL returns url of the biggest srcset candidate, by width or pixel density, candidates without
+// descriptor are 1x
+func bestSrcsetURL(srcset string) string {
+	best, bestSize := "", -1.0
+	for _, c := range parseSrcset(srcset) {
+		size := 1.0
+		if d := strings.ToLower(c.descriptor); len(d) > 1 && (strings.HasSuffix(d, "w") || strings.HasSuffix(d, "x")) {
+			if v, err := strconv.ParseFloat(d[:len(d)-1], 64); err == nil {
+				size = v
+			}
+		}
+		if size > bestSize && !isPlaceholder(c.url) {
+			best, bestSize = c.url, size
+		}
+	}
+	return best
+}
+
+// firstAttr returns value of the first of attributes set on the element
+func firstAttr(s *goquery.Selection, attrs []string) string {
+	for _, a := range attrs {
+		if v, ok := s.Attr(a); ok && strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// firstNonEmpty returns the first not empty string
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLazyMedia(t *testing.T) {
+	tbl := []struct {
+		name, inp string
+		want      []string // expected elements after resolving, rendered
+	}{
+		{name: "data-src", inp: `<img src="/img/placeholder.gif" data-src="/img/real.jpg" alt="a">`,
+			want: []string{`<img src="/img/real.jpg" data-src="/img/real.jpg" alt="a"/>`}},
+		{name: "data-original without src", inp: `<img data-original="real.jpg">`,
+			want: []string{`<img data-original="real.jpg" src="real.jpg"/>`}},
+		{name: "data-lazy-src over data uri", inp: `<img src="data:image/gif;base64,R0lGOD" data-lazy-src="real.jpg">`,
+			want: []string{`<img src="real.jpg" data-lazy-src="real.jpg"/>`}},
+		{name: "data-srcset", inp: `<img src="blank.gif" data-srcset="small.jpg 300w, big.jpg 1200w, mid.jpg 600w">`,
+			want: []string{`<img src="big.jpg" data-srcset="small.jpg 300w, big.jpg 1200w, mid.jpg 600w" ` +
+				`srcset="small.jpg 300w, big.jpg 1200w, mid.jpg 600w"/>`}},
+		{name: "srcset density", inp: `<img srcset="a.jpg, b.jpg 2x">`, want: []string{`<img srcset="a.jpg, b.jpg 2x" src="b.jpg"/>`}},
+		{name: "real src kept", inp: `<img src="/photo.jpg" srcset="/photo-2x.jpg 2x">`,
+			want: []string{`<img src="/photo.jpg" srcset="/photo-2x.jpg 2x">`}},
+		{name: "picture source", inp: `<picture><source data-srcset="p.webp 1x, p2.webp 2x" type="image/webp"><img alt="p"></picture>`,
+			want: []string{`<source data-srcset="p.webp 1x, p2.webp 2x" type="image/webp" srcset="p.webp 1x, p2.webp 2x"/>`,
+				`<img alt="p" src="p2.webp"/>`}},
+		{name: "noscript fallback", inp: `<p><img src="/img/spacer.gif" class="lazy"><noscript><img src="/real.jpg" alt="r"></noscript></p>`,
+			want: []string{`<p><img src="/real.jpg" alt="r"/></p>`}},
+		{name: "noscript without images", inp: `<p><img src="/a.jpg"><noscript><p>enable js</p></noscript></p>`,
+			want: []string{`<img src="/a.jpg">`, `<noscript>`}},
+		{name: "lazy iframe and video", inp: `<iframe src="about:blank" data-src="https://www.youtube.com/embed/x"></iframe>` +
+			`<video data-poster="p.jpg"><source data-src="v.mp4"></video>`,
+			want: []string{`<iframe src="https://www.youtube.com/embed/x" data-src="https://www.youtube.com/embed/x"></iframe>`,
+				`<video data-poster="p.jpg" poster="p.jpg"><source data-src="v.mp4" src="v.mp4"/></video>`}},
+		{name: "placeholder in lazy attribute", inp: `<img src="/a.jpg" data-src="/img/spacer.gif">`, want: []string{`<img src="/a.jpg" `}},
+		{name: "image named like placeholder kept", inp: `<img src="/img/loading-screen.png" srcset="/img/loading-screen-2x.png 2x">` +
+			`<img src="/transparent-logo.png"><noscript><img src="/logo.jpg"></noscript>`,
+			want: []string{`<img src="/img/loading-screen.png" srcset="/img/loading-screen-2x.png 2x"/>`,
+				`<img src="/transparent-logo.png"/><img src="/logo.jpg"/>`}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			_, res, err := parsePage("<html><body>" + tt.inp + "</body></html>")
+			require.NoError(t, err)
+			for _, w := range tt.want {
+				assert.Contains(t, res, w)
+			}
+		})
+	}
+
+	page := "<html><body><p>no lazy images <img src=/a.jpg></p></body></html>"
+	doc, res, err := parsePage(page)
+	require.NoError(t, err)
+	assert.Equal(t, page, res, "page without lazy media is not re-rendered")
+	assert.Equal(t, 1, doc.Find("img").Length())
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	for _, src := range []string{"data:image/gif;base64,R0lGOD", "/img/blank.gif", "spacer.GIF?v=1", "/img/site-pixel.gif",
+		"https://cdn.example.com/1x1.gif", "about:blank", "/assets/transparent.gif#x"} {
+		assert.True(t, isPlaceholder(src), src)
+	}
+	for _, src := range []string{"/img/photo.jpg", "/lazyriver.jpg", "/blanket.png", "https://example.com/pixelart-cat.png",
+		"/img/loading.gif", "/lazy-placeholder.svg", "grey.jpg", "/spacer.png", "/transparent-logo.png", "/blank.gif.jpg"} {
+		assert.False(t, isPlaceholder(src), src)
+	}
+}
+
+func TestExtractLazyImages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/img/blank.gif":
+			w.Header().Set("Content-Type", "image/gif")
+			_, _ = w.Write([]byte("GIF89a"))
+		case "/img/small.jpg", "/img/big.jpg", "/img/fallback.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			size := map[string]int{"/img/small.jpg": 1000, "/img/big.jpg": 5000, "/img/fallback.jpg": 3000}[r.URL.Path]
+			_, _ = w.Write([]byte(strings.Repeat("x", size)))
+		default:
+			_, _ = w.Write([]byte(`<html><head><title>Lazy</title></head><body><article>
+				<p>The article text is long enough, with commas, to be extracted, and it has lazy images in it.</p>
+				<img src="/img/blank.gif" data-src="/img/small.jpg">
+				<p>The second paragraph, with more commas, so the images stay in the article content.</p>
+				<img src="/img/blank.gif" data-srcset="/img/small.jpg 400w, /img/big.jpg 1600w">
+				<img src="/img/blank.gif"><noscript><img src="/img/fallback.jpg"></noscript>
+				</article></body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	res, err := lr.Extract(context.Background(), ts.URL+"/post")
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/img/big.jpg", res.Image)
+	assert.Equal(t, []string{ts.URL + "/img/big.jpg", ts.URL + "/img/fallback.jpg", ts.URL + "/img/small.jpg"}, res.AllImages)
+	assert.NotContains(t, res.Rich, "blank.gif")
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(res.Rich))
+	require.NoError(t, err)
+	assert.Equal(t, 3, doc.Find("img").Length())
+}
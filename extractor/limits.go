@@ -0,0 +1,120 @@
+package extractor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// DefaultMaxBodySize is the page size limit used when retriever's MaxBodySize is not set
+	DefaultMaxBodySize = 10 << 20
+	// DefaultMaxImageSize is the image size limit used when UReadability's MaxImageSize is not set
+	DefaultMaxImageSize = 20 << 20
+	sniffLen            = 512 // bytes used by http.DetectContentType
+)
+
+// DefaultContentTypes lists page content types accepted by HTTPRetriever when AllowedTypes is not set
+var DefaultContentTypes = []string{"text/html", "application/xhtml+xml", "text/plain", "text/xml", "application/xml",
+	PDFContentType}
+
+var (
+	// ErrContentTooLarge reported when response body exceeds the size limit
+	ErrContentTooLarge = errors.New("content too large")
+	// ErrUnsupportedContent reported when response content type is not accepted
+	ErrUnsupportedContent = errors.New("unsupported content type")
+)
+
+// ContentError describes a response rejected because of its size or type, wraps ErrContentTooLarge or ErrUnsupportedContent
+type ContentError struct {
+	URL         string
+	ContentType string // declared or sniffed content type
+	Size        int64  // declared or already read size, 0 if unknown
+	Limit       int64  // size limit, set for ErrContentTooLarge
+	Err         error
+}
+
+func (e *ContentError) Error() string {
+	if errors.Is(e.Err, ErrContentTooLarge) {
+		return fmt.Sprintf("%v: %s is over %d bytes", e.Err, e.URL, e.Limit)
+	}
+	return fmt.Sprintf("%v: %s is %q", e.Err, e.URL, e.ContentType)
+}
+
+func (e *ContentError) Unwrap() error { return e.Err }
+
+// binaryTypes are sniffed types never processed as a page, even if declared as html
+var binaryTypes = []string{"image/", "audio/", "video/", "font/", "application/octet-stream", "application/pdf",
+	"application/zip", "application/x-gzip", "application/x-rar-compressed", "application/wasm", "application/ogg",
+	"application/postscript", "application/vnd.ms-fontobject"}
+
+// mediaType returns lowercased media type from Content-Type header value, empty if not set or broken
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mt)
+}
+
+// checkDeclaredType rejects response early by declared Content-Type, empty or malformed type passes
+// and is sniffed later, as many servers send broken headers for regular pages
+func checkDeclaredType(reqURL string, header http.Header, allowed []string) error {
+	ct := header.Get("Content-Type")
+	if mt := mediaType(ct); mt != "" && !slices.Contains(allowed, mt) {
+		return &ContentError{URL: reqURL, ContentType: ct, Err: ErrUnsupportedContent}
+	}
+	return nil
+}
+
+// checkSniffedType verifies content by magic bytes. binary content is rejected regardless of declared type,
+// content without declared type, or with malformed one, must sniff as one of allowed types.
+func checkSniffedType(reqURL string, header http.Header, head []byte, allowed []string) error {
+	sniffed := http.DetectContentType(head)
+	for _, prefix := range binaryTypes {
+		if strings.HasPrefix(sniffed, prefix) && !slices.Contains(allowed, mediaType(sniffed)) {
+			return &ContentError{URL: reqURL, ContentType: sniffed, Err: ErrUnsupportedContent}
+		}
+	}
+	if mediaType(header.Get("Content-Type")) == "" && !slices.Contains(allowed, mediaType(sniffed)) {
+		return &ContentError{URL: reqURL, ContentType: sniffed, Err: ErrUnsupportedContent}
+	}
+	return nil
+}
+
+// readLimited reads the whole body if it fits into limit, otherwise returns ContentError with ErrContentTooLarge
+func readLimited(reqURL string, r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &ContentError{URL: reqURL, Size: int64(len(data)), Limit: limit, Err: ErrContentTooLarge}
+	}
+	return data, nil
+}
+
+// readPage reads response body enforcing size limit and content type, rejecting as early as possible:
+// by declared Content-Length and Content-Type first, then by sniffed magic bytes and actual size.
+func readPage(reqURL string, resp *http.Response, limit int64, allowed []string) ([]byte, error) {
+	if resp.ContentLength > limit {
+		return nil, &ContentError{URL: reqURL, Size: resp.ContentLength, Limit: limit, Err: ErrContentTooLarge}
+	}
+	if err := checkDeclaredType(reqURL, resp.Header, allowed); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err = checkSniffedType(reqURL, resp.Header, head, allowed); err != nil {
+		return nil, err
+	}
+	return readLimited(reqURL, br, limit)
+}
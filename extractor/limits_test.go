@@ -0,0 +1,131 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPRetriever_Limits(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html><body>" + strings.Repeat("a", 100) + "</body></html>"))
+		case "/big-declared":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", strconv.Itoa(10000))
+			_, _ = w.Write([]byte(strings.Repeat("a", 10000)))
+		case "/big-chunked":
+			w.Header().Set("Content-Type", "text/html")
+			for range 10 {
+				_, _ = w.Write([]byte(strings.Repeat("a", 1000)))
+				w.(http.Flusher).Flush() // forces chunked encoding without Content-Length
+			}
+		case "/zip":
+			w.Header().Set("Content-Type", "application/zip")
+			_, _ = w.Write([]byte("PK\x03\x04"))
+		case "/png-as-html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(pngHeader))
+		case "/no-type":
+			w.Header()["Content-Type"] = nil // disables automatic sniffing by the server
+			_, _ = w.Write([]byte("<!DOCTYPE html><html><body>hi</body></html>"))
+		case "/no-type-binary":
+			w.Header()["Content-Type"] = nil
+			_, _ = w.Write([]byte(pngHeader))
+		case "/malformed-type":
+			w.Header().Set("Content-Type", "text/html;; charset")
+			_, _ = w.Write([]byte("<!DOCTYPE html><html><body>hi</body></html>"))
+		case "/malformed-type-binary":
+			w.Header().Set("Content-Type", "text/html;; charset")
+			_, _ = w.Write([]byte(pngHeader))
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{name: "html within limit", path: "/html"},
+		{name: "declared length over limit", path: "/big-declared", wantErr: ErrContentTooLarge},
+		{name: "streamed body over limit", path: "/big-chunked", wantErr: ErrContentTooLarge},
+		{name: "declared unsupported type", path: "/zip", wantErr: ErrUnsupportedContent},
+		{name: "binary declared as html", path: "/png-as-html", wantErr: ErrUnsupportedContent},
+		{name: "missing type sniffed as html", path: "/no-type"},
+		{name: "missing type sniffed as image", path: "/no-type-binary", wantErr: ErrUnsupportedContent},
+		{name: "malformed type sniffed as html", path: "/malformed-type"},
+		{name: "malformed type sniffed as image", path: "/malformed-type-binary", wantErr: ErrUnsupportedContent},
+	}
+
+	retriever := &HTTPRetriever{MaxBodySize: 5000}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := retriever.Retrieve(context.Background(), ts.URL+tt.path)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				assert.NotEmpty(t, res.Body)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+			var ce *ContentError
+			require.ErrorAs(t, err, &ce)
+			assert.Equal(t, ts.URL+tt.path, ce.URL)
+		})
+	}
+
+	t.Run("custom allowed types", func(t *testing.T) {
+		r := &HTTPRetriever{AllowedTypes: []string{"application/zip"}}
+		_, err := r.Retrieve(context.Background(), ts.URL+"/zip")
+		require.NoError(t, err)
+		_, err = r.Retrieve(context.Background(), ts.URL+"/html")
+		require.ErrorIs(t, err, ErrUnsupportedContent)
+	})
+}
+
+func TestContentError(t *testing.T) {
+	err := error(&ContentError{URL: "http://example.com/f", Size: 20, Limit: 10, Err: ErrContentTooLarge})
+	assert.Equal(t, "content too large: http://example.com/f is over 10 bytes", err.Error())
+	assert.True(t, errors.Is(err, ErrContentTooLarge))
+
+	err = &ContentError{URL: "http://example.com/f", ContentType: "application/zip", Err: ErrUnsupportedContent}
+	assert.Equal(t, `unsupported content type: http://example.com/f is "application/zip"`, err.Error())
+	assert.True(t, errors.Is(err, ErrUnsupportedContent))
+}
+
+func TestGetImageSizeLimits(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 2000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte(png[:500]))
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte(png))
+		case "/octet":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte(png[:600]))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>not an image</html>"))
+		}
+	}))
+	defer ts.Close()
+
+	lr := UReadability{MaxImageSize: 1000}
+	assert.Equal(t, 500, lr.getImageSize(context.Background(), ts.URL+"/small.png"))
+	assert.Equal(t, 600, lr.getImageSize(context.Background(), ts.URL+"/octet"), "generic binary type sniffed as image")
+	assert.Zero(t, lr.getImageSize(context.Background(), ts.URL+"/big.png"), "over the limit")
+	assert.Zero(t, lr.getImageSize(context.Background(), ts.URL+"/page"), "not an image")
+}
@@ -0,0 +1,148 @@
+package extractor
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+)
+
+// Anchor is a link of the article with its text
+type Anchor struct {
+	URL  string `json:"url"`
+	Text string `json:"text"`
+	Rel  string `json:"rel,omitempty"`
+}
+
+// linkAttrs are attributes with a single url, including lazy-loading ones
+var linkAttrs = append([]string{"href", "src", "action", "background", "poster", "data-poster", "cite", "data",
+	"data-href"}, lazySrcAttrs...)
+
+// srcsetAttrs are attributes with a list of image candidates, like "a.jpg 1x, b.jpg 2x", including lazy-loading ones
+var srcsetAttrs = append([]string{"srcset"}, lazySrcsetAttrs...)
+
+// documentBase returns the url relative links of the page are resolved against, set by <base href> or the page url
+func documentBase(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return pageURL
+	}
+	base, err := pageURL.Parse(strings.TrimSpace(href))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return pageURL
+	}
+	return base
+}
+
+// normalizeLinks makes all links of rich html absolute, resolving them against base url. Returns updated html,
+// all found links without duplicates and anchors with their text and rel.
+func (f *UReadability) normalizeLinks(data string, baseURL *url.URL) (result string, links []string, anchors []Anchor) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(data))
+	if err != nil {
+		log.Printf("[WARN] failed to parse content for links, %v", err)
+		return data, nil, nil
+	}
+
+	seen := map[string]bool{}
+	addLink := func(link string) {
+		if link != "" && !seen[link] && !strings.HasPrefix(strings.ToLower(link), "data:") {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	absolute := func(link string) string {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			return link
+		}
+		if r, e := baseURL.Parse(link); e == nil {
+			return r.String()
+		}
+		return link
+	}
+
+	normalized := 0
+	doc.Find("body *").Each(func(_ int, s *goquery.Selection) {
+		for _, node := range s.Nodes {
+			for i, a := range node.Attr {
+				var val string
+				switch {
+				case slices.Contains(linkAttrs, a.Key):
+					val = absolute(a.Val)
+					addLink(val)
+				case slices.Contains(srcsetAttrs, a.Key):
+					var candidates []string
+					for _, c := range parseSrcset(a.Val) {
+						c.url = absolute(c.url)
+						addLink(c.url)
+						candidates = append(candidates, strings.TrimSpace(c.url+" "+c.descriptor))
+					}
+					val = strings.Join(candidates, ", ")
+				default:
+					continue
+				}
+				if val != a.Val {
+					node.Attr[i].Val = val
+					normalized++
+				}
+			}
+		}
+	})
+
+	doc.Find("body a[href]").Each(func(_ int, s *goquery.Selection) {
+		href := s.AttrOr("href", "")
+		if href == "" || strings.HasPrefix(href, "javascript:") {
+			return
+		}
+		anchors = append(anchors, Anchor{URL: href, Text: strings.Join(strings.Fields(s.Text()), " "),
+			Rel: strings.Join(strings.Fields(s.AttrOr("rel", "")), " ")})
+	})
+
+	if result, err = doc.Find("body").Html(); err != nil {
+		log.Printf("[WARN] failed to render content with links, %v", err)
+		return data, links, anchors
+	}
+	log.Printf("[DEBUG] normalized %d links", normalized)
+	return result, links, anchors
+}
+
+// srcsetCandidate is an image candidate of srcset attribute
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset splits srcset attribute into candidates. Urls may contain commas, so candidates are split on commas
+// after descriptors, as the HTML spec does.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var res []srcsetCandidate
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return res
+		}
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end < 0 {
+			end = len(rest)
+		}
+		c := srcsetCandidate{url: rest[:end]}
+		rest = rest[end:]
+		if trimmed := strings.TrimRight(c.url, ","); trimmed != c.url {
+			// url followed by comma has no descriptors
+			c.url = trimmed
+		} else {
+			descEnd := strings.IndexByte(rest, ',')
+			if descEnd < 0 {
+				descEnd = len(rest)
+			}
+			c.descriptor = strings.Join(strings.Fields(rest[:descEnd]), " ")
+			rest = rest[descEnd:]
+		}
+		if c.url != "" {
+			res = append(res, c)
+		}
+	}
+}
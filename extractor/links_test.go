@@ -0,0 +1,102 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLinksAttributes(t *testing.T) {
+	lr := UReadability{}
+	base, err := url.Parse("https://example.com/blog/post/")
+	require.NoError(t, err)
+
+	inp := `<p><a href='/single'>single quoted</a> <a href=unquoted rel="nofollow  ugc">  unquoted
+		link </a> <a href="/x">x</a> <a href="/x/y">prefix</a> <a href="javascript:void(0)">js</a> <a href="#top">top</a></p>
+		<img src="data:image/gif;base64,R0lGOD" data-src="../lazy.jpg" data-srcset="a.jpg 1x, /b.jpg 2x">
+		<picture><source srcset="small.webp 480w,  https://cdn.example.com/large.webp 1024w" type="image/webp"></picture>
+		<video poster="poster.png"><source src="/clip.mp4"></video><blockquote cite="quote.html">q</blockquote>`
+	out, links, anchors := lr.normalizeLinks(inp, base)
+
+	for _, s := range []string{
+		`<a href="https://example.com/single">single quoted</a>`,
+		`<a href="https://example.com/blog/post/unquoted" rel="nofollow  ugc">`,
+		`<a href="https://example.com/x">x</a> <a href="https://example.com/x/y">prefix</a>`,
+		`<a href="https://example.com/blog/post/#top">top</a>`,
+		`src="data:image/gif;base64,R0lGOD" data-src="https://example.com/blog/lazy.jpg"`,
+		`data-srcset="https://example.com/blog/post/a.jpg 1x, https://example.com/b.jpg 2x"`,
+		`srcset="https://example.com/blog/post/small.webp 480w, https://cdn.example.com/large.webp 1024w"`,
+		`poster="https://example.com/blog/post/poster.png"`,
+		`<source src="https://example.com/clip.mp4"/>`,
+		`cite="https://example.com/blog/post/quote.html"`,
+	} {
+		assert.Contains(t, out, s)
+	}
+
+	assert.Equal(t, []string{"https://example.com/single", "https://example.com/blog/post/unquoted", "https://example.com/x",
+		"https://example.com/x/y", "javascript:void(0)", "https://example.com/blog/post/#top", "https://example.com/blog/lazy.jpg",
+		"https://example.com/blog/post/a.jpg", "https://example.com/b.jpg", "https://example.com/blog/post/small.webp",
+		"https://cdn.example.com/large.webp", "https://example.com/blog/post/poster.png", "https://example.com/clip.mp4",
+		"https://example.com/blog/post/quote.html"}, links, "data uri is skipped")
+
+	assert.Equal(t, []Anchor{
+		{URL: "https://example.com/single", Text: "single quoted"},
+		{URL: "https://example.com/blog/post/unquoted", Text: "unquoted link", Rel: "nofollow ugc"},
+		{URL: "https://example.com/x", Text: "x"},
+		{URL: "https://example.com/x/y", Text: "prefix"},
+		{URL: "https://example.com/blog/post/#top", Text: "top"},
+	}, anchors)
+}
+
+func TestDocumentBase(t *testing.T) {
+	page, err := url.Parse("https://example.com/a/b.html")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		html, base string
+	}{
+		{`<html><head></head><body></body></html>`, "https://example.com/a/b.html"},
+		{`<html><head><base href="/static/"></head></html>`, "https://example.com/static/"},
+		{`<html><head><base href="https://cdn.example.com/x/"></head></html>`, "https://cdn.example.com/x/"},
+		{`<html><head><base target="_blank"><base href="javascript:alert(1)"></head></html>`, "https://example.com/a/b.html"},
+		{`<html><head><base href=" "></head></html>`, "https://example.com/a/b.html"},
+	}
+	for _, tt := range tbl {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		require.NoError(t, err)
+		assert.Equal(t, tt.base, documentBase(doc, page).String(), tt.html)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	assert.Equal(t, []srcsetCandidate{{url: "a.jpg", descriptor: "1x"}, {url: "b.jpg", descriptor: "2x"}},
+		parseSrcset("a.jpg 1x,b.jpg   2x"))
+	assert.Equal(t, []srcsetCandidate{{url: "a.jpg"}, {url: "b,c.jpg", descriptor: "100w"}},
+		parseSrcset(" a.jpg, b,c.jpg 100w ,"))
+	assert.Empty(t, parseSrcset(" , "))
+}
+
+func TestExtractLinksWithBase(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>Post</title><base href="/static/"></head><body><article>
+			<p>The article text is long enough, with commas, to be extracted, and it links <a href='docs/a.html'
+			rel=author>the docs</a> somewhere.</p><img src=pic.png srcset="pic-2x.png 2x"></article></body></html>`))
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	res, err := lr.Extract(context.Background(), ts.URL+"/post/1")
+	require.NoError(t, err)
+	assert.Contains(t, res.Rich, `<a href="`+ts.URL+`/static/docs/a.html">the docs</a>`)
+	assert.Contains(t, res.Rich, `srcset="`+ts.URL+`/static/pic-2x.png 2x"`)
+	assert.Equal(t, []Anchor{{URL: ts.URL + "/static/docs/a.html", Text: "the docs", Rel: "author"}}, res.Anchors)
+	assert.Equal(t, []string{ts.URL + "/static/docs/a.html", ts.URL + "/static/pic.png", ts.URL + "/static/pic-2x.png"}, res.AllLinks)
+}
@@ -0,0 +1,142 @@
+package extractor
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// metaSelectors lists sources of page metadata for each key of Response.Metadata, most reliable first.
+// Meta tags are read from content attribute, other elements from datetime attribute or text.
+var metaSelectors = map[string][]string{
+	"author": {`meta[name="author"]`, `meta[property="article:author"]`, `meta[name="parsely-author"]`,
+		`meta[name="sailthru.author"]`, `meta[name="dc.creator" i]`, `[itemprop="author"] [itemprop="name"]`,
+		`[itemprop="author"]`, `a[rel="author"]`},
+	"published": {`meta[property="article:published_time"]`, `meta[name="parsely-pub-date"]`,
+		`meta[itemprop="datePublished"]`, `meta[name="date"]`, `meta[name="pubdate"]`, `meta[name="dc.date" i]`,
+		`time[itemprop="datePublished"]`, `time[pubdate]`},
+	"modified": {`meta[property="article:modified_time"]`, `meta[property="og:updated_time"]`,
+		`meta[itemprop="dateModified"]`, `time[itemprop="dateModified"]`},
+}
+
+// ldMetaKeys maps JSON-LD properties to keys of Response.Metadata
+var ldMetaKeys = map[string]string{"author": "author", "datePublished": "published", "dateModified": "modified"}
+
+// metaDateLayouts are date formats of metadata, normalized to RFC 3339
+var metaDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02T15:04",
+	"2006-01-02 15:04:05", "2006-01-02", time.RFC1123Z, time.RFC1123}
+
+// pageMetadata returns author and publication dates of the page from meta tags, JSON-LD and microdata.
+// Dates are normalized to RFC 3339 if they can be parsed. Returns nil if nothing found.
+func pageMetadata(doc *goquery.Document) map[string]string {
+	res := map[string]string{}
+	ld := jsonLDMetadata(doc)
+	for key, selectors := range metaSelectors {
+		for _, sel := range selectors {
+			if v := metaValue(doc.Find(sel).First()); v != "" {
+				res[key] = v
+				break
+			}
+		}
+		if res[key] == "" && ld[key] != "" {
+			res[key] = ld[key]
+		}
+		if res[key] == "" {
+			delete(res, key)
+		}
+	}
+	for _, key := range []string{"published", "modified"} {
+		if t, ok := parseMetaDate(res[key]); ok {
+			res[key] = t.Format(time.RFC3339)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// metaValue returns value of meta tag or element, author urls like https://example.com/author/john are skipped
+func metaValue(s *goquery.Selection) string {
+	if s.Length() == 0 {
+		return ""
+	}
+	var v string
+	switch {
+	case s.Is("meta"):
+		v = s.AttrOr("content", "")
+	case s.Is("time"):
+		v = s.AttrOr("datetime", s.Text())
+	default:
+		v = s.Text()
+	}
+	v = strings.Join(strings.Fields(v), " ")
+	if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") || len(v) > 200 {
+		return ""
+	}
+	return v
+}
+
+// jsonLDMetadata returns author and dates from JSON-LD scripts of the page, taking the first object with them,
+// including objects of @graph
+func jsonLDMetadata(doc *goquery.Document) map[string]string {
+	res := map[string]string{}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var data any
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return
+		}
+		walkJSONLD(data, res, 0)
+	})
+	return res
+}
+
+func walkJSONLD(data any, res map[string]string, depth int) {
+	if depth > 3 {
+		return
+	}
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			walkJSONLD(item, res, depth+1)
+		}
+	case map[string]any:
+		for prop, key := range ldMetaKeys {
+			if res[key] == "" {
+				res[key] = ldString(v[prop])
+			}
+		}
+		walkJSONLD(v["@graph"], res, depth+1)
+	}
+}
+
+// ldString returns JSON-LD value as a string, names of authors joined with comma
+func ldString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return strings.TrimSpace(val)
+	case map[string]any:
+		return ldString(val["name"])
+	case []any:
+		var names []string
+		for _, item := range val {
+			if s := ldString(item); s != "" {
+				names = append(names, s)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// parseMetaDate parses date of metadata in one of common formats
+func parseMetaDate(s string) (time.Time, bool) {
+	for _, layout := range metaDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
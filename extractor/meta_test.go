@@ -0,0 +1,45 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageMetadata(t *testing.T) {
+	tbl := []struct {
+		name, head, body string
+		want             map[string]string
+	}{
+		{name: "meta tags", head: `<meta name="author" content=" John  Doe "><meta property="article:author" content="https://example.com/john">` +
+			`<meta property="article:published_time" content="2024-03-05T10:20:30+02:00">` +
+			`<meta property="article:modified_time" content="2024-03-06">`,
+			want: map[string]string{"author": "John Doe", "published": "2024-03-05T10:20:30+02:00", "modified": "2024-03-06T00:00:00Z"}},
+		{name: "author url skipped", head: `<meta property="article:author" content="https://example.com/john">` +
+			`<meta name="date" content="not a date">`,
+			want: map[string]string{"published": "not a date"}},
+		{name: "json-ld graph", head: `<script type="application/ld+json">{"@context":"https://schema.org","@graph":[` +
+			`{"@type":"WebPage"},{"@type":"NewsArticle","datePublished":"2023-01-02T03:04:05Z",` +
+			`"author":[{"@type":"Person","name":"Ann"},{"@type":"Person","name":"Bob"}]}]}</script>`,
+			want: map[string]string{"author": "Ann, Bob", "published": "2023-01-02T03:04:05Z"}},
+		{name: "microdata", body: `<article><span itemprop="author" itemscope><span itemprop="name">Jane Roe</span></span>` +
+			`<time itemprop="datePublished" datetime="2022-12-31">Dec 31</time></article>`,
+			want: map[string]string{"author": "Jane Roe", "published": "2022-12-31T00:00:00Z"}},
+		{name: "meta over json-ld", head: `<meta name="author" content="Meta Author">` +
+			`<script type="application/ld+json">{"author":{"name":"LD Author"},"dateModified":"2021-05-06T07:08:09Z"}</script>`,
+			want: map[string]string{"author": "Meta Author", "modified": "2021-05-06T07:08:09Z"}},
+		{name: "broken json-ld", head: `<script type="application/ld+json">{broken</script>`},
+		{name: "nothing", body: `<p>text</p>`},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.head + "</head><body>" + tt.body + "</body></html>"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pageMetadata(doc))
+		})
+	}
+}
@@ -29,9 +29,18 @@ import (
 //			GetByIDFunc: func(ctx context.Context, id bson.ObjectID) (datastore.Rule, bool) {
 //				panic("mock out the GetByID method")
 //			},
+//			ListFunc: func(ctx context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error) {
+//				panic("mock out the List method")
+//			},
 //			SaveFunc: func(ctx context.Context, rule datastore.Rule) (datastore.Rule, error) {
 //				panic("mock out the Save method")
 //			},
+//			SetHealthFunc: func(ctx context.Context, id bson.ObjectID, health datastore.RuleHealth) error {
+//				panic("mock out the SetHealth method")
+//			},
+//			UsersFunc: func(ctx context.Context) []string {
+//				panic("mock out the Users method")
+//			},
 //		}
 //
 //		// use mockedRules in code that requires extractor.Rules
@@ -51,9 +60,18 @@ type RulesMock struct {
 	// GetByIDFunc mocks the GetByID method.
 	GetByIDFunc func(ctx context.Context, id bson.ObjectID) (datastore.Rule, bool)
 
+	// ListFunc mocks the List method.
+	ListFunc func(ctx context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error)
+
 	// SaveFunc mocks the Save method.
 	SaveFunc func(ctx context.Context, rule datastore.Rule) (datastore.Rule, error)
 
+	// SetHealthFunc mocks the SetHealth method.
+	SetHealthFunc func(ctx context.Context, id bson.ObjectID, health datastore.RuleHealth) error
+
+	// UsersFunc mocks the Users method.
+	UsersFunc func(ctx context.Context) []string
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// All holds details about calls to the All method.
@@ -82,6 +100,13 @@ type RulesMock struct {
 			// ID is the id argument value.
 			ID bson.ObjectID
 		}
+		// List holds details about calls to the List method.
+		List []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Q is the q argument value.
+			Q datastore.RulesQuery
+		}
 		// Save holds details about calls to the Save method.
 		Save []struct {
 			// Ctx is the ctx argument value.
@@ -89,12 +114,29 @@ type RulesMock struct {
 			// Rule is the rule argument value.
 			Rule datastore.Rule
 		}
+		// SetHealth holds details about calls to the SetHealth method.
+		SetHealth []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID bson.ObjectID
+			// Health is the health argument value.
+			Health datastore.RuleHealth
+		}
+		// Users holds details about calls to the Users method.
+		Users []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
 	}
-	lockAll     sync.RWMutex
-	lockDisable sync.RWMutex
-	lockGet     sync.RWMutex
-	lockGetByID sync.RWMutex
-	lockSave    sync.RWMutex
+	lockAll       sync.RWMutex
+	lockDisable   sync.RWMutex
+	lockGet       sync.RWMutex
+	lockGetByID   sync.RWMutex
+	lockList      sync.RWMutex
+	lockSave      sync.RWMutex
+	lockSetHealth sync.RWMutex
+	lockUsers     sync.RWMutex
 }
 
 // All calls AllFunc.
@@ -237,6 +279,42 @@ func (mock *RulesMock) GetByIDCalls() []struct {
 	return calls
 }
 
+// List calls ListFunc.
+func (mock *RulesMock) List(ctx context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error) {
+	if mock.ListFunc == nil {
+		panic("RulesMock.ListFunc: method is nil but Rules.List was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		Q   datastore.RulesQuery
+	}{
+		Ctx: ctx,
+		Q:   q,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(ctx, q)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedRules.ListCalls())
+func (mock *RulesMock) ListCalls() []struct {
+	Ctx context.Context
+	Q   datastore.RulesQuery
+} {
+	var calls []struct {
+		Ctx context.Context
+		Q   datastore.RulesQuery
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
+
 // Save calls SaveFunc.
 func (mock *RulesMock) Save(ctx context.Context, rule datastore.Rule) (datastore.Rule, error) {
 	if mock.SaveFunc == nil {
@@ -272,3 +350,75 @@ func (mock *RulesMock) SaveCalls() []struct {
 	mock.lockSave.RUnlock()
 	return calls
 }
+
+// SetHealth calls SetHealthFunc.
+func (mock *RulesMock) SetHealth(ctx context.Context, id bson.ObjectID, health datastore.RuleHealth) error {
+	if mock.SetHealthFunc == nil {
+		panic("RulesMock.SetHealthFunc: method is nil but Rules.SetHealth was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		ID     bson.ObjectID
+		Health datastore.RuleHealth
+	}{
+		Ctx:    ctx,
+		ID:     id,
+		Health: health,
+	}
+	mock.lockSetHealth.Lock()
+	mock.calls.SetHealth = append(mock.calls.SetHealth, callInfo)
+	mock.lockSetHealth.Unlock()
+	return mock.SetHealthFunc(ctx, id, health)
+}
+
+// SetHealthCalls gets all the calls that were made to SetHealth.
+// Check the length with:
+//
+//	len(mockedRules.SetHealthCalls())
+func (mock *RulesMock) SetHealthCalls() []struct {
+	Ctx    context.Context
+	ID     bson.ObjectID
+	Health datastore.RuleHealth
+} {
+	var calls []struct {
+		Ctx    context.Context
+		ID     bson.ObjectID
+		Health datastore.RuleHealth
+	}
+	mock.lockSetHealth.RLock()
+	calls = mock.calls.SetHealth
+	mock.lockSetHealth.RUnlock()
+	return calls
+}
+
+// Users calls UsersFunc.
+func (mock *RulesMock) Users(ctx context.Context) []string {
+	if mock.UsersFunc == nil {
+		panic("RulesMock.UsersFunc: method is nil but Rules.Users was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockUsers.Lock()
+	mock.calls.Users = append(mock.calls.Users, callInfo)
+	mock.lockUsers.Unlock()
+	return mock.UsersFunc(ctx)
+}
+
+// UsersCalls gets all the calls that were made to Users.
+// Check the length with:
+//
+//	len(mockedRules.UsersCalls())
+func (mock *RulesMock) UsersCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockUsers.RLock()
+	calls = mock.calls.Users
+	mock.lockUsers.RUnlock()
+	return calls
+}
@@ -0,0 +1,252 @@
+package extractor
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+var (
+	// reNextText matches text of links leading to the next page
+	reNextText = regexp.MustCompile(`(?i)^(next( page)?|more|continue|далее|дальше|вперед|вперёд|следующая( страница)?)?\s*[›»→>]*$`)
+	// reNextAttr matches class, id, rel or aria-label of links leading to the next page
+	reNextAttr = regexp.MustCompile(`(?i)(^|[\s_-])next([\s_-]|$)`)
+	// rePageTail matches page number at the end of path, like /2, -2, /page/2 or /p-2
+	rePageTail = regexp.MustCompile(`(?i)(?:[/_-](?:page|p)[/_-]?|[/_-])(\d{1,3})$`)
+	// pageParams are query parameters used for page number
+	pageParams = []string{"page", "p", "pg", "paged", "pagenum", "page_num"}
+)
+
+// pagePart is content extracted from one of the following pages of an article
+type pagePart struct {
+	url     string
+	rich    string
+	links   []string
+	anchors []Anchor
+}
+
+// followPages fetches the following pages of multi-page article, starting from the first page's body, up to MaxPages
+// pages in total. Pages are fetched with the same retriever as the first one, a page seen before stops the walk.
+// Blocks already present on the previous pages are removed. Failure to get one of the pages stops the walk
+// and returns the pages extracted so far.
+func (f *UReadability) followPages(ctx context.Context, body, rich string, pageURL *url.URL, rule *datastore.Rule) []pagePart {
+	if f.MaxPages <= 1 {
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "extract.next_pages")
+	defer span.End()
+
+	firstURL := *pageURL
+	visited := map[string]bool{pageKey(pageURL): true}
+	seen := map[string]bool{}
+	addBlocks(rich, seen)
+
+	var res []pagePart
+	for len(res)+1 < f.MaxPages {
+		nextURL := findNextPage(body, pageURL, &firstURL, rule)
+		if nextURL == nil {
+			break
+		}
+		if visited[pageKey(nextURL)] {
+			log.Printf("[DEBUG] next page %s already visited, stop", nextURL)
+			break
+		}
+		visited[pageKey(nextURL)] = true
+
+		reqURL := nextURL.String()
+		if err := f.Policy.CheckRequestURL(reqURL); err != nil {
+			log.Printf("[WARN] refused to fetch next page %s, error=%v", reqURL, err)
+			break
+		}
+		result, err := f.pickRetriever(rule).Retrieve(ctx, reqURL)
+		if err != nil {
+			log.Printf("[WARN] failed to fetch next page %s, error=%v", reqURL, err)
+			break
+		}
+		if isPDF(result.Header, result.Body) {
+			break
+		}
+
+		if pageURL, err = url.Parse(result.URL); err != nil || !strings.EqualFold(pageURL.Host, firstURL.Host) {
+			log.Printf("[WARN] next page %s ended up at %s, stop", reqURL, result.URL)
+			break
+		}
+		visited[pageKey(pageURL)] = true
+
+		_, _, body = f.toUtf8(result.Body, result.Header)
+		doc, body, err := parsePage(body)
+		if err != nil {
+			log.Printf("[WARN] failed to parse next page %s, error=%v", reqURL, err)
+			break
+		}
+		_, pageRich, _, err := f.parseContent(body, reqURL, rule) // outcome of the rule is recorded for the first page only
+		if err != nil {
+			log.Printf("[WARN] failed to parse next page %s, error=%v", reqURL, err)
+			break
+		}
+		if pageRich = removeSeenBlocks(pageRich, seen); pageRich == "" {
+			log.Printf("[DEBUG] nothing new on next page %s, stop", reqURL)
+			break
+		}
+		part := pagePart{url: result.URL}
+		part.rich, part.links, part.anchors = f.normalizeLinks(pageRich, documentBase(doc, pageURL))
+		res = append(res, part)
+	}
+	span.SetAttributes(attribute.Int("extract.next_pages", len(res)))
+	if len(res) > 0 {
+		log.Printf("[INFO] stitched %d more pages for %s", len(res), firstURL.String())
+	}
+	return res
+}
+
+// findNextPage looks for the next page link in page body. Rule's NextPage selector is used if set, then
+// link and anchor elements with rel=next. Otherwise anchors looking like "next" or the next page number are
+// picked if their URL looks like a pagination of the first page. Links to other hosts are ignored.
+func findNextPage(body string, pageURL, firstURL *url.URL, rule *datastore.Rule) *url.URL {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	resolve := func(s *goquery.Selection) *url.URL {
+		href, ok := s.Attr("href")
+		if !ok {
+			href, ok = s.Find("a[href]").First().Attr("href")
+		}
+		if !ok || strings.TrimSpace(href) == "" || strings.HasPrefix(strings.TrimSpace(href), "#") {
+			return nil
+		}
+		u, err := pageURL.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.EqualFold(u.Host, firstURL.Host) {
+			return nil
+		}
+		u.Fragment = ""
+		return u
+	}
+
+	if rule != nil && strings.TrimSpace(rule.NextPage) != "" {
+		return resolve(doc.Find(rule.NextPage).First())
+	}
+	if u := resolve(doc.Find(`link[rel~="next"], a[rel~="next"]`).First()); u != nil {
+		return u
+	}
+
+	curPage := pageNumber(pageURL, firstURL)
+	var res *url.URL
+	doc.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		text := strings.TrimSpace(reSpaces.ReplaceAllString(s.Text(), " "))
+		attrs := s.AttrOr("class", "") + " " + s.AttrOr("id", "") + " " + s.AttrOr("aria-label", "")
+		isNext := (text != "" && reNextText.MatchString(text)) || reNextAttr.MatchString(attrs) ||
+			text == strconv.Itoa(curPage+1)
+		if !isNext {
+			return true
+		}
+		u := resolve(s)
+		if u != nil && pageNumber(u, firstURL) == curPage+1 {
+			res = u
+			return false
+		}
+		return true
+	})
+	return res
+}
+
+// pageNumber returns page number of u as a pagination of the first page, by page query parameter
+// or by number at the end of the path. Returns 1 for the first page and 0 if u is not a pagination of it.
+func pageNumber(u, first *url.URL) int {
+	if !strings.EqualFold(u.Host, first.Host) {
+		return 0
+	}
+	path, firstPath := strings.TrimSuffix(u.Path, "/"), strings.TrimSuffix(first.Path, "/")
+	if path == firstPath {
+		for _, p := range pageParams {
+			if v := u.Query().Get(p); v != "" && v != first.Query().Get(p) {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return 0
+				}
+				return n
+			}
+		}
+		return 1
+	}
+
+	// first page may have the number in the path too, e.g. /article/1 or /article/page/1
+	if m := rePageTail.FindStringSubmatchIndex(firstPath); m != nil && firstPath[m[2]:m[3]] == "1" {
+		firstPath = firstPath[:m[0]]
+	}
+	m := rePageTail.FindStringSubmatchIndex(path)
+	if m == nil || !strings.EqualFold(path[:m[0]], firstPath) {
+		return 0
+	}
+	n, err := strconv.Atoi(path[m[2]:m[3]])
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// pageKey normalizes page URL for loop detection
+func pageKey(u *url.URL) string {
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/") + "?" + u.Query().Encode()
+}
+
+// blockSelector selects content blocks compared between pages to remove repeated ones
+const blockSelector = "p, h1, h2, h3, h4, h5, h6, li, blockquote, pre, figure, table"
+
+// addBlocks adds normalized text of content blocks to seen set
+func addBlocks(rich string, seen map[string]bool) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rich))
+	if err != nil {
+		return
+	}
+	doc.Find(blockSelector).Each(func(_ int, s *goquery.Selection) {
+		if key := blockKey(s); key != "" {
+			seen[key] = true
+		}
+	})
+}
+
+// removeSeenBlocks drops content blocks with text seen on the previous pages and adds the remaining ones to seen.
+// Returns empty string if nothing but whitespace is left.
+func removeSeenBlocks(rich string, seen map[string]bool) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rich))
+	if err != nil {
+		return rich
+	}
+	var fresh []string
+	doc.Find(blockSelector).Each(func(_ int, s *goquery.Selection) {
+		key := blockKey(s)
+		if key == "" {
+			return
+		}
+		if seen[key] {
+			s.Remove()
+			return
+		}
+		fresh = append(fresh, key)
+	})
+	for _, key := range fresh {
+		seen[key] = true
+	}
+	if strings.TrimSpace(doc.Find("body").Text()) == "" && doc.Find("body img").Length() == 0 {
+		return ""
+	}
+	res, err := doc.Find("body").Html()
+	if err != nil {
+		return rich
+	}
+	return strings.TrimSpace(res)
+}
+
+func blockKey(s *goquery.Selection) string {
+	return strings.ToLower(strings.TrimSpace(reSpaces.ReplaceAllString(s.Text(), " ")))
+}
@@ -0,0 +1,209 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/extractor/mocks"
+)
+
+func TestPageNumber(t *testing.T) {
+	tests := []struct {
+		first, u string
+		want     int
+	}{
+		{first: "https://example.com/article", u: "https://example.com/article", want: 1},
+		{first: "https://example.com/article", u: "https://example.com/article/", want: 1},
+		{first: "https://example.com/article", u: "https://example.com/article?page=2", want: 2},
+		{first: "https://example.com/article?id=5", u: "https://example.com/article?id=5&p=3", want: 3},
+		{first: "https://example.com/article?page=1", u: "https://example.com/article?page=2", want: 2},
+		{first: "https://example.com/article", u: "https://example.com/article/2", want: 2},
+		{first: "https://example.com/article/", u: "https://example.com/article/page/3/", want: 3},
+		{first: "https://example.com/article", u: "https://example.com/article-2", want: 2},
+		{first: "https://example.com/article/1", u: "https://example.com/article/2", want: 2},
+		{first: "https://example.com/article", u: "https://example.com/article?page=x"},
+		{first: "https://example.com/article", u: "https://example.com/other/2"},
+		{first: "https://example.com/article", u: "https://other.com/article/2"},
+		{first: "https://example.com/post/122", u: "https://example.com/post/123"},
+		{first: "https://example.com/article", u: "https://example.com/article/12345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.first+" "+tt.u, func(t *testing.T) {
+			first, err := url.Parse(tt.first)
+			require.NoError(t, err)
+			u, err := url.Parse(tt.u)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pageNumber(u, first))
+		})
+	}
+}
+
+func TestFindNextPage(t *testing.T) {
+	first, err := url.Parse("https://example.com/article")
+	require.NoError(t, err)
+	second, err := url.Parse("https://example.com/article?page=2")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		body string
+		page *url.URL
+		rule *datastore.Rule
+		want string
+	}{
+		{name: "link rel next", page: first, want: "https://example.com/article/2",
+			body: `<html><head><link rel="next" href="/article/2"></head><body></body></html>`},
+		{name: "anchor rel next", page: first, want: "https://example.com/article?page=2",
+			body: `<a href="/elsewhere">Next</a><a rel="next nofollow" href="?page=2#top">2</a>`},
+		{name: "next text", page: first, want: "https://example.com/article?page=2",
+			body: `<a href="/article?page=2">Next page »</a>`},
+		{name: "russian next text", page: first, want: "https://example.com/article/2",
+			body: `<a href="/article/2">Следующая страница</a>`},
+		{name: "next class", page: first, want: "https://example.com/article/page/2",
+			body: `<a class="btn pagination-next" href="/article/page/2"><span>→</span></a>`},
+		{name: "page number", page: second, want: "https://example.com/article?page=3",
+			body: `<a href="?page=1">1</a><a href="?page=2">2</a><a href="?page=3">3</a><a href="?page=4">4</a>`},
+		{name: "next article is not a page", page: first,
+			body: `<a href="/another-article">Next</a><a class="next-post" href="/post/123">Read next</a>`},
+		{name: "other host", page: first,
+			body: `<link rel="next" href="https://other.com/article/2">`},
+		{name: "rule selector", page: first, rule: &datastore.Rule{NextPage: ".pager .forward"},
+			want: "https://example.com/read/more", body: `<div class="pager"><span class="forward"><a href="/read/more">go</a></span></div>` +
+				`<link rel="next" href="/article/2">`},
+		{name: "rule selector not found", page: first, rule: &datastore.Rule{NextPage: ".forward"},
+			body: `<link rel="next" href="/article/2">`},
+		{name: "fragment only", page: first, body: `<link rel="next" href="#comments">`},
+		{name: "nothing", page: first, body: `<p>just text</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := findNextPage(tt.body, tt.page, first, tt.rule)
+			if tt.want == "" {
+				assert.Nil(t, res)
+				return
+			}
+			require.NotNil(t, res)
+			assert.Equal(t, tt.want, res.String())
+		})
+	}
+}
+
+func TestRemoveSeenBlocks(t *testing.T) {
+	seen := map[string]bool{}
+	addBlocks(`<div><p>Site header</p><p>First page text.</p></div>`, seen)
+
+	res := removeSeenBlocks(`<div><p>Site  header</p><p>Second page text.</p><ul><li>item</li></ul></div>`, seen)
+	assert.Equal(t, `<div><p>Second page text.</p><ul><li>item</li></ul></div>`, res)
+	assert.True(t, seen["second page text."], "new blocks added to seen")
+
+	res = removeSeenBlocks(`<div><p>site header</p><p>Second page text.</p></div>`, seen)
+	assert.Empty(t, res, "nothing new")
+}
+
+func TestExtractMultiPage(t *testing.T) {
+	para := func(s string) string {
+		return "<p>" + strings.Repeat(s+" is a sentence long enough to be kept by the readability parser, ", 3) + "</p>"
+	}
+	page := func(head, nav string, paras ...string) string {
+		return `<html><head><title>Long read</title>` + head + `</head><body><div class="article">` + para("Intro") +
+			strings.Join(paras, "") + `</div><div class="nav">` + nav + `</div></body></html>`
+	}
+
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.RequestURI() {
+		case "/story":
+			_, _ = fmt.Fprint(w, page(`<link rel="next" href="/story?page=2">`, "", para("First")))
+		case "/story?page=2":
+			_, _ = fmt.Fprint(w, page("", `<a href="/story?page=3">Next »</a>`, para("Second"), `<p><a href="../img/x">pic</a></p>`))
+		case "/story?page=3":
+			_, _ = fmt.Fprint(w, page(`<link rel="next" href="/story">`, "", para("Third")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	t.Run("disabled by default", func(t *testing.T) {
+		hits.Store(0)
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200}
+		res, err := lr.Extract(context.Background(), ts.URL+"/story")
+		require.NoError(t, err)
+		assert.Contains(t, res.Content, "First is a sentence")
+		assert.NotContains(t, res.Content, "Second is a sentence")
+		assert.Empty(t, res.NextPages)
+		assert.Equal(t, int32(1), hits.Load())
+	})
+
+	t.Run("all pages stitched, loop back to the first page stops", func(t *testing.T) {
+		hits.Store(0)
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, MaxPages: 10}
+		res, err := lr.Extract(context.Background(), ts.URL+"/story")
+		require.NoError(t, err)
+		assert.Equal(t, []string{ts.URL + "/story?page=2", ts.URL + "/story?page=3"}, res.NextPages)
+		assert.Equal(t, 1, strings.Count(res.Rich, "<p>Intro is a sentence long"), "repeated block removed")
+		assert.Less(t, strings.Index(res.Content, "First is"), strings.Index(res.Content, "Second is"))
+		assert.Less(t, strings.Index(res.Content, "Second is"), strings.Index(res.Content, "Third is"))
+		assert.Contains(t, res.Rich, "Third is a sentence")
+		assert.Contains(t, res.AllLinks, ts.URL+"/img/x", "links of the following pages are normalized")
+		assert.Equal(t, int32(3), hits.Load())
+	})
+
+	t.Run("page cap", func(t *testing.T) {
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, MaxPages: 2}
+		res, err := lr.Extract(context.Background(), ts.URL+"/story")
+		require.NoError(t, err)
+		assert.Equal(t, []string{ts.URL + "/story?page=2"}, res.NextPages)
+		assert.NotContains(t, res.Content, "Third is a sentence")
+	})
+
+	t.Run("rule selector", func(t *testing.T) {
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, MaxPages: 3}
+		res, err := lr.ExtractByRule(context.Background(), ts.URL+"/story",
+			&datastore.Rule{Content: "div.article", NextPage: "link[rel=next]"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{ts.URL + "/story?page=2"}, res.NextPages, "second page has no link matching the selector")
+	})
+
+	t.Run("rule outcome recorded for the first page only", func(t *testing.T) {
+		rules := &mocks.RulesMock{SetHealthFunc: func(context.Context, bson.ObjectID, datastore.RuleHealth) error { return nil }}
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, MaxPages: 3, Rules: rules}
+		rule := &datastore.Rule{ID: bson.NewObjectID(), Content: `div.article:has(p:contains("First"))`}
+		series := func(result string) string {
+			return `ukeeper_rule_extractions_total{result="` + result + `",rule="` + rule.ID.Hex() + `"}`
+		}
+
+		res, err := lr.ExtractWithOptions(context.Background(), ts.URL+"/story", ExtractOptions{Rule: rule, Debug: true})
+		require.NoError(t, err)
+		assert.Len(t, res.NextPages, 2, "following pages extracted with the general parser")
+		assert.Equal(t, "rule", res.Diagnostics.Parser, "parser of the first page")
+		assert.InDelta(t, 1, metricValue(t, series("rule")), 0)
+		assert.InDelta(t, 0, metricValue(t, series("fallback")), 0)
+		require.Eventually(t, func() bool { return len(rules.SetHealthCalls()) == 1 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		require.Len(t, rules.SetHealthCalls(), 1)
+		assert.True(t, rules.SetHealthCalls()[0].Health.OK)
+	})
+
+	t.Run("rule selector without link", func(t *testing.T) {
+		lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, MaxPages: 3}
+		res, err := lr.ExtractByRule(context.Background(), ts.URL+"/story",
+			&datastore.Rule{Content: "div.article", NextPage: "div.article"})
+		require.NoError(t, err)
+		assert.Empty(t, res.NextPages)
+		assert.Contains(t, res.Content, "First is a sentence")
+	})
+}
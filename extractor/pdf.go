@@ -0,0 +1,279 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFContentType is the media type of PDF documents, extracted with the PDF path instead of readability
+const PDFContentType = "application/pdf"
+
+// ErrNoPDFText reported for PDF documents without text layer, e.g. scanned images
+var ErrNoPDFText = errors.New("no text found in pdf")
+
+// pdfMetaKeys maps PDF document info keys to keys of Response.Metadata
+var pdfMetaKeys = map[string]string{
+	"Title": "title", "Author": "author", "Subject": "subject", "Keywords": "keywords",
+	"Creator": "creator", "Producer": "producer", "CreationDate": "created", "ModDate": "modified",
+}
+
+// pdfDocument is the text and document info extracted from a PDF
+type pdfDocument struct {
+	Title     string
+	Rich      string // html with paragraphs and detected headings
+	Text      string // plain text of paragraphs and headings
+	PageCount int
+	Metadata  map[string]string
+}
+
+// pdfLine is a single line of text on a page, assembled from positioned glyphs
+type pdfLine struct {
+	text string
+	size float64 // font size of the line, the largest glyph wins
+	y    float64
+	page int
+}
+
+// isPDF reports whether the retrieved body is a PDF document, by declared content type or by magic bytes
+func isPDF(header http.Header, body []byte) bool {
+	if mediaType(header.Get("Content-Type")) == PDFContentType {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(body[:min(len(body), 1024)], "\x00\t\r\n "), []byte("%PDF-"))
+}
+
+// parsePDF extracts text, document info and page count from PDF data.
+// The pdf library panics on some malformed documents, such panics are returned as errors.
+func parsePDF(data []byte) (doc *pdfDocument, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("malformed pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open pdf: %w", err)
+	}
+
+	doc = &pdfDocument{PageCount: reader.NumPage(), Metadata: pdfMetadata(reader.Trailer().Key("Info"))}
+	var lines []pdfLine
+	for i := 1; i <= doc.PageCount; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		lines = append(lines, pdfPageLines(page.Content().Text, i)...)
+	}
+	if len(lines) == 0 {
+		return nil, ErrNoPDFText
+	}
+
+	var firstHeading string
+	doc.Rich, doc.Text, firstHeading = pdfLinesToHTML(lines)
+	doc.Title = doc.Metadata["title"]
+	if doc.Title == "" {
+		doc.Title = firstHeading
+	}
+	return doc, nil
+}
+
+// pdfMetadata collects non-empty document info fields, dates converted to RFC3339 when possible
+func pdfMetadata(info pdf.Value) map[string]string {
+	res := map[string]string{}
+	if info.IsNull() {
+		return res
+	}
+	for key, name := range pdfMetaKeys {
+		val := strings.TrimSpace(info.Key(key).Text())
+		if val == "" {
+			continue
+		}
+		if key == "CreationDate" || key == "ModDate" {
+			if t, ok := parsePDFDate(val); ok {
+				val = t.Format(time.RFC3339)
+			}
+		}
+		res[name] = val
+	}
+	return res
+}
+
+// parsePDFDate parses dates like "D:20230102150405+03'00'", any trailing part may be omitted
+func parsePDFDate(val string) (time.Time, bool) {
+	val = strings.TrimPrefix(val, "D:")
+	val = strings.ReplaceAll(strings.TrimSuffix(val, "'"), "'", ":")
+	if strings.HasSuffix(val, "Z") || strings.HasSuffix(val, "Z00:00") {
+		val = strings.TrimSuffix(strings.TrimSuffix(val, "00:00"), "Z") + "+00:00"
+	}
+	for _, layout := range []string{"20060102150405-07:00", "20060102150405", "200601021504", "20060102", "200601", "2006"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// pdfPageLines groups glyphs of a page into lines in stream order. A new line starts when glyph moves
+// vertically or jumps back to the left; a space is added for horizontal gaps wider than a fraction of font size.
+func pdfPageLines(glyphs []pdf.Text, page int) []pdfLine {
+	var res []pdfLine
+	var sb strings.Builder
+	cur := pdfLine{page: page}
+	var lastX, lastEnd float64
+
+	flush := func() {
+		if text := strings.Join(strings.Fields(sb.String()), " "); text != "" {
+			cur.text = text
+			res = append(res, cur)
+		}
+		sb.Reset()
+		cur = pdfLine{page: page}
+	}
+
+	for _, g := range glyphs {
+		if g.S == "" {
+			continue
+		}
+		size := math.Max(g.FontSize, 1)
+		if sb.Len() > 0 && (math.Abs(g.Y-cur.y) > size/2 || g.X < lastX-size) {
+			flush()
+		}
+		if sb.Len() == 0 {
+			cur.y = g.Y
+		} else if g.X-lastEnd > size*0.15 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(g.S)
+		cur.size = math.Max(cur.size, g.FontSize)
+		lastX, lastEnd = g.X, g.X+g.W
+	}
+	flush()
+	return res
+}
+
+// pdfLinesToHTML joins lines into paragraphs and headings. Body font size is the one covering most of the text,
+// noticeably larger lines are headings. Paragraphs are split on page breaks and on vertical gaps
+// wider than usual line spacing. Returns html, plain text with blocks separated by spaces and the first heading.
+func pdfLinesToHTML(lines []pdfLine) (rich, text, firstHeading string) {
+	bodySize := pdfBodySize(lines)
+	leading := pdfLeading(lines, bodySize)
+
+	headingLevel := func(l pdfLine) int {
+		switch {
+		case len([]rune(l.text)) > 200:
+			return 0
+		case l.size >= bodySize*1.5:
+			return 1
+		case l.size >= bodySize*1.2:
+			return 2
+		default:
+			return 0
+		}
+	}
+
+	var sb strings.Builder
+	var texts, block []string
+	blockLevel := 0
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+		blockText := pdfJoinLines(block)
+		texts = append(texts, blockText)
+		if blockLevel > 0 {
+			if firstHeading == "" {
+				firstHeading = blockText
+			}
+			fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", blockLevel, html.EscapeString(blockText), blockLevel)
+		} else {
+			fmt.Fprintf(&sb, "<p>%s</p>\n", html.EscapeString(blockText))
+		}
+		block = nil
+	}
+
+	for i, l := range lines {
+		level := headingLevel(l)
+		if i > 0 {
+			prev := lines[i-1]
+			gap := prev.y - l.y
+			if level != blockLevel || l.page != prev.page || gap <= 0 || gap > leading*1.4 {
+				flush()
+			}
+		}
+		blockLevel = level
+		block = append(block, l.text)
+	}
+	flush()
+	return strings.TrimSpace(sb.String()), strings.Join(texts, " "), firstHeading
+}
+
+// pdfBodySize returns font size with the most text, rounded to half a point
+func pdfBodySize(lines []pdfLine) float64 {
+	weights := map[float64]int{}
+	for _, l := range lines {
+		weights[math.Round(l.size*2)/2] += len(l.text)
+	}
+	var res float64
+	best := -1
+	for size, w := range weights {
+		if w > best || (w == best && size < res) {
+			res, best = size, w
+		}
+	}
+	if res <= 0 {
+		return 1
+	}
+	return res
+}
+
+// pdfLeading returns median vertical distance between consecutive body lines on the same page,
+// falls back to 1.2 of body font size if there are not enough lines
+func pdfLeading(lines []pdfLine, bodySize float64) float64 {
+	var gaps []float64
+	for i := 1; i < len(lines); i++ {
+		prev, l := lines[i-1], lines[i]
+		if prev.page != l.page || math.Abs(l.size-bodySize) > 0.5 || math.Abs(prev.size-bodySize) > 0.5 {
+			continue
+		}
+		if gap := prev.y - l.y; gap > 0 {
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return bodySize * 1.2
+	}
+	sort.Float64s(gaps)
+	return gaps[len(gaps)/2]
+}
+
+// pdfJoinLines joins wrapped lines with spaces, removing hyphenation at line ends
+func pdfJoinLines(lines []string) string {
+	res := ""
+	for i, l := range lines {
+		if i == 0 {
+			res = l
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(l)
+		if hyphenated, ok := strings.CutSuffix(res, "-"); ok && unicode.IsLower(next) {
+			if prev, _ := utf8.DecodeLastRuneInString(hyphenated); unicode.IsLetter(prev) {
+				res = hyphenated + l
+				continue
+			}
+		}
+		res += " " + l
+	}
+	return res
+}
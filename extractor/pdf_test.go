@@ -0,0 +1,117 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePDF(t *testing.T) {
+	data, err := os.ReadFile("testdata/widgets-report.pdf")
+	require.NoError(t, err)
+
+	doc, err := parsePDF(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Widgets Report 2023", doc.Title, "title from document info")
+	assert.Equal(t, 2, doc.PageCount)
+	assert.Equal(t, map[string]string{"title": "Widgets Report 2023", "author": "Jane Doe", "producer": "handmade",
+		"created": "2023-04-15T10:30:00+02:00"}, doc.Metadata)
+
+	want := `<h1>Quarterly Report on Widgets</h1>
+<p>Widgets are small devices used in many industries. This report covers production volumes, prices and the outlook for the next quarter of the year.</p>
+<p>Sales grew by twelve percent compared to the previous quarter &amp; margins stayed flat.</p>
+<h2>Methods</h2>
+<p>We surveyed two hundred manufacturers across three regions.</p>
+<p>Results show steady demand for widgets in all surveyed regions. Prices are expected to remain stable.</p>`
+	assert.Equal(t, want, doc.Rich)
+	assert.Equal(t, "Quarterly Report on Widgets Widgets are small devices", doc.Text[:53])
+}
+
+func TestParsePDFBroken(t *testing.T) {
+	_, err := parsePDF([]byte("%PDF-1.4\nnot really a pdf"))
+	require.Error(t, err)
+
+	_, err = parsePDF(nil)
+	require.Error(t, err)
+}
+
+func TestIsPDF(t *testing.T) {
+	hdr := func(ct string) http.Header { return http.Header{"Content-Type": []string{ct}} }
+	assert.True(t, isPDF(hdr("application/pdf"), nil))
+	assert.True(t, isPDF(hdr("Application/PDF; qs=0.5"), nil))
+	assert.True(t, isPDF(http.Header{}, []byte("%PDF-1.7\n...")))
+	assert.True(t, isPDF(hdr("text/html"), []byte("\r\n%PDF-1.4\n...")), "misconfigured server")
+	assert.False(t, isPDF(hdr("text/html"), []byte("<html>%PDF-1.4</html>")))
+	assert.False(t, isPDF(http.Header{}, nil))
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: "D:20230415103000+02'00'", want: "2023-04-15T10:30:00+02:00", ok: true},
+		{in: "D:20230415103000-05'30", want: "2023-04-15T10:30:00-05:30", ok: true},
+		{in: "D:20230415103000Z", want: "2023-04-15T10:30:00Z", ok: true},
+		{in: "D:20230415103000Z00'00'", want: "2023-04-15T10:30:00Z", ok: true},
+		{in: "D:20230415103000", want: "2023-04-15T10:30:00Z", ok: true},
+		{in: "D:20230415", want: "2023-04-15T00:00:00Z", ok: true},
+		{in: "2023", want: "2023-01-01T00:00:00Z", ok: true},
+		{in: "last tuesday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			res, ok := parsePDFDate(tt.in)
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.want, res.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestPDFJoinLines(t *testing.T) {
+	assert.Equal(t, "one two", pdfJoinLines([]string{"one", "two"}))
+	assert.Equal(t, "production", pdfJoinLines([]string{"pro-", "duction"}))
+	assert.Equal(t, "pro- Duction", pdfJoinLines([]string{"pro-", "Duction"}), "capitalized word is not a continuation")
+	assert.Equal(t, "2023- next", pdfJoinLines([]string{"2023-", "next"}))
+	assert.Empty(t, pdfJoinLines(nil))
+}
+
+func TestExtractPDF(t *testing.T) {
+	data, err := os.ReadFile("testdata/widgets-report.pdf")
+	require.NoError(t, err)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report.pdf" {
+			w.Header().Set("Content-Type", "application/pdf")
+		} else {
+			w.Header()["Content-Type"] = nil // detected by magic bytes
+		}
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 50}
+	for _, path := range []string{"/report.pdf", "/download?id=1"} {
+		t.Run(path, func(t *testing.T) {
+			res, err := lr.Extract(context.Background(), ts.URL+path)
+			require.NoError(t, err)
+			assert.Equal(t, "Widgets Report 2023", res.Title)
+			assert.Equal(t, "application/pdf", res.ContentType)
+			assert.Equal(t, 2, res.PageCount)
+			assert.Equal(t, "Jane Doe", res.Metadata["author"])
+			assert.Contains(t, res.Rich, "<h2>Methods</h2>")
+			assert.Contains(t, res.Content, "Prices are expected to remain stable.")
+			assert.NotContains(t, res.Content, "<p>")
+			assert.Equal(t, "Widgets are small devices used in many industries.", res.Excerpt)
+			assert.Equal(t, ts.URL[len("http://"):], res.Domain)
+		})
+	}
+}
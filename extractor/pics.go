@@ -1,18 +1,29 @@
 package extractor
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/go-pkgz/lgr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
-func (f *UReadability) extractPics(iselect *goquery.Selection, url string) (mainImage string, allImages []string, ok bool) {
+func (f *UReadability) extractPics(ctx context.Context, iselect *goquery.Selection, url string) (mainImage string, allImages []string, ok bool) {
+	ctx, span := tracer.Start(ctx, "extract.images")
+	defer span.End()
 	images := make(map[int]string)
+	sizes := make(map[string]int)
 
 	type imgInfo struct {
 		url  string
@@ -24,7 +35,7 @@ func (f *UReadability) extractPics(iselect *goquery.Selection, url string) (main
 	iselect.Each(func(_ int, s *goquery.Selection) {
 		if im, ok := s.Attr("src"); ok {
 			wg.Go(func() {
-				size := f.getImageSize(im)
+				size := f.getImageSize(ctx, im)
 				resCh <- imgInfo{url: im, size: size}
 			})
 		}
@@ -37,6 +48,7 @@ func (f *UReadability) extractPics(iselect *goquery.Selection, url string) (main
 
 	for r := range resCh {
 		images[r.size] = r.url
+		sizes[r.url] = r.size
 		allImages = append(allImages, r.url)
 	}
 	sort.Strings(allImages)
@@ -51,21 +63,54 @@ func (f *UReadability) extractPics(iselect *goquery.Selection, url string) (main
 	}
 	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
 	mainImage = images[keys[0]]
+	diagnostics(ctx).images(sizes, mainImage)
 	log.Printf("[DEBUG] total images from %s = %d, main=%s (%d)", url, len(images), mainImage, keys[0])
+	span.SetAttributes(attribute.Int("extract.images", len(allImages)))
 	return mainImage, allImages, true
 }
 
+// imageHTTPClient returns cached client for image fetching, restricted by the outbound policy
+func (f *UReadability) imageHTTPClient() *http.Client {
+	f.imageClientOnce.Do(func() {
+		transport := f.Policy.Transport(http.DefaultTransport.(*http.Transport).Clone())
+		f.imageClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return f.Policy.CheckURL(req.URL)
+			},
+		}
+	})
+	return f.imageClient
+}
+
 // getImageSize loads image to get size
-func (f *UReadability) getImageSize(url string) (size int) {
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", url, http.NoBody)
+func (f *UReadability) getImageSize(ctx context.Context, url string) (size int) {
+	ctx, span := tracer.Start(ctx, "extract.image_probe", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", url)))
+	outcome := "error"
+	defer func() {
+		metrics.ObserveImage(outcome)
+		span.SetAttributes(attribute.String("image.outcome", outcome), attribute.Int("image.size", size))
+		span.End()
+	}()
+
+	if err := f.Policy.CheckRequestURL(url); err != nil {
+		log.Printf("[WARN] refused to get pic from %s, error=%v", url, err)
+		outcome = "forbidden"
+		return 0
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
 	if err != nil {
 		log.Printf("[WARN] can't create request to get pic from %s", url)
 		return 0
 	}
 	req.Close = true
 	req.Header.Set("User-Agent", userAgent)
-	resp, err := httpClient.Do(req)
+	resp, err := f.imageHTTPClient().Do(req)
 	if err != nil {
 		log.Printf("[WARN] can't get %s, error=%v", url, err)
 		return 0
@@ -76,10 +121,50 @@ func (f *UReadability) getImageSize(url string) (size int) {
 		}
 	}()
 
-	data, err := io.ReadAll(resp.Body)
+	maxSize := f.MaxImageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxImageSize
+	}
+	if resp.ContentLength > maxSize {
+		log.Printf("[WARN] skip pic %s, %v", url, &ContentError{URL: url, Size: resp.ContentLength, Limit: maxSize, Err: ErrContentTooLarge})
+		outcome = "too_large"
+		return 0
+	}
+	br := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("[WARN] failed to get %s, err=%v", url, err)
+		return 0
+	}
+	if !isImage(resp.Header.Get("Content-Type"), head) {
+		log.Printf("[WARN] skip pic %s, %v", url, &ContentError{URL: url, ContentType: resp.Header.Get("Content-Type"), Err: ErrUnsupportedContent})
+		outcome = "not_image"
+		return 0
+	}
+	// the image is only measured, so it is counted without keeping it in memory
+	n, err := io.Copy(io.Discard, io.LimitReader(br, maxSize+1))
 	if err != nil {
 		log.Printf("[WARN] failed to get %s, err=%v", url, err)
 		return 0
 	}
-	return len(data)
+	if n > maxSize {
+		log.Printf("[WARN] skip pic %s, %v", url, &ContentError{URL: url, Size: n, Limit: maxSize, Err: ErrContentTooLarge})
+		outcome = "too_large"
+		return 0
+	}
+	outcome = "ok"
+	return int(n)
+}
+
+// isImage checks declared content type, falling back to magic bytes for missing or generic binary type
+func isImage(contentType string, head []byte) bool {
+	mt := mediaType(contentType)
+	switch {
+	case strings.HasPrefix(mt, "image/"):
+		return true
+	case mt == "" || mt == "application/octet-stream" || mt == "binary/octet-stream":
+		return strings.HasPrefix(http.DetectContentType(head), "image/")
+	default:
+		return false
+	}
 }
@@ -49,7 +49,7 @@ func TestExtractPicsDirectly(t *testing.T) {
 		d, err := goquery.NewDocumentFromReader(strings.NewReader(data))
 		require.NoError(t, err)
 		sel := d.Find("img")
-		im, allImages, ok := lr.extractPics(sel, "url")
+		im, allImages, ok := lr.extractPics(context.Background(), sel, "url")
 		assert.True(t, ok)
 		assert.Len(t, allImages, 1)
 		assert.Equal(t, "https://cdn1.tnwcdn.com/wp-content/blogs.dir/1/files/2016/01/page-source.jpg", im)
@@ -60,7 +60,7 @@ func TestExtractPicsDirectly(t *testing.T) {
 		d, err := goquery.NewDocumentFromReader(strings.NewReader(data))
 		require.NoError(t, err)
 		sel := d.Find("img")
-		im, allImages, ok := lr.extractPics(sel, "url")
+		im, allImages, ok := lr.extractPics(context.Background(), sel, "url")
 		assert.False(t, ok)
 		assert.Empty(t, allImages)
 		assert.Empty(t, im)
@@ -71,7 +71,7 @@ func TestExtractPicsDirectly(t *testing.T) {
 		d, err := goquery.NewDocumentFromReader(strings.NewReader(data))
 		require.NoError(t, err)
 		sel := d.Find("img")
-		im, allImages, ok := lr.extractPics(sel, "url")
+		im, allImages, ok := lr.extractPics(context.Background(), sel, "url")
 		assert.True(t, ok)
 		assert.Len(t, allImages, 1)
 		assert.Equal(t, "http://bad_url", im)
@@ -86,7 +86,7 @@ func TestExtractPicsDirectly(t *testing.T) {
 		d, err := goquery.NewDocumentFromReader(strings.NewReader(data))
 		require.NoError(t, err)
 		sel := d.Find("img")
-		im, allImages, ok := lr.extractPics(sel, "url")
+		im, allImages, ok := lr.extractPics(context.Background(), sel, "url")
 		assert.True(t, ok)
 		assert.Len(t, allImages, 1)
 		assert.Equal(t, ts.URL, im)
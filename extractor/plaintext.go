@@ -0,0 +1,259 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// text formats of ExtractOptions.Text
+const (
+	TextStructured = "structured" // paragraphs, headings, list items and quotes on separate lines, the default
+	TextFlat       = "flat"       // everything on a single line, as before structured text was added
+)
+
+// MinTextWidth is the narrowest ExtractOptions.TextWidth wrapping structured text
+const MinTextWidth = 20
+
+// textBlock is a block of structured text, like paragraph or list item
+type textBlock struct {
+	text   string
+	prefix string // quote marks and indent of nested lists, added to every line
+	marker string // list item marker of the first line, other lines are indented by its width
+	list   bool   // list items follow each other without blank lines
+	pre    bool   // preformatted text is kept as is, without wrapping
+}
+
+// textRenderer collects blocks of structured text from html
+type textRenderer struct {
+	blocks []textBlock
+	inline strings.Builder
+	quote  int      // depth of blockquotes
+	lists  []string // markers of nested lists, "-" for unordered lists, number of the last item for ordered ones
+	marker string   // marker of the list item waiting for its first block
+	pre    int      // depth of pre elements
+}
+
+// textBlockTags are elements starting a new block of structured text
+var textBlockTags = map[string]bool{"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "ul": true, "ol": true, "li": true, "blockquote": true, "pre": true, "figure": true, "figcaption": true,
+	"table": true, "tr": true, "dl": true, "dt": true, "dd": true, "section": true, "article": true, "header": true,
+	"footer": true, "aside": true, "hr": true, "details": true, "summary": true, "address": true}
+
+// structuredText returns plain text of rich html, keeping its structure: paragraphs and headings are
+// separated by blank lines, list items are on separate lines with "-" or their number, and quotes have
+// "> " in front of every line. Lines are wrapped at width characters if it's above zero. The title heading
+// at the start of the text is removed.
+func structuredText(rich, title string, width int) string {
+	nodes, err := html.ParseFragment(strings.NewReader(rich), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return ""
+	}
+	r := &textRenderer{}
+	for _, n := range nodes {
+		r.walk(n)
+	}
+	r.flush()
+	if len(r.blocks) > 0 && stripTitle(r.blocks[0].text, title) == "" {
+		r.blocks = r.blocks[1:]
+	}
+
+	var b strings.Builder
+	for i, block := range r.blocks {
+		if i > 0 {
+			b.WriteString("\n")
+			if !block.list || !r.blocks[i-1].list {
+				b.WriteString(commonPrefix(block.prefix, r.blocks[i-1].prefix) + "\n")
+			}
+		}
+		b.WriteString(block.render(width))
+	}
+	return b.String()
+}
+
+func (r *textRenderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if r.pre > 0 {
+			r.inline.WriteString(n.Data)
+			return
+		}
+		if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+			if unicode.IsSpace(rune(n.Data[0])) {
+				r.space()
+			}
+			r.inline.WriteString(text)
+		}
+		if last, _ := utf8.DecodeLastRuneInString(n.Data); unicode.IsSpace(last) {
+			r.space()
+		}
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+		return
+	}
+
+	switch n.Data {
+	case "script", "style", "noscript", "template", "img", "iframe", "video", "audio", "picture", "svg":
+		return
+	case "br":
+		r.inline.WriteString("\n")
+		return
+	case "td", "th":
+		r.space()
+	}
+	if !textBlockTags[n.Data] {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+		return
+	}
+
+	r.flush()
+	switch n.Data {
+	case "blockquote":
+		r.quote++
+		defer func() { r.quote-- }()
+	case "pre":
+		r.pre++
+		defer func() { r.pre-- }()
+	case "ul", "ol":
+		marker := "-"
+		if n.Data == "ol" {
+			marker = "0"
+			if start, err := strconv.Atoi(attrValue(n, "start")); err == nil {
+				marker = strconv.Itoa(start - 1)
+			}
+		}
+		r.lists = append(r.lists, marker)
+		defer func() { r.lists = r.lists[:len(r.lists)-1] }()
+	case "li":
+		if len(r.lists) > 0 {
+			last := len(r.lists) - 1
+			r.marker = "- "
+			if num, err := strconv.Atoi(r.lists[last]); err == nil {
+				r.lists[last] = strconv.Itoa(num + 1)
+				r.marker = r.lists[last] + ". "
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+	r.flush()
+	if n.Data == "li" {
+		r.marker = "" // empty item
+	}
+}
+
+// space separates inline text, unless it's at the start of the line or separated already
+func (r *textRenderer) space() {
+	if last, _ := utf8.DecodeLastRuneInString(r.inline.String()); r.inline.Len() > 0 && !unicode.IsSpace(last) {
+		r.inline.WriteString(" ")
+	}
+}
+
+// flush adds collected inline text as a block
+func (r *textRenderer) flush() {
+	text := r.inline.String()
+	r.inline.Reset()
+	if r.pre == 0 {
+		lines := strings.Split(text, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimSpace(line)
+		}
+		text = strings.Trim(strings.Join(lines, "\n"), "\n")
+	} else {
+		text = strings.Trim(text, "\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	prefix := strings.Repeat("> ", r.quote)
+	if len(r.lists) > 1 {
+		prefix += strings.Repeat("  ", len(r.lists)-1)
+	}
+	r.blocks = append(r.blocks, textBlock{text: text, prefix: prefix, marker: r.marker, list: len(r.lists) > 0, pre: r.pre > 0})
+	r.marker = ""
+}
+
+// render returns lines of the block with prefix and marker, wrapped at width unless preformatted
+func (b textBlock) render(width int) string {
+	indent := strings.Repeat(" ", utf8.RuneCountInString(b.marker))
+	if b.list && b.marker == "" {
+		indent = "  " // next paragraphs of list item are aligned with its text
+	}
+	var lines []string
+	for _, line := range strings.Split(b.text, "\n") {
+		if b.pre || width <= 0 {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, wrapLine(line, width-utf8.RuneCountInString(b.prefix+indent))...)
+	}
+	for i := range lines {
+		lead := indent
+		if i == 0 && b.marker != "" {
+			lead = b.marker
+		}
+		lines[i] = strings.TrimRight(b.prefix+lead+lines[i], " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLine splits line into lines up to width characters at spaces. Words longer than width are kept whole,
+// except text of languages without spaces, which is split at any character.
+func wrapLine(line string, width int) []string {
+	width = max(width, MinTextWidth/2)
+	var res []string
+	var cur []rune
+	for _, word := range strings.Fields(line) {
+		w := []rune(word)
+		for len(w) > width && isCJK(w[0]) { // no spaces to wrap at
+			if len(cur) > 0 {
+				res, cur = append(res, string(cur)), nil
+			}
+			res, w = append(res, string(w[:width])), w[width:]
+		}
+		switch {
+		case len(w) == 0:
+			continue
+		case len(cur) == 0:
+			cur = w
+		case len(cur)+1+len(w) <= width:
+			cur = append(append(cur, ' '), w...)
+		default:
+			res, cur = append(res, string(cur)), w
+		}
+	}
+	if len(cur) > 0 {
+		res = append(res, string(cur))
+	}
+	return res
+}
+
+// commonPrefix returns the common quote prefix of two blocks, so quoted paragraphs are separated
+// by a line with quote mark only
+func commonPrefix(a, b string) string {
+	for !strings.HasPrefix(b, a) {
+		a = a[:len(a)-1]
+	}
+	return strings.TrimRight(a, " ")
+}
+
+// attrValue returns value of the attribute of the html node
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
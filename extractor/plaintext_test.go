@@ -0,0 +1,87 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructuredText(t *testing.T) {
+	tbl := []struct {
+		name  string
+		rich  string
+		width int
+		want  string
+	}{
+		{name: "paragraphs and headings", rich: "<h2>Part <b>one</b></h2>\n<p>First  paragraph\n of text.</p><div>Second one.</div>",
+			want: "Part one\n\nFirst paragraph of text.\n\nSecond one."},
+		{name: "title heading removed", rich: "<h1>Title</h1><p>Text.</p>", want: "Text."},
+		{name: "inline elements", rich: "<p>Some <a href='x'>link</a>, <em>emphasis</em><span> and</span> text.</p>",
+			want: "Some link, emphasis and text."},
+		{name: "line breaks", rich: "<p>Line one<br>line two<br/> line three</p>", want: "Line one\nline two\nline three"},
+		{name: "lists", rich: "<p>Before:</p><ul><li>one</li><li>two<ul><li>nested</li></ul></li></ul>" +
+			"<ol start=3><li>three</li><li><p>four</p><p>more of four</p></li></ol><p>After.</p>",
+			want: "Before:\n\n- one\n- two\n  - nested\n3. three\n4. four\n  more of four\n\nAfter."},
+		{name: "quotes", rich: "<p>He said:</p><blockquote><p>First.</p><p>Second.</p><blockquote>Nested.</blockquote></blockquote>",
+			want: "He said:\n\n> First.\n>\n> Second.\n>\n> > Nested."},
+		{name: "preformatted", rich: "<pre>func main() {\n\tfmt.Println(1)\n}</pre>", want: "func main() {\n\tfmt.Println(1)\n}"},
+		{name: "tables", rich: "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>", want: "a b\n\n1 2"},
+		{name: "media skipped", rich: "<p>Text.</p><figure><img src='a.jpg'><figcaption>Caption.</figcaption></figure><script>x()</script>",
+			want: "Text.\n\nCaption."},
+		{name: "wrapped", width: 20, rich: "<p>The quick brown fox jumps over the lazy dog.</p><ul><li>a list item wrapped as well</li></ul>",
+			want: "The quick brown fox\njumps over the lazy\ndog.\n\n- a list item\n  wrapped as well"},
+		{name: "wrapped quote", width: 20, rich: "<blockquote>The quick brown fox jumps over</blockquote>",
+			want: "> The quick brown\n> fox jumps over"},
+		{name: "wrapped cjk", width: 20, rich: "<p>这是一个很长的中文句子没有空格所以需要在任意字符处换行</p>",
+			want: "这是一个很长的中文句子没有空格所以需要在\n任意字符处换行"},
+		{name: "long word kept", width: 20, rich: "<p>see https://example.com/a/very/long/path here</p>",
+			want: "see\nhttps://example.com/a/very/long/path\nhere"},
+		{name: "empty", rich: "<p> </p><ul><li></li></ul>", want: ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, structuredText(tt.rich, "Title", tt.width))
+		})
+	}
+}
+
+func TestExtractTextFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		data, err := os.ReadFile("testdata/vsiem-mirom-dlia-obshchiei-polzy.html")
+		require.NoError(t, err)
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	structured, err := lr.Extract(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.Contains(t, structured.Content, "и всякое прочее. Он действительно незаменим")
+	assert.Contains(t, structured.Content, "справлялись без него.\n\nЭтот замечательный news.radio-t.com")
+
+	flat, err := lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{Text: TextFlat})
+	require.NoError(t, err)
+	assert.Len(t, flat.Content, 9665, "the same as before structured text")
+	assert.NotContains(t, flat.Content, "\n")
+	assert.Equal(t, strings.Join(strings.Fields(flat.Content), " ")[:200], strings.Join(strings.Fields(structured.Content), " ")[:200])
+
+	wrapped, err := lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{TextWidth: 60})
+	require.NoError(t, err)
+	lines := strings.Split(wrapped.Content, "\n")
+	assert.Greater(t, len(lines), len(strings.Split(structured.Content, "\n")))
+	for _, line := range lines[:5] { // preformatted blocks further are not wrapped
+		assert.LessOrEqual(t, len([]rune(line)), 60, "%q", line)
+	}
+
+	_, err = lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{Text: "markdown"})
+	require.EqualError(t, err, `unknown text format "markdown"`)
+	_, err = lr.ExtractWithOptions(context.Background(), ts.URL, ExtractOptions{TextWidth: 10})
+	require.EqualError(t, err, "text width 10 is less than 20")
+}
@@ -0,0 +1,243 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ErrForbiddenTarget is returned when an outbound request is rejected by OutboundPolicy
+var ErrForbiddenTarget = errors.New("forbidden outbound target")
+
+// OutboundPolicy restricts where the service is allowed to send requests for pages and images.
+// By default only http and https to public addresses are allowed. The check is done on the requested URL
+// and again at dial time against the resolved address, so redirects and DNS rebinding can't reach internal hosts.
+type OutboundPolicy struct {
+	AllowPrivate bool     // allow loopback, private, link-local and other non-public addresses
+	AllowHosts   []string // host names or CIDRs always allowed, a host name matches its subdomains too
+	DenyHosts    []string // host names or CIDRs always denied, takes precedence over AllowHosts
+
+	once       sync.Once
+	allowNets  []netip.Prefix
+	denyNets   []netip.Prefix
+	allowNames []string
+	denyNames  []string
+}
+
+// nonPublicNets lists special-purpose ranges not covered by netip.Addr helpers
+var nonPublicNets = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, can map to any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+	netip.MustParsePrefix("2002::/16"),       // 6to4, embeds IPv4 address
+	netip.MustParsePrefix("2001::/32"),       // teredo, embeds IPv4 address
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+}
+
+func (p *OutboundPolicy) init() {
+	p.once.Do(func() {
+		p.allowNets, p.allowNames = parseHostList(p.AllowHosts)
+		p.denyNets, p.denyNames = parseHostList(p.DenyHosts)
+	})
+}
+
+// parseHostList splits entries into CIDRs (single IPs become /32 or /128) and normalized host names
+func parseHostList(entries []string) (nets []netip.Prefix, names []string) {
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if pfx, err := netip.ParsePrefix(e); err == nil {
+			nets = append(nets, pfx.Masked())
+			continue
+		}
+		if ip, err := netip.ParseAddr(e); err == nil {
+			ip = ip.Unmap()
+			nets = append(nets, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		names = append(names, strings.TrimPrefix(strings.TrimSuffix(e, "."), "*."))
+	}
+	return nets, names
+}
+
+// CheckURL verifies scheme and host of the URL. Host names are checked against allow and deny lists only,
+// resolved addresses are verified at dial time by the transport made with Transport.
+func (p *OutboundPolicy) CheckURL(u *url.URL) error {
+	if p == nil {
+		return nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrForbiddenTarget, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrForbiddenTarget)
+	}
+	allowed, err := p.checkHost(host)
+	if err != nil {
+		return err
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.checkIP(ip, allowed)
+	}
+	return nil
+}
+
+// CheckRequestURL parses and verifies raw URL, see CheckURL
+func (p *OutboundPolicy) CheckRequestURL(rawURL string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenTarget, err)
+	}
+	return p.CheckURL(u)
+}
+
+// checkHost matches host name against deny and allow lists. returns true if the host is explicitly allowed.
+func (p *OutboundPolicy) checkHost(host string) (allowed bool, err error) {
+	p.init()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if matchHostName(host, p.denyNames) {
+		return false, fmt.Errorf("%w: host %s is denied", ErrForbiddenTarget, host)
+	}
+	return matchHostName(host, p.allowNames), nil
+}
+
+// checkIP verifies address against deny and allow lists, then rejects non-public addresses unless allowed
+func (p *OutboundPolicy) checkIP(ip netip.Addr, hostAllowed bool) error {
+	p.init()
+	ip = ip.Unmap()
+	for _, pfx := range p.denyNets {
+		if pfx.Contains(ip) {
+			return fmt.Errorf("%w: address %s is denied", ErrForbiddenTarget, ip)
+		}
+	}
+	if hostAllowed || p.AllowPrivate {
+		return nil
+	}
+	for _, pfx := range p.allowNets {
+		if pfx.Contains(ip) {
+			return nil
+		}
+	}
+	if !isPublicIP(ip) {
+		return fmt.Errorf("%w: address %s is not public", ErrForbiddenTarget, ip)
+	}
+	return nil
+}
+
+// Transport returns a clone of base transport with dial-time address checks. extraAllowed hosts, e.g. a proxy,
+// are allowed without checks. Requests sent through a proxy of base transport are not dialled to the target,
+// so the target host is resolved and its addresses are checked before every request, redirects included.
+// nil policy returns base as is.
+func (p *OutboundPolicy) Transport(base *http.Transport, extraAllowed ...string) *http.Transport {
+	if p == nil {
+		return base
+	}
+	transport := base.Clone()
+	if proxy := transport.Proxy; proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := proxy(req)
+			if err != nil || proxyURL == nil {
+				return proxyURL, err
+			}
+			if err = p.checkResolved(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			return proxyURL, nil
+		}
+	}
+	dialer := &net.Dialer{Timeout: httpDefaultTimeout, KeepAlive: httpDefaultTimeout}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range extraAllowed {
+			if strings.EqualFold(h, host) {
+				return dialer.DialContext(ctx, network, addr)
+			}
+		}
+		allowed, err := p.checkHost(host)
+		if err != nil {
+			return nil, err
+		}
+		d := *dialer
+		d.Control = func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrForbiddenTarget, err)
+			}
+			return p.checkIP(ap.Addr(), allowed)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// checkResolved resolves host and verifies all its addresses, for requests where the connection to the target
+// is made by a proxy. The proxy resolves the host again, so unlike dial-time checks it doesn't cover DNS rebinding.
+func (p *OutboundPolicy) checkResolved(ctx context.Context, host string) error {
+	allowed, err := p.checkHost(host)
+	if err != nil {
+		return err
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.checkIP(ip, allowed)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: resolve %s: %w", ErrForbiddenTarget, host, err)
+	}
+	for _, ip := range addrs {
+		if err := p.checkIP(ip, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchHostName(host string, names []string) bool {
+	for _, n := range names {
+		if host == n || strings.HasSuffix(host, "."+n) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, pfx := range nonPublicNets {
+		if pfx.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboundPolicy_CheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *OutboundPolicy
+		url     string
+		wantErr bool
+	}{
+		{name: "nil policy allows everything", policy: nil, url: "ftp://127.0.0.1/x"},
+		{name: "public host", policy: &OutboundPolicy{}, url: "https://example.com/page"},
+		{name: "public ip", policy: &OutboundPolicy{}, url: "http://93.184.216.34/"},
+		{name: "ftp scheme", policy: &OutboundPolicy{}, url: "ftp://example.com/file", wantErr: true},
+		{name: "file scheme", policy: &OutboundPolicy{}, url: "file:///etc/passwd", wantErr: true},
+		{name: "loopback", policy: &OutboundPolicy{}, url: "http://127.0.0.1:8080/", wantErr: true},
+		{name: "metadata", policy: &OutboundPolicy{}, url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{name: "private", policy: &OutboundPolicy{}, url: "http://10.1.2.3/", wantErr: true},
+		{name: "ipv6 loopback", policy: &OutboundPolicy{}, url: "http://[::1]/", wantErr: true},
+		{name: "ipv4-mapped loopback", policy: &OutboundPolicy{}, url: "http://[::ffff:127.0.0.1]/", wantErr: true},
+		{name: "cgnat", policy: &OutboundPolicy{}, url: "http://100.64.1.1/", wantErr: true},
+		{name: "empty host", policy: &OutboundPolicy{}, url: "http:///path", wantErr: true},
+		{name: "private allowed", policy: &OutboundPolicy{AllowPrivate: true}, url: "http://10.1.2.3/"},
+		{name: "cidr allowed", policy: &OutboundPolicy{AllowHosts: []string{"10.0.0.0/8"}}, url: "http://10.1.2.3/"},
+		{name: "ip allowed", policy: &OutboundPolicy{AllowHosts: []string{"10.1.2.3"}}, url: "http://10.1.2.3/"},
+		{name: "other ip not allowed", policy: &OutboundPolicy{AllowHosts: []string{"10.1.2.3"}}, url: "http://10.1.2.4/", wantErr: true},
+		{name: "denied host", policy: &OutboundPolicy{DenyHosts: []string{"example.com"}}, url: "https://example.com/", wantErr: true},
+		{name: "denied subdomain", policy: &OutboundPolicy{DenyHosts: []string{"example.com"}}, url: "https://www.Example.com./", wantErr: true},
+		{name: "similar host not denied", policy: &OutboundPolicy{DenyHosts: []string{"example.com"}}, url: "https://myexample.com/"},
+		{name: "denied cidr", policy: &OutboundPolicy{DenyHosts: []string{"93.184.0.0/16"}}, url: "http://93.184.216.34/", wantErr: true},
+		{name: "deny wins over allow", policy: &OutboundPolicy{AllowHosts: []string{"10.0.0.0/8"}, DenyHosts: []string{"10.1.0.0/16"}},
+			url: "http://10.1.2.3/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			err = tt.policy.CheckURL(u)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrForbiddenTarget)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, ip := range []string{"8.8.8.8", "93.184.216.34", "2606:4700:4700::1111"} {
+		assert.True(t, isPublicIP(netip.MustParseAddr(ip)), ip)
+	}
+	for _, ip := range []string{"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0",
+		"100.64.0.1", "255.255.255.255", "224.0.0.1", "::1", "fe80::1", "fc00::1", "64:ff9b::7f00:1", "::ffff:10.0.0.1"} {
+		assert.False(t, isPublicIP(netip.MustParseAddr(ip)), ip)
+	}
+}
+
+func TestHTTPRetriever_Policy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer ts.Close()
+	port := ts.URL[strings.LastIndex(ts.URL, ":")+1:]
+
+	t.Run("loopback blocked by default", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Policy: &OutboundPolicy{}}
+		_, err := r.Retrieve(context.Background(), ts.URL)
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+
+	t.Run("host name resolved to loopback blocked at dial time", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Policy: &OutboundPolicy{}}
+		_, err := r.Retrieve(context.Background(), "http://localhost:"+port)
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+
+	t.Run("loopback allowed explicitly", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Policy: &OutboundPolicy{AllowHosts: []string{"127.0.0.0/8"}}}
+		res, err := r.Retrieve(context.Background(), ts.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "internal", string(res.Body))
+	})
+
+	t.Run("redirect to denied host blocked", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Policy: &OutboundPolicy{AllowPrivate: true, DenyHosts: []string{"localhost"}}}
+		_, err := r.Retrieve(context.Background(), ts.URL+"/redirect?to=http://localhost:"+port+"/x")
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+
+	t.Run("redirect to non-http scheme blocked", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Policy: &OutboundPolicy{AllowPrivate: true}}
+		_, err := r.Retrieve(context.Background(), ts.URL+"/redirect?to=file:///etc/passwd")
+		require.Error(t, err)
+	})
+}
+
+func TestHTTPRetriever_PolicyWithProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	t.Run("target resolved to loopback blocked", func(t *testing.T) {
+		proxied.Store(0)
+		r := &HTTPRetriever{Timeout: time.Second, Proxy: proxy.URL, Policy: &OutboundPolicy{}}
+		_, err := r.Retrieve(context.Background(), "http://localhost/admin")
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+		assert.Zero(t, proxied.Load(), "request is not sent to the proxy")
+	})
+
+	t.Run("redirect to target resolved to loopback blocked", func(t *testing.T) {
+		proxied.Store(0)
+		r := &HTTPRetriever{Timeout: time.Second, Proxy: proxy.URL, Policy: &OutboundPolicy{AllowHosts: []string{"127.0.0.2"}}}
+		_, err := r.Retrieve(context.Background(), "http://127.0.0.2/redirect?to=http://localhost/admin")
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+		assert.Equal(t, int32(1), proxied.Load(), "only the first request is sent to the proxy")
+	})
+
+	t.Run("allowed target fetched through proxy", func(t *testing.T) {
+		r := &HTTPRetriever{Timeout: time.Second, Proxy: proxy.URL, Policy: &OutboundPolicy{AllowHosts: []string{"localhost"}}}
+		res, err := r.Retrieve(context.Background(), "http://localhost/page")
+		require.NoError(t, err)
+		assert.Equal(t, "via proxy", string(res.Body))
+	})
+}
+
+func TestExtractWithPolicy(t *testing.T) {
+	var imageHits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pic.png" {
+			imageHits.Add(1)
+			_, _ = w.Write([]byte("png"))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>t</title></head><body><article><p>text</p>` +
+			`<img src="http://127.0.0.1:` + r.Host[strings.LastIndex(r.Host, ":")+1:] + `/pic.png"></article></body></html>`))
+	}))
+	defer ts.Close()
+
+	t.Run("page blocked", func(t *testing.T) {
+		lr := UReadability{TimeOut: time.Second, SnippetSize: 200, Policy: &OutboundPolicy{}}
+		_, err := lr.Extract(context.Background(), ts.URL)
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+
+	t.Run("page blocked for custom retriever", func(t *testing.T) {
+		mock := &RetrieverMock{RetrieveFunc: func(context.Context, string) (*RetrieveResult, error) {
+			t.Fatal("retriever should not be called")
+			return nil, nil
+		}}
+		lr := UReadability{TimeOut: time.Second, SnippetSize: 200, Retriever: mock, Policy: &OutboundPolicy{}}
+		_, err := lr.Extract(context.Background(), "http://169.254.169.254/latest/meta-data")
+		require.ErrorIs(t, err, ErrForbiddenTarget)
+	})
+
+	t.Run("images on private addresses are not fetched", func(t *testing.T) {
+		// page fetched through mock retriever, images go through the policy-restricted image client
+		mock := &RetrieverMock{RetrieveFunc: func(ctx context.Context, _ string) (*RetrieveResult, error) {
+			return (&HTTPRetriever{}).Retrieve(ctx, ts.URL)
+		}}
+		lr := UReadability{TimeOut: time.Second, SnippetSize: 200, Retriever: mock, Policy: &OutboundPolicy{}}
+		res, err := lr.Extract(context.Background(), "https://example.com/page")
+		require.NoError(t, err)
+		assert.Len(t, res.AllImages, 1)
+		assert.Zero(t, imageHits.Load())
+	})
+}
@@ -3,7 +3,9 @@ package extractor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -14,8 +16,13 @@ import (
 	log "github.com/go-pkgz/lgr"
 	"github.com/mauidude/go-readability"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
 //go:generate moq -out mocks/rules.go -pkg mocks -skip-ensure -fmt goimports . Rules
@@ -27,19 +34,33 @@ type Rules interface {
 	Save(ctx context.Context, rule datastore.Rule) (datastore.Rule, error)
 	Disable(ctx context.Context, id bson.ObjectID) error
 	All(ctx context.Context) []datastore.Rule
+	List(ctx context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error)
+	Users(ctx context.Context) []string
+	SetHealth(ctx context.Context, id bson.ObjectID, health datastore.RuleHealth) error
 }
 
 // UReadability implements fetcher & extractor for local readability-like functionality
 type UReadability struct {
-	TimeOut     time.Duration
-	SnippetSize int
-	Rules       Rules
-	Retriever   Retriever // default retriever; when nil a cached HTTPRetriever is used
-	CFRetriever Retriever // optional Cloudflare Browser Rendering retriever; when set, enables routing
-	CFRouteAll  bool      // route every request through CFRetriever (requires CFRetriever != nil)
+	TimeOut        time.Duration
+	SnippetSize    int // max size of Response.Excerpt in characters; defaults to DefaultSnippetSize
+	Rules          Rules
+	Retriever      Retriever       // default retriever; when nil a cached HTTPRetriever is used
+	CFRetriever    Retriever       // optional Cloudflare Browser Rendering retriever; when set, enables routing
+	CFRouteAll     bool            // route every request through CFRetriever (requires CFRetriever != nil)
+	Policy         *OutboundPolicy // restricts fetched pages and images; nil allows everything
+	MaxImageSize   int64           // max size of probed image in bytes, bigger images are skipped; defaults to DefaultMaxImageSize
+	MaxPages       int             // max pages of multi-page article to stitch together, 1 or less disables following pages
+	Sanitizer      *SanitizePolicy // cleans up Response.Rich; nil sanitizes with the default level
+	MaxArchiveSize int64           // max total size of images of archived article in bytes; defaults to DefaultMaxArchiveSize
+	ImageProxy     *ImageProxy     // proxies images of the response with ExtractOptions.ProxyImages; nil disables proxying
 
 	defaultRetrieverOnce sync.Once
 	defaultRetriever     Retriever
+	imageClientOnce      sync.Once
+	imageClient          *http.Client
+	healthMu             sync.Mutex
+	healthSaved          map[bson.ObjectID]datastore.RuleHealth // last health written for each rule, throttles writes
+	background           sync.WaitGroup                         // rule health writes running after the response
 }
 
 // retriever returns the configured default Retriever, creating a cached HTTPRetriever if nil
@@ -48,7 +69,7 @@ func (f *UReadability) retriever() Retriever {
 		return f.Retriever
 	}
 	f.defaultRetrieverOnce.Do(func() {
-		f.defaultRetriever = &HTTPRetriever{Timeout: f.TimeOut}
+		f.defaultRetriever = &HTTPRetriever{Timeout: f.TimeOut, Policy: f.Policy}
 	})
 	return f.defaultRetriever
 }
@@ -71,73 +92,213 @@ func (f *UReadability) pickRetriever(rule *datastore.Rule) Retriever {
 
 // Response from api calls
 type Response struct {
-	Content     string   `json:"content"`
-	Rich        string   `json:"rich_content"`
-	Domain      string   `json:"domain"`
-	URL         string   `json:"url"`
-	Title       string   `json:"title"`
-	Excerpt     string   `json:"excerpt"`
-	Image       string   `json:"lead_image_url"`
-	AllImages   []string `json:"images"`
-	AllLinks    []string `json:"links"`
-	ContentType string   `json:"type"`
-	Charset     string   `json:"charset"`
+	Content     string            `json:"content"` // plain text, structured or flat with ExtractOptions.Text
+	Rich        string            `json:"rich_content"`
+	Domain      string            `json:"domain"`
+	URL         string            `json:"url"`
+	Title       string            `json:"title"`
+	Excerpt     string            `json:"excerpt"`
+	Image       string            `json:"lead_image_url"`
+	AllImages   []string          `json:"images"`
+	AllLinks    []string          `json:"links"`
+	Anchors     []Anchor          `json:"anchors,omitempty"` // links of the article with their text and rel
+	ContentType string            `json:"type"`
+	Charset     string            `json:"charset"`
+	WordCount   int               `json:"word_count"`            // words of content, chinese and japanese characters counted as words
+	CharCount   int               `json:"char_count"`            // characters of content, not counting spaces
+	ReadingTime int               `json:"reading_time"`          // estimated reading time in minutes
+	Language    string            `json:"language,omitempty"`    // code like "en", declared by the page or detected from the text
+	PageCount   int               `json:"page_count,omitempty"`  // number of pages, set for PDF documents
+	Metadata    map[string]string `json:"metadata,omitempty"`    // author and dates from meta tags of pages, document info of PDF documents
+	NextPages   []string          `json:"next_pages,omitempty"`  // urls of the following pages stitched into content
+	Archive     *Archive          `json:"archive,omitempty"`     // self-contained copy, set with ExtractOptions.Archive
+	Diagnostics *Diagnostics      `json:"diagnostics,omitempty"` // how the result was produced, set in debug mode
 }
 
+// ExtractOptions defines per-request extraction options
+type ExtractOptions struct {
+	Rule        *datastore.Rule // rule to use instead of looking it up by domain
+	Debug       bool            // fill Response.Diagnostics explaining the result
+	ProxyImages bool            // rewrite images of rich content, Image and AllImages to ImageProxy urls, if configured
+	Archive     string          // make self-contained article, ArchiveInline or ArchiveZip; disabled if empty
+	SnippetSize int             // max size of Response.Excerpt overriding UReadability.SnippetSize, up to MaxSnippetSize; 0 for default
+	Text        string          // format of Response.Content, TextStructured if empty or TextFlat
+	TextWidth   int             // wrap structured Response.Content at this width, at least MinTextWidth; not wrapped if 0
+}
+
+var tracer = otel.Tracer("github.com/ukeeper/ukeeper-readability/extractor")
+
 var (
-	reLinks  = regexp.MustCompile(`(href|src|action|background)="([^"]*)"`)
 	reSpaces = regexp.MustCompile(`\s+`)
 	reDot    = regexp.MustCompile(`\D(\.)\S`)
 )
 
 const (
 	userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Safari/605.1.15"
+
+	ruleHealthInterval = time.Minute      // unchanged health of a rule is written not more often
+	ruleHealthTimeout  = 10 * time.Second // timeout of writing rule health in background
 )
 
 // Extract fetches page and retrieves article
 func (f *UReadability) Extract(ctx context.Context, reqURL string) (*Response, error) {
-	return f.extractWithRules(ctx, reqURL, nil)
+	return f.extractWithRules(ctx, reqURL, ExtractOptions{})
 }
 
 // ExtractByRule fetches page and retrieves article using a specific rule
 func (f *UReadability) ExtractByRule(ctx context.Context, reqURL string, rule *datastore.Rule) (*Response, error) {
-	return f.extractWithRules(ctx, reqURL, rule)
+	return f.extractWithRules(ctx, reqURL, ExtractOptions{Rule: rule})
+}
+
+// ExtractWithOptions fetches page and retrieves article with per-request options
+func (f *UReadability) ExtractWithOptions(ctx context.Context, reqURL string, opts ExtractOptions) (*Response, error) {
+	if opts.Archive != "" && opts.Archive != ArchiveInline && opts.Archive != ArchiveZip {
+		return nil, fmt.Errorf("unknown archive mode %q", opts.Archive)
+	}
+	if opts.SnippetSize < 0 || opts.SnippetSize > MaxSnippetSize {
+		return nil, fmt.Errorf("snippet size %d is out of range 0-%d, 0 for default", opts.SnippetSize, MaxSnippetSize)
+	}
+	if opts.Text != "" && opts.Text != TextStructured && opts.Text != TextFlat {
+		return nil, fmt.Errorf("unknown text format %q", opts.Text)
+	}
+	if opts.TextWidth < 0 || (opts.TextWidth > 0 && opts.TextWidth < MinTextWidth) {
+		return nil, fmt.Errorf("text width %d is less than %d", opts.TextWidth, MinTextWidth)
+	}
+	if opts.TextWidth > 0 && opts.Text == TextFlat {
+		return nil, errors.New("text width can't be used with flat text")
+	}
+	if opts.Debug {
+		ctx = withDiagnostics(ctx, &Diagnostics{})
+	}
+	rb, err := f.extractWithRules(ctx, reqURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Archive != "" {
+		f.archive(ctx, rb, opts.Archive)
+	}
+	if opts.ProxyImages && f.ImageProxy != nil { // images failed to archive are proxied
+		f.ImageProxy.rewrite(rb)
+	}
+	return rb, nil
+}
+
+// FetchPage fetches page the same way extraction does, with the retriever and request options of the rule,
+// looking the rule up by domain if not passed. Returns final url and page body converted to utf-8.
+func (f *UReadability) FetchPage(ctx context.Context, reqURL string, rule *datastore.Rule) (finalURL, body string, err error) {
+	if rule == nil && f.Rules != nil {
+		if r, found := f.Rules.Get(ctx, reqURL); found {
+			rule = &r
+		}
+	}
+	ctx = withRuleOptions(ctx, rule)
+	if err = f.Policy.CheckRequestURL(reqURL); err != nil {
+		return "", "", err
+	}
+	result, err := f.pickRetriever(rule).Retrieve(ctx, reqURL)
+	if err != nil {
+		return "", "", err
+	}
+	if isPDF(result.Header, result.Body) {
+		return "", "", fmt.Errorf("%s is a pdf document", reqURL)
+	}
+	_, _, body = f.toUtf8(result.Body, result.Header)
+	return result.URL, body, nil
+}
+
+// withRuleOptions adds request options of the rule, as the rule can override user-agent, headers and cookies
+// used to fetch the page
+func withRuleOptions(ctx context.Context, rule *datastore.Rule) context.Context {
+	if rule == nil {
+		return ctx
+	}
+	return WithRequestOptions(ctx, RequestOptions{
+		UserAgent: rule.UserAgent,
+		Headers:   parseHeaders(rule.Headers),
+		Cookies:   parseCookies(rule.Cookies),
+	})
 }
 
 // ExtractWithRules is the core function that handles extraction with or without a specific rule
-func (f *UReadability) extractWithRules(ctx context.Context, reqURL string, rule *datastore.Rule) (*Response, error) {
+func (f *UReadability) extractWithRules(ctx context.Context, reqURL string, opts ExtractOptions) (rb *Response, err error) {
 	log.Printf("[INFO] extract %s", reqURL)
-	rb := &Response{}
+	diag := diagnostics(ctx)
+	ctx, span := tracer.Start(ctx, "extract", trace.WithAttributes(attribute.String("url.full", reqURL),
+		attribute.String("server.address", urlDomain(reqURL))))
+	started, retrieverName := time.Now(), "none"
+	defer func() {
+		metrics.ObserveExtract(retrieverName, extractOutcome(err), time.Since(started))
+		span.SetAttributes(attribute.String("extract.retriever", retrieverName), attribute.String("extract.outcome", extractOutcome(err)))
+		endSpan(span, err)
+	}()
+	rb = &Response{Diagnostics: diag}
+	rule := opts.Rule
+	ruleProvided := rule != nil
 
 	// look up a rule by domain once up front (unless one was explicitly passed) so retriever
 	// selection and getContent share the same lookup instead of paying for two round-trips.
 	if rule == nil && f.Rules != nil {
-		if r, found := f.Rules.Get(ctx, reqURL); found {
+		lookupCtx, lookupSpan := tracer.Start(ctx, "extract.rule_lookup")
+		lookupStarted := time.Now()
+		if r, found := f.Rules.Get(lookupCtx, reqURL); found {
 			rule = &r
 		}
+		diag.stage("rule_lookup", lookupStarted)
+		lookupSpan.SetAttributes(attribute.Bool("rule.found", rule != nil))
+		lookupSpan.End()
 	}
+	f.diagnoseRule(ctx, diag, reqURL, rule, ruleProvided)
 
-	result, err := f.pickRetriever(rule).Retrieve(ctx, reqURL)
+	ctx = withRuleOptions(ctx, rule)
+
+	// checked here as well as in HTTPRetriever, as other retrievers don't dial the target themselves
+	if err := f.Policy.CheckRequestURL(reqURL); err != nil {
+		log.Printf("[WARN] refused to extract %s, error=%v", reqURL, err)
+		return nil, err
+	}
+
+	retriever := f.pickRetriever(rule)
+	retrieverName = retrieverLabel(retriever)
+	if diag != nil {
+		diag.Retriever = retrieverName
+	}
+	retrieveStarted := time.Now()
+	result, err := retriever.Retrieve(ctx, reqURL)
+	diag.stage("retrieve", retrieveStarted)
 	if err != nil {
 		return nil, err
 	}
 
 	rb.URL = result.URL
 
+	if isPDF(result.Header, result.Body) {
+		return f.extractPDF(ctx, rb, result.Body, opts)
+	}
+
 	var body string
-	rb.ContentType, rb.Charset, body = f.toUtf8(result.Body, result.Header)
-	rb.Content, rb.Rich, err = f.getContent(ctx, body, reqURL, rule)
+	var charsetInfo CharsetDiagnostics
+	_, charsetSpan := tracer.Start(ctx, "extract.charset")
+	charsetStarted := time.Now()
+	rb.ContentType, rb.Charset, body, charsetInfo = f.decodeBody(result.Body, result.Header)
+	diag.stage("charset", charsetStarted)
+	diag.charset(charsetInfo)
+	charsetSpan.SetAttributes(attribute.String("extract.charset", rb.Charset))
+	charsetSpan.End()
+
+	// lazy-loaded media is resolved in the same document, before the content is extracted
+	dbody, body, err := parsePage(body)
 	if err != nil {
-		log.Printf("[WARN] failed to parse %s, error=%v", reqURL, err)
 		return nil, err
 	}
 
-	dbody, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	rb.Content, rb.Rich, err = f.getContent(ctx, body, reqURL, rule)
 	if err != nil {
+		log.Printf("[WARN] failed to parse %s, error=%v", reqURL, err)
 		return nil, err
 	}
 
 	rb.Title = dbody.Find("title").First().Text()
+	rb.Metadata = pageMetadata(dbody)
 
 	finalURL, err := url.Parse(rb.URL)
 	if err != nil {
@@ -145,27 +306,205 @@ func (f *UReadability) extractWithRules(ctx context.Context, reqURL string, rule
 	}
 	rb.Domain = finalURL.Host
 
-	rb.Content = f.getText(rb.Content, rb.Title)
-	rb.Rich, rb.AllLinks = f.normalizeLinks(rb.Rich, finalURL)
-	rb.Excerpt = f.getSnippet(rb.Content)
+	if opts.Text == TextFlat { // structured text is made of sanitized rich content below
+		rb.Content = f.getText(rb.Content, rb.Title)
+	}
+	_, linksSpan := tracer.Start(ctx, "extract.normalize_links")
+	linksStarted := time.Now()
+	rb.Rich, rb.AllLinks, rb.Anchors = f.normalizeLinks(rb.Rich, documentBase(dbody, finalURL))
+	diag.stage("normalize_links", linksStarted)
+	linksSpan.SetAttributes(attribute.Int("extract.links", len(rb.AllLinks)))
+	linksSpan.End()
+	for _, page := range f.followPages(withDiagnostics(ctx, nil), body, rb.Rich, finalURL, rule) {
+		if opts.Text == TextFlat {
+			rb.Content += " " + f.getText(page.rich, "")
+		}
+		rb.Rich += "\n" + page.rich
+		rb.AllLinks = append(rb.AllLinks, page.links...)
+		rb.Anchors = append(rb.Anchors, page.anchors...)
+		rb.NextPages = append(rb.NextPages, page.url)
+	}
+	// excerpt is made before sanitizing, as classes of bylines and captions are removed by the default policy
+	rb.Excerpt = makeExcerpt(rb.Rich, rb.Content, rb.Title, pageDescriptions(dbody), f.snippetSize(opts.SnippetSize))
+	sanitizeStarted := time.Now()
+	rb.Rich = f.Sanitizer.Sanitize(rb.Rich)
+	diag.stage("sanitize", sanitizeStarted)
+	if opts.Text != TextFlat {
+		rb.Content = structuredText(rb.Rich, rb.Title, opts.TextWidth)
+	}
 	darticle, err := goquery.NewDocumentFromReader(strings.NewReader(rb.Rich))
 	if err != nil {
 		log.Printf("[WARN] failed to create document from reader, error=%v", err)
 		return nil, err
 	}
-	if im, allImages, ok := f.extractPics(darticle.Find("img"), reqURL); ok {
+	setStats(rb, articleText(darticle, rb.Title), pageLanguage(dbody))
+	imagesStarted := time.Now()
+	if im, allImages, ok := f.extractPics(ctx, darticle.Find("img"), reqURL); ok {
 		rb.Image = im
 		rb.AllImages = allImages
 	}
+	diag.stage("images", imagesStarted)
 
 	log.Printf("[INFO] completed for %s, url=%s", rb.Title, rb.URL)
 	return rb, nil
 }
 
+// diagnoseRule records rule selection in diagnostics, explaining why no rule matched
+func (f *UReadability) diagnoseRule(ctx context.Context, diag *Diagnostics, reqURL string, rule *datastore.Rule, provided bool) {
+	if diag == nil {
+		return
+	}
+	if rule != nil {
+		diag.Rule = RuleDiagnostics{Matched: true, Domain: rule.Domain, Content: rule.Content, Source: "lookup"}
+		if provided {
+			diag.Rule.Source = "request"
+		}
+		if !rule.ID.IsZero() {
+			diag.Rule.ID = rule.ID.Hex()
+		}
+		return
+	}
+	if f.Rules == nil {
+		diag.Rule.Reason = "rules storage is not configured"
+		return
+	}
+	host := urlDomain(reqURL)
+	if u, err := url.Parse(reqURL); err == nil {
+		host = u.Host // rules are matched by host, including port
+	}
+	diag.Rule.Reason = "no enabled rule for domain " + host
+	disabled := false
+	if _, total, err := f.Rules.List(ctx, datastore.RulesQuery{Domain: host, Enabled: &disabled, PageSize: 1}); err == nil && total > 0 {
+		diag.Rule.Reason = "rule for domain " + host + " is disabled"
+	}
+}
+
+// retrieverLabel returns retriever name used in metrics
+func retrieverLabel(r Retriever) string {
+	switch r.(type) {
+	case *HTTPRetriever:
+		return "http"
+	case *CloudflareRetriever:
+		return "cloudflare"
+	default:
+		return "custom"
+	}
+}
+
+// endSpan records error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// extractOutcome classifies extraction error for metrics
+func extractOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrForbiddenTarget):
+		return "forbidden"
+	case errors.Is(err, ErrContentTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrUnsupportedContent):
+		return "unsupported"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// ruleID returns hex id of the stored rule, empty for rules not saved yet
+func ruleID(rule *datastore.Rule) string {
+	if rule == nil || rule.ID.IsZero() {
+		return ""
+	}
+	return rule.ID.Hex()
+}
+
+// urlDomain returns lowercased host of the url, "unknown" if it can't be parsed
+func urlDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// extractPDF fills response from PDF document, rules and readability are not applicable to PDF
+func (f *UReadability) extractPDF(ctx context.Context, rb *Response, body []byte, opts ExtractOptions) (*Response, error) {
+	_, span := tracer.Start(ctx, "extract.pdf")
+	diag, started := diagnostics(ctx), time.Now()
+	doc, err := parsePDF(body)
+	diag.stage("pdf", started)
+	diag.parser("pdf", nil)
+	if doc != nil {
+		span.SetAttributes(attribute.Int("pdf.pages", doc.PageCount))
+	}
+	endSpan(span, err)
+	if err != nil {
+		log.Printf("[WARN] failed to parse pdf %s, error=%v", rb.URL, err)
+		return nil, err
+	}
+	finalURL, err := url.Parse(rb.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse final URL %q: %w", rb.URL, err)
+	}
+	rb.Domain = finalURL.Host
+	rb.ContentType = PDFContentType
+	rb.Title = doc.Title
+	rb.Rich = f.Sanitizer.Sanitize(doc.Rich)
+	rb.Content = doc.Text
+	rb.Excerpt = makeExcerpt(rb.Rich, rb.Content, rb.Title, nil, f.snippetSize(opts.SnippetSize))
+	if opts.Text != TextFlat {
+		rb.Content = structuredText(rb.Rich, "", opts.TextWidth)
+	}
+	setStats(rb, doc.Text, "")
+	rb.PageCount = doc.PageCount
+	rb.Metadata = doc.Metadata
+	log.Printf("[INFO] completed pdf for %s, url=%s, pages=%d", rb.Title, rb.URL, rb.PageCount)
+	return rb, nil
+}
+
 // getContent retrieves content from raw body string, both content (text only) and rich (with html tags).
 // if rule is provided, it tries the custom rule first and falls back to the general parser on failure.
-// rule lookup for a given URL is done upstream in extractWithRules.
-func (f *UReadability) getContent(_ context.Context, body, reqURL string, rule *datastore.Rule) (content, rich string, err error) {
+// rule lookup for a given URL is done upstream in extractWithRules. Outcome of the rule is recorded in
+// its health, metrics and diagnostics.
+func (f *UReadability) getContent(ctx context.Context, body, reqURL string, rule *datastore.Rule) (content, rich string, err error) {
+	_, span := tracer.Start(ctx, "extract.parse")
+	diag, started := diagnostics(ctx), time.Now()
+	defer func() {
+		diag.stage("parse", started)
+		endSpan(span, err)
+	}()
+
+	content, rich, ruleErr, err := f.parseContent(body, reqURL, rule)
+	parser := metrics.RuleNone
+	switch {
+	case rule != nil && ruleErr == nil:
+		parser = metrics.RuleHit
+	case rule != nil:
+		parser = metrics.RuleFallback
+	}
+	if rule != nil {
+		f.recordHealth(ctx, rule, ruleErr)
+	}
+	metrics.ObserveRule(ruleID(rule), parser)
+	diag.parser(parser, ruleErr)
+	span.SetAttributes(attribute.String("extract.parser", parser))
+	if parser != metrics.RuleHit {
+		diag.candidates(body)
+	}
+	return content, rich, err
+}
+
+// parseContent retrieves content the same way as getContent, returning error of the rule the general parser
+// fell back from as ruleErr. Nothing is recorded, so it's used for the following pages of an article.
+func (f *UReadability) parseContent(body, reqURL string, rule *datastore.Rule) (content, rich string, ruleErr, err error) {
 	// general parser
 	genParser := func(body, _ string) (content, rich string, err error) {
 		doc, err := readability.NewDocument(body)
@@ -176,13 +515,18 @@ func (f *UReadability) getContent(_ context.Context, body, reqURL string, rule *
 		return content, rich, nil
 	}
 
-	// custom rules parser
+	// custom rules parser, excluded elements are removed before content is selected
 	customParser := func(body, reqURL string, rule datastore.Rule) (content, rich string, err error) {
 		log.Printf("[DEBUG] custom extractor for %s", reqURL)
 		dbody, err := goquery.NewDocumentFromReader(strings.NewReader(body))
 		if err != nil {
 			return "", "", err
 		}
+		for _, exclude := range rule.Excludes {
+			if exclude = strings.TrimSpace(exclude); exclude != "" {
+				dbody.Find(exclude).Remove()
+			}
+		}
 		var res string
 		dbody.Find(rule.Content).Each(func(_ int, s *goquery.Selection) {
 			if html, err := s.Html(); err == nil {
@@ -198,40 +542,52 @@ func (f *UReadability) getContent(_ context.Context, body, reqURL string, rule *
 
 	if rule != nil {
 		log.Printf("[DEBUG] custom rule provided for %s: %v", reqURL, rule)
-		if content, rich, err = customParser(body, reqURL, *rule); err == nil {
-			return content, rich, nil
+		if content, rich, ruleErr = customParser(body, reqURL, *rule); ruleErr == nil {
+			return content, rich, nil, nil
 		}
-		log.Printf("[WARN] custom extractor failed for %s, error=%v", reqURL, err) // back to general parser
+		log.Printf("[WARN] custom extractor failed for %s, error=%v", reqURL, ruleErr) // back to general parser
 	}
-
-	return genParser(body, reqURL)
+	content, rich, err = genParser(body, reqURL)
+	return content, rich, ruleErr, err
 }
 
-// makes all links absolute and returns all found links
-func (f *UReadability) normalizeLinks(data string, baseURL *url.URL) (result string, links []string) {
-	absoluteLink := func(link string) (absLink string, changed bool) {
-		if r, err := baseURL.Parse(link); err == nil {
-			return r.String(), r.String() != link
-		}
-		return "", false
-	}
-
-	result = data
-	matches := reLinks.FindAllStringSubmatch(data, -1)
-	normalizedCount := 0
-	for _, m := range matches {
-		srcLink := m[len(m)-1] // link in last element of the group
-		dstLink := srcLink
-		if absLink, changed := absoluteLink(srcLink); changed {
-			dstLink = absLink
-			srcLink = fmt.Sprintf("%q", srcLink)
-			absLink = fmt.Sprintf("%q", absLink)
-			result = strings.ReplaceAll(result, srcLink, absLink)
-			log.Printf("[DEBUG] normalized %s -> %s", srcLink, dstLink)
-			normalizedCount++
+// recordHealth stores outcome of extraction with a stored rule, rules made on the fly like in preview are skipped.
+// The outcome is written in background, so extraction doesn't wait for the storage, and the same outcome
+// of the rule is written at most once per ruleHealthInterval.
+func (f *UReadability) recordHealth(ctx context.Context, rule *datastore.Rule, err error) {
+	if f.Rules == nil || rule.ID.IsZero() {
+		return
+	}
+	id, health := rule.ID, datastore.RuleHealth{OK: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		health.Error = err.Error()
+	}
+	f.healthMu.Lock()
+	last, found := f.healthSaved[id]
+	if found && last.OK == health.OK && health.CheckedAt.Sub(last.CheckedAt) < ruleHealthInterval {
+		f.healthMu.Unlock()
+		return
+	}
+	if f.healthSaved == nil {
+		f.healthSaved = map[bson.ObjectID]datastore.RuleHealth{}
+	}
+	f.healthSaved[id] = health
+	f.healthMu.Unlock()
+
+	f.background.Go(func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ruleHealthTimeout)
+		defer cancel()
+		if e := f.Rules.SetHealth(ctx, id, health); e != nil {
+			log.Printf("[WARN] failed to record health of rule %s, %v", id.Hex(), e)
 		}
-		links = append(links, dstLink)
+	})
+}
+
+// Wait waits for the work left running after responses, rule health writes and image proxy fetches
+// of gone requests, so it is done before the store is closed
+func (f *UReadability) Wait() {
+	f.background.Wait()
+	if f.ImageProxy != nil {
+		f.ImageProxy.Wait()
 	}
-	log.Printf("[DEBUG] normalized %d links", normalizedCount)
-	return result, links
 }
@@ -2,20 +2,32 @@ package extractor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/ukeeper/ukeeper-readability/datastore"
 	"github.com/ukeeper/ukeeper-readability/extractor/mocks"
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
 func TestExtractURL(t *testing.T) {
@@ -60,7 +72,7 @@ func TestExtractURL(t *testing.T) {
 			url:            ts.URL + "/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/",
 			wantURL:        ts.URL + "/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/",
 			wantTitle:      "Всем миром для общей пользы • Umputun тут был",
-			wantContentLen: 9665,
+			wantContentLen: 9822,
 			wantErr:        false,
 		},
 		{
@@ -68,7 +80,7 @@ func TestExtractURL(t *testing.T) {
 			url:            ts.URL + "/IAvTHr",
 			wantURL:        ts.URL + "/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/",
 			wantTitle:      "Всем миром для общей пользы • Umputun тут был",
-			wantContentLen: 9665,
+			wantContentLen: 9822,
 			wantErr:        false,
 		},
 		{
@@ -144,17 +156,19 @@ func TestExtractGeneral(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "Всем миром для общей пользы • Umputun тут был", a.Title)
 	assert.Equal(t, ts.URL+"/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/", a.URL)
-	assert.Equal(t, "Не первый раз я практикую идею “а давайте, ребята, сделаем для общего блага …”, и вот опять. В нашем подкасте радио-т есть незаменимый инструмент, позволяющий собирать новости, готовить их к выпуску, ...", a.Excerpt)
+	assert.Equal(t, "Не первый раз я практикую идею “а давайте, ребята, сделаем для общего блага …”, и вот опять.", a.Excerpt,
+		"og:description, whole sentences")
 	assert.Equal(t, tsURL.Host, a.Domain)
 
 	a, err = lr.Extract(context.Background(), ts.URL+"/v48b6Q")
 	require.NoError(t, err)
 	assert.Equal(t, "UWP - Выпуск 369", a.Title)
 	assert.Equal(t, ts.URL+"/p/2015/11/22/podcast-369/", a.URL)
-	assert.Equal(t, "2015-11-22 Нагло ходил в гости. Табличка на двери сработала на 50%Никогда нас школа не хвалила. Девочка осваивает новый прибор. Мое неприятие их логики. И разошлись по будкам …Отбиваюсь от опасных ...", a.Excerpt)
+	assert.Equal(t, "Нагло ходил в гости. Табличка на двери сработала на 50% Никогда нас школа не хвалила. "+
+		"Девочка осваивает новый прибор. Мое неприятие их логики.", a.Excerpt, "description without the cut sentence")
 	assert.Equal(t, "https://podcast.umputun.com/images/uwp/uwp369.jpg", a.Image)
 	assert.Equal(t, tsURL.Host, a.Domain)
-	assert.Len(t, a.AllLinks, 13)
+	assert.Len(t, a.AllLinks, 12, "links are not repeated")
 	assert.Contains(t, a.AllLinks, "https://podcast.umputun.com/media/ump_podcast369.mp3")
 	assert.Contains(t, a.AllLinks, "https://podcast.umputun.com/images/uwp/uwp369.jpg")
 	log.Printf("links=%v", a.AllLinks)
@@ -164,14 +178,14 @@ func TestNormalizeLinks(t *testing.T) {
 	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200}
 	inp := `blah <img src="/aaa.png"/> sdfasd <a href="/blah2/aa.link">something</a> blah33 <img src="//aaa.com/xyz.jpg">xx</img>`
 	u, _ := url.Parse("http://ukeeper.com/blah")
-	out, links := lr.normalizeLinks(inp, u)
-	assert.Equal(t, `blah <img src="http://ukeeper.com/aaa.png"/> sdfasd <a href="http://ukeeper.com/blah2/aa.link">something</a> blah33 <img src="http://aaa.com/xyz.jpg">xx</img>`, out)
+	out, links, _ := lr.normalizeLinks(inp, u)
+	assert.Equal(t, `blah <img src="http://ukeeper.com/aaa.png"/> sdfasd <a href="http://ukeeper.com/blah2/aa.link">something</a> blah33 <img src="http://aaa.com/xyz.jpg"/>xx`, out)
 	assert.Len(t, links, 3)
 
 	inp = `<body>
 		<img class="alignright size-full wp-image-944214 lazyloadableImage lazyLoad-fadeIn" alt="View Page Source" width="308" height="508" data-original="http://cdn1.tnwcdn.com/wp-content/blogs.dir/1/files/2016/01/page-source.jpg" src="http://cdn1.tnwcdn.com/wp-content/blogs.dir/1/files/2016/01/page-source.jpg"></body>`
-	_, links = lr.normalizeLinks(inp, u)
-	assert.Len(t, links, 1)
+	_, links, _ = lr.normalizeLinks(inp, u)
+	assert.Len(t, links, 1, "lazy-load attribute with the same url")
 	assert.Equal(t, "http://cdn1.tnwcdn.com/wp-content/blogs.dir/1/files/2016/01/page-source.jpg", links[0])
 }
 
@@ -226,6 +240,31 @@ func TestExtractByRule(t *testing.T) {
 	})
 }
 
+func TestExtractByRuleRequestOptions(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = w.Write([]byte("<html><head><title>t</title></head><body><article><p>some text</p></article></body></html>"))
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 5 * time.Second, SnippetSize: 200}
+	rule := &datastore.Rule{
+		Content:   "article",
+		UserAgent: "rule-agent",
+		Headers:   []string{"X-Rule: 1", ""},
+		Cookies:   []string{"CONSENT=YES+"},
+	}
+	_, err := lr.ExtractByRule(context.Background(), ts.URL, rule)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "rule-agent", got.Header.Get("User-Agent"))
+	assert.Equal(t, "1", got.Header.Get("X-Rule"))
+	c, err := got.Cookie("CONSENT")
+	require.NoError(t, err)
+	assert.Equal(t, "YES+", c.Value)
+}
+
 func TestExtractWithCustomRetriever(t *testing.T) {
 	testHTML := `<html><head><title>Test Page</title></head>
 <body><article><p>This is the article content from a custom retriever.</p></article></body></html>`
@@ -375,3 +414,240 @@ func TestGetContentCustom(t *testing.T) {
 	assert.Len(t, content, 6988)
 	assert.Len(t, rich, 7169)
 }
+
+func TestGetContentExcludes(t *testing.T) {
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200}
+	body := `<html><body><article><p>first</p><div class="share">share</div><p>second</p>
+		<aside id="related"><p>related</p></aside></article></body></html>`
+
+	_, rich, err := lr.getContent(context.Background(), body, "https://example.com/a",
+		&datastore.Rule{Content: "article", Excludes: []string{" .share", "", "#related["}})
+	require.NoError(t, err)
+	assert.Contains(t, rich, "first")
+	assert.Contains(t, rich, "second")
+	assert.NotContains(t, rich, "share")
+	assert.Contains(t, rich, "related", "invalid selector excludes nothing")
+
+	_, rich, err = lr.getContent(context.Background(), body, "https://example.com/a",
+		&datastore.Rule{Content: "article", Excludes: []string{".share", "#related"}})
+	require.NoError(t, err)
+	assert.NotContains(t, rich, "related")
+}
+
+func TestFetchPage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/doc.pdf" {
+			_, _ = w.Write([]byte("%PDF-1.4"))
+			return
+		}
+		_, _ = w.Write([]byte("<html><body><p>" + r.Header.Get("User-Agent") + "</p></body></html>"))
+	}))
+	defer ts.Close()
+
+	rules := &mocks.RulesMock{GetFunc: func(context.Context, string) (datastore.Rule, bool) {
+		return datastore.Rule{UserAgent: "rule-agent"}, true
+	}}
+	lr := UReadability{TimeOut: 30 * time.Second, Rules: rules}
+
+	finalURL, body, err := lr.FetchPage(context.Background(), ts.URL+"/old", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/new", finalURL)
+	assert.Contains(t, body, "<p>rule-agent</p>", "rule looked up by domain")
+
+	_, body, err = lr.FetchPage(context.Background(), ts.URL+"/new", &datastore.Rule{UserAgent: "passed-agent"})
+	require.NoError(t, err)
+	assert.Contains(t, body, "passed-agent")
+	assert.Len(t, rules.GetCalls(), 1)
+
+	_, _, err = lr.FetchPage(context.Background(), ts.URL+"/doc.pdf", nil)
+	require.Error(t, err)
+
+	lr.Policy = &OutboundPolicy{}
+	_, _, err = lr.FetchPage(context.Background(), ts.URL+"/new", nil)
+	require.Error(t, err, "loopback is blocked by policy")
+}
+
+func TestExtractMetrics(t *testing.T) {
+	mockRetriever := &RetrieverMock{
+		RetrieveFunc: func(_ context.Context, reqURL string) (*RetrieveResult, error) {
+			return &RetrieveResult{URL: reqURL, Header: http.Header{"Content-Type": []string{"text/html"}},
+				Body: []byte(`<html><head><title>t</title></head><body><article><p class="text">some text</p></article></body></html>`)}, nil
+		},
+	}
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Retriever: mockRetriever, Policy: &OutboundPolicy{}}
+	success := metricValue(t, `ukeeper_extract_total{outcome="success",retriever="custom"}`)
+	forbidden := metricValue(t, `ukeeper_extract_total{outcome="forbidden",retriever="none"}`)
+	general := metricValue(t, `ukeeper_rule_extractions_total{result="general",rule=""}`)
+
+	rule := datastore.Rule{ID: bson.NewObjectID(), Content: ".text"}
+	_, err := lr.ExtractByRule(context.Background(), "https://Metrics.example.com/a", &rule)
+	require.NoError(t, err)
+	rule.Content = ".missing"
+	_, err = lr.ExtractByRule(context.Background(), "https://metrics.example.com/b", &rule)
+	require.NoError(t, err)
+	_, err = lr.Extract(context.Background(), "https://metrics.example.com/c")
+	require.NoError(t, err)
+	_, err = lr.Extract(context.Background(), "http://10.11.12.13/metrics-test")
+	require.Error(t, err)
+
+	assert.InDelta(t, success+3, metricValue(t, `ukeeper_extract_total{outcome="success",retriever="custom"}`), 0)
+	assert.InDelta(t, forbidden+1, metricValue(t, `ukeeper_extract_total{outcome="forbidden",retriever="none"}`), 0)
+	assert.InDelta(t, 1, metricValue(t, `ukeeper_rule_extractions_total{result="rule",rule="`+rule.ID.Hex()+`"}`), 0)
+	assert.InDelta(t, 1, metricValue(t, `ukeeper_rule_extractions_total{result="fallback",rule="`+rule.ID.Hex()+`"}`), 0)
+	assert.InDelta(t, general+1, metricValue(t, `ukeeper_rule_extractions_total{result="general",rule=""}`), 0)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.NotContains(t, rec.Body.String(), "metrics.example.com", "requested domains are not used as labels")
+}
+
+// metricValue returns current value of the metric series from metrics handler, 0 if the series is not there yet
+func metricValue(t *testing.T, series string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, series+" "); ok {
+			res, err := strconv.ParseFloat(v, 64)
+			require.NoError(t, err)
+			return res
+		}
+	}
+	return 0
+}
+
+func TestExtractRuleHealth(t *testing.T) {
+	mockRetriever := &RetrieverMock{
+		RetrieveFunc: func(_ context.Context, reqURL string) (*RetrieveResult, error) {
+			return &RetrieveResult{URL: reqURL, Header: http.Header{"Content-Type": []string{"text/html"}},
+				Body: []byte(`<html><head><title>t</title></head><body><article><p class="text">some text</p></article></body></html>`)}, nil
+		},
+	}
+	rules := &mocks.RulesMock{SetHealthFunc: func(context.Context, bson.ObjectID, datastore.RuleHealth) error { return nil }}
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Retriever: mockRetriever, Rules: rules}
+
+	good, bad := bson.NewObjectID(), bson.NewObjectID()
+	_, err := lr.ExtractByRule(context.Background(), "https://example.com/a", &datastore.Rule{ID: good, Content: ".text"})
+	require.NoError(t, err)
+	_, err = lr.ExtractByRule(context.Background(), "https://example.com/b", &datastore.Rule{ID: bad, Content: ".missing"})
+	require.NoError(t, err)
+	_, err = lr.ExtractByRule(context.Background(), "https://example.com/c", &datastore.Rule{Content: ".text"})
+	require.NoError(t, err, "rule without id, like in preview")
+
+	// written in background
+	require.Eventually(t, func() bool { return len(rules.SetHealthCalls()) == 2 }, time.Second, 10*time.Millisecond)
+	health := map[bson.ObjectID]datastore.RuleHealth{}
+	for _, c := range rules.SetHealthCalls() {
+		health[c.ID] = c.Health
+	}
+	assert.True(t, health[good].OK)
+	assert.Empty(t, health[good].Error)
+	assert.WithinDuration(t, time.Now(), health[good].CheckedAt, time.Minute)
+	assert.False(t, health[bad].OK)
+	assert.Contains(t, health[bad].Error, "nothing extracted")
+
+	// the same outcome isn't written again within ruleHealthInterval, changed one is
+	_, err = lr.ExtractByRule(context.Background(), "https://example.com/d", &datastore.Rule{ID: good, Content: ".text"})
+	require.NoError(t, err)
+	_, err = lr.ExtractByRule(context.Background(), "https://example.com/e", &datastore.Rule{ID: bad, Content: ".text"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(rules.SetHealthCalls()) == 3 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	calls := rules.SetHealthCalls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, bad, calls[2].ID)
+	assert.True(t, calls[2].Health.OK)
+}
+
+func TestWaitBackground(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.png" {
+			time.Sleep(200 * time.Millisecond)
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>t</title></head><body><article><p class="text">some text</p></article></body></html>`))
+	}))
+	defer ts.Close()
+
+	var healthWritten atomic.Bool
+	rules := &mocks.RulesMock{SetHealthFunc: func(context.Context, bson.ObjectID, datastore.RuleHealth) error {
+		time.Sleep(200 * time.Millisecond)
+		healthWritten.Store(true)
+		return nil
+	}}
+	proxy := &ImageProxy{Secret: []byte("secret"), CacheSize: 1 << 20}
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Rules: rules, ImageProxy: proxy}
+
+	_, err := lr.ExtractByRule(context.Background(), ts.URL+"/a", &datastore.Rule{ID: bson.NewObjectID(), Content: ".text"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = proxy.Fetch(ctx, ts.URL+"/slow.png", 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	lr.Wait()
+	assert.True(t, healthWritten.Load(), "health write waited for")
+	img, ok := proxy.cached(ts.URL + "/slow.png|0")
+	require.True(t, ok, "detached image fetch waited for")
+	assert.Equal(t, "image/png", img.ContentType)
+}
+
+func TestExtractOutcome(t *testing.T) {
+	assert.Equal(t, "success", extractOutcome(nil))
+	assert.Equal(t, "forbidden", extractOutcome(fmt.Errorf("%w: x", ErrForbiddenTarget)))
+	assert.Equal(t, "too_large", extractOutcome(&ContentError{Err: ErrContentTooLarge}))
+	assert.Equal(t, "unsupported", extractOutcome(&ContentError{Err: ErrUnsupportedContent}))
+	assert.Equal(t, "timeout", extractOutcome(fmt.Errorf("get: %w", context.DeadlineExceeded)))
+	assert.Equal(t, "error", extractOutcome(errors.New("boom")))
+
+	assert.Equal(t, "http", retrieverLabel(&HTTPRetriever{}))
+	assert.Equal(t, "cloudflare", retrieverLabel(&CloudflareRetriever{}))
+	assert.Equal(t, "custom", retrieverLabel(&RetrieverMock{}))
+}
+
+func TestExtractSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pic.png" {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>t</title></head><body><article><p>some text</p><img src="/pic.png"></article></body></html>`))
+	}))
+	defer ts.Close()
+
+	rules := &mocks.RulesMock{GetFunc: func(context.Context, string) (datastore.Rule, bool) { return datastore.Rule{}, false }}
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200, Rules: rules}
+	_, err := lr.Extract(context.Background(), ts.URL+"/page")
+	require.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["extract"]
+	require.True(t, ok)
+	for _, name := range []string{"extract.rule_lookup", "retrieve.http", "extract.charset", "extract.parse",
+		"extract.normalize_links", "extract.images"} {
+		span, ok := spans[name]
+		require.True(t, ok, name)
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), name)
+	}
+	assert.Equal(t, spans["extract.images"].SpanContext().SpanID(), spans["extract.image_probe"].Parent().SpanID())
+
+	_, err = lr.Extract(context.Background(), ts.URL+"/page\x7f")
+	require.Error(t, err)
+	last := recorder.Ended()[len(recorder.Ended())-1]
+	assert.Equal(t, "extract", last.Name())
+	assert.Equal(t, codes.Error, last.Status().Code)
+}
@@ -3,16 +3,27 @@ package extractor
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
 //go:generate moq -out retriever_mock_test.go -skip-ensure -fmt goimports . Retriever
@@ -29,36 +40,155 @@ type RetrieveResult struct {
 	Header http.Header // response headers (for charset detection)
 }
 
+// RequestOptions holds per-request overrides for HTTPRetriever, usually derived from a matched rule
+type RequestOptions struct {
+	UserAgent string            // overrides retriever's User-Agent if not empty
+	Headers   map[string]string // extra headers, applied on top of retriever's headers
+	Cookies   map[string]string // cookies sent with the request, e.g. consent flags
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of ctx carrying per-request retriever overrides
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// requestOptions returns per-request overrides from ctx, empty if not set
+func requestOptions(ctx context.Context) RequestOptions {
+	if opts, ok := ctx.Value(requestOptionsKey{}).(RequestOptions); ok {
+		return opts
+	}
+	return RequestOptions{}
+}
+
 // HTTPRetriever fetches pages using a standard HTTP client
 type HTTPRetriever struct {
-	Timeout time.Duration
-
-	once   sync.Once
-	client *http.Client
+	Timeout      time.Duration
+	UserAgent    string            // User-Agent header; defaults to Safari user-agent
+	Headers      map[string]string // extra headers sent with every request
+	Proxy        string            // outbound proxy URL (http, https or socks5); proxy env variables are used if empty
+	CACertFile   string            // PEM bundle with extra root CAs, added to the system pool
+	MaxRedirects int               // max redirects to follow; 0 keeps net/http default (10), negative disables redirects
+	CookieJar    bool              // keep cookies set by sites between requests, helps with consent walls
+	Policy       *OutboundPolicy   // restricts fetched targets, including redirects; nil allows everything
+	MaxBodySize  int64             // max page size in bytes; defaults to DefaultMaxBodySize
+	AllowedTypes []string          // accepted page media types; defaults to DefaultContentTypes
+
+	once      sync.Once
+	client    *http.Client
+	clientErr error
 }
 
 const httpDefaultTimeout = 30 * time.Second
 
-func (h *HTTPRetriever) httpClient() *http.Client {
+// Validate makes the http client, checking proxy and CA settings, so bad settings are reported on start
+// instead of the first request
+func (h *HTTPRetriever) Validate() error {
+	_, err := h.httpClient()
+	return err
+}
+
+func (h *HTTPRetriever) httpClient() (*http.Client, error) {
 	h.once.Do(func() {
 		timeout := h.Timeout
 		if timeout == 0 {
 			timeout = httpDefaultTimeout
 		}
-		h.client = &http.Client{Timeout: timeout}
+		transport, err := h.transport()
+		if err != nil {
+			h.clientErr = err
+			return
+		}
+		client := &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: h.checkRedirect}
+		if h.CookieJar {
+			jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+			if err != nil {
+				h.clientErr = fmt.Errorf("make cookie jar: %w", err)
+				return
+			}
+			client.Jar = jar
+		}
+		h.client = client
 	})
-	return h.client
+	return h.client, h.clientErr
+}
+
+// transport makes http.Transport with proxy and custom CA settings applied
+func (h *HTTPRetriever) transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.Proxy != "" {
+		proxyURL, err := url.Parse(h.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url %q: %w", h.Proxy, err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+		// the proxy is usually on a private network, dial-time checks are skipped for it,
+		// target addresses are resolved and checked by the policy before the request instead
+		transport = h.Policy.Transport(transport, proxyURL.Hostname())
+	} else {
+		transport = h.Policy.Transport(transport)
+	}
+	if h.CACertFile != "" {
+		pem, err := os.ReadFile(h.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", h.CACertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return transport, nil
 }
 
-// Retrieve fetches the URL using an HTTP GET with Safari user-agent, following redirects
-func (h *HTTPRetriever) Retrieve(ctx context.Context, reqURL string) (*RetrieveResult, error) {
+// checkRedirect limits the number of redirects and verifies redirect targets against the policy
+func (h *HTTPRetriever) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := h.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = 10 // net/http default
+	}
+	if maxRedirects < 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return h.Policy.CheckURL(req.URL)
+}
+
+// Retrieve fetches the URL using an HTTP GET, following redirects. User-Agent, headers and cookies
+// can be overridden per request with WithRequestOptions.
+func (h *HTTPRetriever) Retrieve(ctx context.Context, reqURL string) (res *RetrieveResult, err error) {
+	ctx, span := tracer.Start(ctx, "retrieve.http", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", reqURL)))
+	defer func() { endSpan(span, err) }()
+
+	client, err := h.httpClient()
+	if err != nil {
+		log.Printf("[WARN] failed to make http client, error=%v", err)
+		return nil, err
+	}
+	if err = h.Policy.CheckRequestURL(reqURL); err != nil {
+		log.Printf("[WARN] refused to fetch %s, error=%v", reqURL, err)
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
 	if err != nil {
 		log.Printf("[WARN] failed to create request for %s, error=%v", reqURL, err)
 		return nil, err
 	}
-	req.Header.Set("User-Agent", userAgent)
-	resp, err := h.httpClient().Do(req)
+	h.setHeaders(req, requestOptions(ctx))
+	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("[WARN] failed to get anything from %s, error=%v", reqURL, err)
 		return nil, err
@@ -68,12 +198,21 @@ func (h *HTTPRetriever) Retrieve(ctx context.Context, reqURL string) (*RetrieveR
 			log.Printf("[WARN] failed to close response body, error=%v", closeErr)
 		}
 	}()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
-	body, err := io.ReadAll(resp.Body)
+	maxSize, allowed := h.MaxBodySize, h.AllowedTypes
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	if len(allowed) == 0 {
+		allowed = DefaultContentTypes
+	}
+	body, err := readPage(reqURL, resp, maxSize, allowed)
 	if err != nil {
 		log.Printf("[WARN] failed to read data from %s, error=%v", reqURL, err)
 		return nil, err
 	}
+	span.SetAttributes(attribute.Int("http.response.body.size", len(body)))
 
 	return &RetrieveResult{
 		Body:   body,
@@ -82,6 +221,55 @@ func (h *HTTPRetriever) Retrieve(ctx context.Context, reqURL string) (*RetrieveR
 	}, nil
 }
 
+// setHeaders applies user-agent, headers and cookies, per-request options take precedence over retriever's
+func (h *HTTPRetriever) setHeaders(req *http.Request, opts RequestOptions) {
+	ua := userAgent
+	if h.UserAgent != "" {
+		ua = h.UserAgent
+	}
+	if opts.UserAgent != "" {
+		ua = opts.UserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	for name, value := range opts.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
+// parseHeaders converts "Name: value" lines into a header map, skipping malformed and empty lines
+func parseHeaders(lines []string) map[string]string {
+	res := map[string]string{}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		res[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return res
+}
+
+// parseCookies converts "name=value" lines into a cookie map, skipping malformed and empty lines
+func parseCookies(lines []string) map[string]string {
+	res := map[string]string{}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		res[name] = strings.TrimSpace(value)
+	}
+	return res
+}
+
 const (
 	cfDefaultBaseURL    = "https://api.cloudflare.com/client/v4"
 	cfDefaultWaitUntil  = "networkidle0"
@@ -104,12 +292,13 @@ var errCFRateLimited = errors.New("cloudflare rate limited")
 // it sends a POST to the /content endpoint which returns fully rendered HTML after JS execution.
 // on HTTP 429 it retries with backoff (respecting Retry-After) up to MaxRetries times.
 type CloudflareRetriever struct {
-	AccountID  string
-	APIToken   string
-	BaseURL    string        // override for testing; defaults to Cloudflare API
-	Timeout    time.Duration // per-request HTTP client timeout; defaults to 60s
-	MaxRetries int           // number of retries on 429; 0 means no retries. use CFDefaultMaxRetries (2) for sensible production default
-	RetryDelay time.Duration // base delay between 429 retries; defaults to 11s (CF free tier is 1 req/10s)
+	AccountID   string
+	APIToken    string
+	BaseURL     string        // override for testing; defaults to Cloudflare API
+	Timeout     time.Duration // per-request HTTP client timeout; defaults to 60s
+	MaxRetries  int           // number of retries on 429; 0 means no retries. use CFDefaultMaxRetries (2) for sensible production default
+	RetryDelay  time.Duration // base delay between 429 retries; defaults to 11s (CF free tier is 1 req/10s)
+	MaxBodySize int64         // max rendered page size in bytes; defaults to DefaultMaxBodySize
 
 	once   sync.Once
 	client *http.Client
@@ -145,6 +334,15 @@ type cfResponse struct {
 // connection open in the meantime. aborts early if the caller's context is canceled.
 // MaxRetries: 0 means no retries. RetryDelay: 0 falls back to the package default.
 func (c *CloudflareRetriever) Retrieve(ctx context.Context, reqURL string) (*RetrieveResult, error) {
+	ctx, span := tracer.Start(ctx, "retrieve.cloudflare", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", reqURL)))
+	res, err := c.retrieveWithRetries(ctx, reqURL)
+	endSpan(span, err)
+	return res, err
+}
+
+// retrieveWithRetries makes requests until success, non-429 error or retries exhausted
+func (c *CloudflareRetriever) retrieveWithRetries(ctx context.Context, reqURL string) (*RetrieveResult, error) {
 	maxRetries := c.MaxRetries
 	if maxRetries < 0 {
 		maxRetries = 0
@@ -158,15 +356,21 @@ func (c *CloudflareRetriever) Retrieve(ctx context.Context, reqURL string) (*Ret
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		result, retryAfter, err := c.doRetrieve(ctx, reqURL)
 		if err == nil {
+			metrics.ObserveCloudflare(metrics.CloudflareOK)
 			return result, nil
 		}
 		lastErr = err
 		if !errors.Is(err, errCFRateLimited) {
+			metrics.ObserveCloudflare(metrics.CloudflareError)
 			return nil, err
 		}
+		metrics.ObserveCloudflare(metrics.CloudflareRateLimited)
 		if attempt == maxRetries {
 			break
 		}
+		metrics.ObserveCloudflareRetry()
+		trace.SpanFromContext(ctx).AddEvent("rate_limited", trace.WithAttributes(attribute.Int("retry.attempt", attempt+1),
+			attribute.String("retry.after", retryAfter.String())))
 		delay := retryAfter
 		if delay <= 0 {
 			delay = baseDelay << attempt // 11s, 22s, 44s, ...
@@ -220,7 +424,12 @@ func (c *CloudflareRetriever) doRetrieve(ctx context.Context, reqURL string) (*R
 		}
 	}()
 
-	body, err := io.ReadAll(resp.Body)
+	maxSize := c.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	// JSON envelope adds escaping overhead on top of the page itself
+	body, err := readLimited(reqURL, resp.Body, maxSize+maxSize/4)
 	if err != nil {
 		log.Printf("[WARN] failed to read cf response for %s, error=%v", reqURL, err)
 		return nil, 0, err
@@ -251,6 +460,9 @@ func (c *CloudflareRetriever) doRetrieve(ctx context.Context, reqURL string) (*R
 		}
 	}
 	// if unmarshal fails, use the raw body as-is (raw HTML response)
+	if int64(len(body)) > maxSize {
+		return nil, 0, &ContentError{URL: reqURL, Size: int64(len(body)), Limit: maxSize, Err: ErrContentTooLarge}
+	}
 
 	header := make(http.Header)
 	header.Set("Content-Type", "text/html; charset=utf-8")
@@ -264,6 +476,45 @@ func (c *CloudflareRetriever) doRetrieve(ctx context.Context, reqURL string) (*R
 	}, 0, nil
 }
 
+// VerifyToken checks the API token is valid and active with Cloudflare token verification endpoint
+func (c *CloudflareRetriever) VerifyToken(ctx context.Context) error {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = cfDefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/user/tokens/verify", http.NoBody)
+	if err != nil {
+		return fmt.Errorf("create cf verify request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare token verification: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("[WARN] failed to close cf verify response body, error=%v", closeErr)
+		}
+	}()
+
+	var verifyResp struct {
+		Success bool `json:"success"`
+		Result  struct {
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&verifyResp); err != nil {
+		return fmt.Errorf("cloudflare token verification: status %d, %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || !verifyResp.Success {
+		return fmt.Errorf("cloudflare token verification failed: status %d", resp.StatusCode)
+	}
+	if verifyResp.Result.Status != "active" {
+		return fmt.Errorf("cloudflare token is %s", verifyResp.Result.Status)
+	}
+	return nil
+}
+
 // parseRetryAfter parses an HTTP Retry-After header value as either delta-seconds
 // or an HTTP date. returns 0 if empty or unparseable.
 func parseRetryAfter(value string) time.Duration {
@@ -3,9 +3,13 @@ package extractor
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -110,6 +114,161 @@ func TestHTTPRetriever_ResponseHeaders(t *testing.T) {
 	assert.Equal(t, "test-value", result.Header.Get("X-Custom"))
 }
 
+func TestHTTPRetriever_CustomHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	retriever := &HTTPRetriever{
+		Timeout:   5 * time.Second,
+		UserAgent: "global-agent",
+		Headers:   map[string]string{"X-Global": "g", "Accept-Language": "en"},
+	}
+
+	t.Run("retriever defaults", func(t *testing.T) {
+		_, err := retriever.Retrieve(context.Background(), ts.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "global-agent", got.Get("User-Agent"))
+		assert.Equal(t, "g", got.Get("X-Global"))
+		assert.Equal(t, "en", got.Get("Accept-Language"))
+		assert.Empty(t, got.Get("Cookie"))
+	})
+
+	t.Run("per-request options override", func(t *testing.T) {
+		ctx := WithRequestOptions(context.Background(), RequestOptions{
+			UserAgent: "rule-agent",
+			Headers:   map[string]string{"Accept-Language": "ru", "X-Rule": "r"},
+			Cookies:   map[string]string{"CONSENT": "YES+"},
+		})
+		_, err := retriever.Retrieve(ctx, ts.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "rule-agent", got.Get("User-Agent"))
+		assert.Equal(t, "g", got.Get("X-Global"))
+		assert.Equal(t, "ru", got.Get("Accept-Language"))
+		assert.Equal(t, "r", got.Get("X-Rule"))
+		assert.Equal(t, "CONSENT=YES+", got.Get("Cookie"))
+	})
+}
+
+func TestHTTPRetriever_MaxRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r1":
+			http.Redirect(w, r, "/r2", http.StatusFound)
+		case "/r2":
+			http.Redirect(w, r, "/end", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("end"))
+		}
+	}))
+	defer ts.Close()
+
+	t.Run("default follows", func(t *testing.T) {
+		res, err := (&HTTPRetriever{}).Retrieve(context.Background(), ts.URL+"/r1")
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/end", res.URL)
+	})
+
+	t.Run("limit exceeded", func(t *testing.T) {
+		_, err := (&HTTPRetriever{MaxRedirects: 1}).Retrieve(context.Background(), ts.URL+"/r1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stopped after 1 redirects")
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		res, err := (&HTTPRetriever{MaxRedirects: 2}).Retrieve(context.Background(), ts.URL+"/r1")
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/end", res.URL)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		res, err := (&HTTPRetriever{MaxRedirects: -1}).Retrieve(context.Background(), ts.URL+"/r1")
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/r1", res.URL)
+	})
+}
+
+func TestHTTPRetriever_CookieJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("consent"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/"})
+			_, _ = w.Write([]byte("consent wall"))
+			return
+		}
+		_, _ = w.Write([]byte("article"))
+	}))
+	defer ts.Close()
+
+	noJar := &HTTPRetriever{}
+	for range 2 {
+		res, err := noJar.Retrieve(context.Background(), ts.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "consent wall", string(res.Body))
+	}
+
+	withJar := &HTTPRetriever{CookieJar: true}
+	res, err := withJar.Retrieve(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "consent wall", string(res.Body))
+	res, err = withJar.Retrieve(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "article", string(res.Body))
+}
+
+func TestHTTPRetriever_Proxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String()) // proxy receives absolute request URI
+		_, _ = w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	retriever := &HTTPRetriever{Proxy: proxy.URL}
+	res, err := retriever.Retrieve(context.Background(), "http://example.com/page")
+	require.NoError(t, err)
+	assert.Equal(t, "via proxy", string(res.Body))
+	assert.Equal(t, "http://example.com/page", proxied.Load())
+
+	require.NoError(t, retriever.Validate())
+	require.Error(t, (&HTTPRetriever{Proxy: "ftp://proxy.example.com"}).Validate())
+	_, err = (&HTTPRetriever{Proxy: "ftp://proxy.example.com"}).Retrieve(context.Background(), "http://example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported proxy scheme")
+}
+
+func TestHTTPRetriever_CACertFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("secure"))
+	}))
+	defer ts.Close()
+
+	_, err := (&HTTPRetriever{}).Retrieve(context.Background(), ts.URL)
+	require.Error(t, err, "self-signed cert is not trusted by default")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0o600))
+
+	res, err := (&HTTPRetriever{CACertFile: caFile}).Retrieve(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "secure", string(res.Body))
+
+	require.Error(t, (&HTTPRetriever{CACertFile: "/no/such/file.pem"}).Validate())
+	_, err = (&HTTPRetriever{CACertFile: "/no/such/file.pem"}).Retrieve(context.Background(), ts.URL)
+	require.Error(t, err)
+}
+
+func TestParseHeadersAndCookies(t *testing.T) {
+	headers := parseHeaders([]string{"accept-language: ru", "", "bad line", " X-Token : abc:def \r", ": empty"})
+	assert.Equal(t, map[string]string{"Accept-Language": "ru", "X-Token": "abc:def"}, headers)
+
+	cookies := parseCookies([]string{"CONSENT=YES+", "", "broken", "sid = a=b"})
+	assert.Equal(t, map[string]string{"CONSENT": "YES+", "sid": "a=b"}, cookies)
+}
+
 func TestCloudflareRetriever_Retrieve(t *testing.T) {
 	const testHTML = "<html><body>rendered content</body></html>"
 
@@ -194,6 +353,23 @@ func TestCloudflareRetriever_Retrieve(t *testing.T) {
 	}
 }
 
+func TestCloudflareRetriever_MaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cfResponse{Success: true, Result: "<html>" + strings.Repeat("a", 2000) + "</html>"})
+	}))
+	defer ts.Close()
+
+	retriever := &CloudflareRetriever{AccountID: "a", APIToken: "t", BaseURL: ts.URL, MaxBodySize: 1000}
+	_, err := retriever.Retrieve(context.Background(), "https://example.com")
+	require.ErrorIs(t, err, ErrContentTooLarge)
+
+	retriever = &CloudflareRetriever{AccountID: "a", APIToken: "t", BaseURL: ts.URL, MaxBodySize: 5000}
+	res, err := retriever.Retrieve(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.Len(t, res.Body, 2013)
+}
+
 func TestCloudflareRetriever_URLPathConstruction(t *testing.T) {
 	// verify that the retriever constructs the correct Cloudflare API URL path from AccountID
 	var capturedPath string
@@ -395,6 +571,41 @@ func TestCloudflareRetriever_RateLimitRetriesDisabled(t *testing.T) {
 	}
 }
 
+func TestCloudflareRetriever_VerifyToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/user/tokens/verify", r.URL.Path)
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			_, _ = w.Write([]byte(`{"success":true,"result":{"id":"x","status":"active"}}`))
+		case "Bearer disabled":
+			_, _ = w.Write([]byte(`{"success":true,"result":{"id":"x","status":"disabled"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":1000,"message":"Invalid API Token"}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		token   string
+		wantErr string
+	}{
+		{token: "good"},
+		{token: "disabled", wantErr: "cloudflare token is disabled"},
+		{token: "bad", wantErr: "cloudflare token verification failed: status 401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			err := (&CloudflareRetriever{AccountID: "a", APIToken: tt.token, BaseURL: ts.URL}).VerifyToken(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
 func TestParseRetryAfter(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -0,0 +1,131 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// sanitize levels of SanitizePolicy
+const (
+	SanitizeStrict     = "strict"     // text formatting, headings, lists, quotes, code and links only
+	SanitizeDefault    = "default"    // strict plus images, figures and tables
+	SanitizePermissive = "permissive" // default plus audio, video, class and safe inline styles
+)
+
+// SanitizePolicy is the allowlist of elements and attributes kept in Response.Rich, everything else is removed,
+// including scripts, forms, inline event handlers and javascript: urls. Iframes are removed unless their
+// src is on one of EmbedHosts, like www.youtube.com or player.vimeo.com. Nil policy sanitizes with the default level.
+type SanitizePolicy struct {
+	Level      string   // one of SanitizeStrict, SanitizeDefault or SanitizePermissive, SanitizeDefault if empty
+	EmbedHosts []string // hosts of allowed iframes, https only; a host matches its subdomains too
+
+	once   sync.Once
+	policy *bluemonday.Policy
+	embeds *regexp.Regexp
+}
+
+var defaultSanitizePolicy = &SanitizePolicy{}
+
+// embedSandbox is the sandbox of allowed iframes, the policy drops any other sandbox values
+const embedSandbox = "allow-scripts allow-same-origin allow-presentation allow-popups"
+
+// Sanitize returns rich html cleaned up with the policy
+func (p *SanitizePolicy) Sanitize(rich string) string {
+	if p == nil {
+		p = defaultSanitizePolicy
+	}
+	p.once.Do(p.init)
+	if p.embeds != nil && strings.Contains(rich, "<iframe") {
+		rich = p.prepareFrames(rich)
+	}
+	return strings.TrimSpace(p.policy.Sanitize(rich))
+}
+
+// prepareFrames removes iframes not on EmbedHosts, as the policy would keep them with other attributes and
+// without src, and sandboxes allowed ones. Players need scripts and their own origin, the sandbox still blocks
+// top navigation, forms and downloads.
+func (p *SanitizePolicy) prepareFrames(rich string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rich))
+	if err != nil {
+		return rich
+	}
+	doc.Find("iframe").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return !p.embeds.MatchString(strings.TrimSpace(s.AttrOr("src", "")))
+	}).Remove()
+	doc.Find("iframe").SetAttr("sandbox", embedSandbox)
+	res, err := doc.Find("body").Html()
+	if err != nil {
+		return rich
+	}
+	return res
+}
+
+func (p *SanitizePolicy) init() {
+	switch p.Level {
+	case SanitizeStrict, SanitizeDefault, SanitizePermissive:
+	case "":
+		p.Level = SanitizeDefault
+	default:
+		log.Printf("[WARN] unknown sanitize level %q, using %s", p.Level, SanitizeDefault)
+		p.Level = SanitizeDefault
+	}
+
+	pol := bluemonday.NewPolicy()
+	pol.AllowStandardAttributes()
+	pol.AllowStandardURLs()
+	pol.AllowAttrs("href").OnElements("a")
+	pol.AllowElements("article", "section", "div", "span", "p", "br", "hr", "wbr",
+		"h1", "h2", "h3", "h4", "h5", "h6", "hgroup", "details", "summary",
+		"b", "i", "u", "s", "em", "strong", "small", "strike", "sub", "sup", "mark", "del", "ins",
+		"abbr", "cite", "code", "dfn", "kbd", "samp", "var", "pre", "tt")
+	pol.AllowAttrs("cite").OnElements("blockquote", "q")
+	pol.AllowAttrs("datetime").Matching(bluemonday.ISO8601).OnElements("time", "del", "ins")
+	pol.AllowLists()
+	if p.Level != SanitizeStrict {
+		pol.AllowImages()
+		pol.AllowTables()
+		pol.AllowElements("figure", "figcaption", "picture")
+		pol.AllowAttrs("srcset", "sizes", "media", "type").OnElements("source")
+		pol.AllowAttrs("srcset", "sizes").OnElements("img")
+	}
+	if p.Level == SanitizePermissive {
+		pol.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).Globally()
+		pol.AllowStyles("color", "background-color", "text-align", "font-weight", "font-style", "text-decoration",
+			"vertical-align", "width", "height", "float", "clear").Globally()
+		pol.AllowAttrs("src", "poster", "preload").OnElements("audio", "video")
+		pol.AllowAttrs("controls", "loop", "muted", "playsinline").Matching(regexp.MustCompile(`^$|^\w+$`)).
+			OnElements("audio", "video")
+		pol.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("video")
+		pol.AllowAttrs("src", "type").OnElements("source")
+		pol.AllowAttrs("src", "kind", "srclang", "label").OnElements("track")
+	}
+	if p.embeds = embedSrcRegexp(p.EmbedHosts); p.embeds != nil {
+		pol.AllowAttrs("src").Matching(p.embeds).OnElements("iframe")
+		pol.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("iframe")
+		pol.AllowAttrs("allowfullscreen").Matching(regexp.MustCompile(`^$|^(?i:allowfullscreen|true)$`)).OnElements("iframe")
+		pol.AllowAttrs("title", "sandbox").OnElements("iframe")
+		pol.RequireSandboxOnIFrame(bluemonday.SandboxAllowScripts, bluemonday.SandboxAllowSameOrigin,
+			bluemonday.SandboxAllowPresentation, bluemonday.SandboxAllowPopups)
+	}
+	pol.RequireNoFollowOnLinks(false) // set by AllowImages, but links are from the article itself, not user generated
+	p.policy = pol
+}
+
+// embedSrcRegexp returns regexp matching https urls on the hosts or their subdomains, nil if there are no hosts
+func embedSrcRegexp(hosts []string) *regexp.Regexp {
+	var quoted []string
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.Trim(strings.TrimSpace(h), ".")); h != "" {
+			quoted = append(quoted, regexp.QuoteMeta(h))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`^https://([a-z0-9-]+\.)*(` + strings.Join(quoted, "|") + `)(:\d+)?(/|$)`)
+}
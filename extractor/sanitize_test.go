@@ -0,0 +1,92 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizePolicy(t *testing.T) {
+	const rich = `<div class="post" style="color: red; position: fixed" onclick="steal()"><h2>Title</h2>` +
+		`<p>Text <a href="javascript:alert(1)">bad</a> <a href="https://example.com/x" onmouseover="x()">good</a></p>` +
+		`<script>alert(1)</script><style>p{}</style><form action="/x"><input name="q"></form>` +
+		`<img src="https://example.com/a.png" alt="pic" onerror="steal()"><table><tr><td>cell</td></tr></table>` +
+		`<video src="https://example.com/v.mp4" controls></video>` +
+		`<iframe src="https://www.youtube.com/embed/abc" width="560" height="315" allowfullscreen></iframe>` +
+		`<iframe src="https://evil.example.com/frame" width="10"></iframe></div>`
+
+	tbl := []struct {
+		name     string
+		policy   *SanitizePolicy
+		contains []string
+		missing  []string
+	}{
+		{name: "nil is default", policy: nil,
+			contains: []string{`<h2>Title</h2>`, `<a href="https://example.com/x">good</a>`, `bad`,
+				`<img src="https://example.com/a.png" alt="pic">`, `<td>cell</td>`},
+			missing: []string{"script", "alert", "steal", "style", "onmouseover", "<form", "<input", "class=", "<video",
+				"<iframe", "javascript"}},
+		{name: "strict", policy: &SanitizePolicy{Level: SanitizeStrict},
+			contains: []string{`<h2>Title</h2>`, `<a href="https://example.com/x">good</a>`, "cell"},
+			missing:  []string{"<img", "<table", "<td", "<video", "<iframe", "script"}},
+		{name: "permissive", policy: &SanitizePolicy{Level: SanitizePermissive},
+			contains: []string{`<div class="post" style="color: red">`, `<video src="https://example.com/v.mp4" controls="">`,
+				`<img src="https://example.com/a.png" alt="pic">`},
+			missing: []string{"position", "onclick", "script", "<iframe"}},
+		{name: "embeds", policy: &SanitizePolicy{EmbedHosts: []string{"youtube.com", " player.vimeo.com "}},
+			contains: []string{`<iframe src="https://www.youtube.com/embed/abc" width="560" height="315" allowfullscreen=""` +
+				` sandbox="allow-scripts allow-same-origin allow-presentation allow-popups"></iframe>`,
+				`<a href="https://example.com/x">good</a>`},
+			missing: []string{"evil", `width="10"`}},
+		{name: "unknown level", policy: &SanitizePolicy{Level: "bad"},
+			contains: []string{`<img src="https://example.com/a.png" alt="pic">`},
+			missing:  []string{"<video", "script"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.policy.Sanitize(rich)
+			for _, s := range tt.contains {
+				assert.Contains(t, res, s)
+			}
+			for _, s := range tt.missing {
+				assert.NotContains(t, res, s)
+			}
+		})
+	}
+}
+
+func TestEmbedSrcRegexp(t *testing.T) {
+	assert.Nil(t, embedSrcRegexp([]string{"", " "}))
+	re := embedSrcRegexp([]string{"youtube.com", "player.vimeo.com."})
+	assert.True(t, re.MatchString("https://youtube.com/embed/1"))
+	assert.True(t, re.MatchString("https://www.youtube.com/embed/1"))
+	assert.True(t, re.MatchString("https://player.vimeo.com"))
+	assert.False(t, re.MatchString("http://www.youtube.com/embed/1"), "https only")
+	assert.False(t, re.MatchString("https://youtube.com.evil.com/embed/1"))
+	assert.False(t, re.MatchString("https://notyoutube.com/embed/1"))
+	assert.False(t, re.MatchString("https://vimeo.com/1"))
+}
+
+func TestExtractSanitizesRich(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>Post</title></head><body><article class="post">
+			<p onclick="steal()">The article text is long enough, with commas, to be extracted, and it has a script.</p>
+			<script>alert("xss")</script><p style="display:none">Hidden <img src="/a.png" onerror="steal()"></p>
+			</article></body></html>`))
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second, Sanitizer: &SanitizePolicy{Level: SanitizeStrict}}
+	res, err := lr.Extract(context.Background(), ts.URL)
+	require.NoError(t, err)
+	assert.Contains(t, res.Rich, "<p>The article text is long enough")
+	for _, s := range []string{"steal", "alert", "style", "<img"} {
+		assert.NotContains(t, res.Rich, s)
+	}
+}
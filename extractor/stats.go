@@ -0,0 +1,269 @@
+package extractor
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// reading speeds used for Response.ReadingTime
+const (
+	wordsPerMinute    = 230 // words of languages separating words with spaces
+	cjkCharsPerMinute = 500 // chinese and japanese characters, each counted as a word
+)
+
+// language detection parameters
+const (
+	minLanguageWords   = 3    // stop words needed to detect language of latin text
+	languageSampleSize = 5000 // characters of the text used to detect language
+)
+
+// stopWords are the most frequent words of languages written in latin script, used to tell them apart
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "are", "this", "have", "be"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "mit", "den", "sich", "auf", "ich", "auch"},
+	"fr": {"le", "la", "les", "et", "des", "est", "un", "une", "du", "pas", "que", "pour", "dans", "qui", "sur"},
+	"es": {"el", "la", "los", "las", "y", "que", "es", "en", "un", "una", "por", "del", "con", "para", "se"},
+	"it": {"il", "la", "che", "di", "e", "un", "una", "per", "non", "sono", "gli", "del", "della", "con", "è"},
+	"pt": {"o", "a", "os", "que", "e", "do", "da", "em", "um", "uma", "não", "para", "com", "se", "é"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "ook", "maar"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "av", "för", "med", "inte", "den", "till", "har", "jag"},
+	"pl": {"i", "w", "nie", "się", "na", "że", "jest", "to", "do", "z", "jak", "ale", "o", "co", "przez"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "ne", "gibi", "daha", "olan", "ama", "kadar", "değil"},
+}
+
+// stopWordLangs maps stop words to languages using them
+var stopWordLangs = func() map[string][]string {
+	res := map[string][]string{}
+	for lang, words := range stopWords {
+		for _, w := range words {
+			res[w] = append(res[w], lang)
+		}
+	}
+	return res
+}()
+
+// langMetaSelectors are meta tags declaring language of the page, read when html has no lang attribute
+var langMetaSelectors = []string{`meta[http-equiv="content-language" i]`, `meta[name="language" i]`,
+	`meta[name="dc.language" i]`, `meta[property="og:locale"]`}
+
+// setStats fills word and character counts, reading time and language of the response from the text of the
+// article, the same for any format of Response.Content. Language declared by the page is used if set,
+// otherwise detected from the text.
+func setStats(rb *Response, text, declared string) {
+	rb.WordCount, rb.CharCount, rb.ReadingTime = textStats(text)
+	rb.Language = declared
+	if rb.Language == "" {
+		rb.Language = detectLanguage(rb.Title + "\n" + text)
+	}
+}
+
+// articleText returns text of the article document without the title heading, with words of adjacent
+// blocks separated by a space and without list markers or quote prefixes of structured text
+func articleText(doc *goquery.Document, title string) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			return
+		}
+		block := n.Type == html.ElementNode && (textBlockTags[n.Data] || n.Data == "td" || n.Data == "th" || n.Data == "br")
+		if block {
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			b.WriteString(" ")
+		}
+	}
+	for _, n := range doc.Find("body").Nodes {
+		walk(n)
+	}
+	return stripTitle(strings.Join(strings.Fields(b.String()), " "), title)
+}
+
+// textStats returns number of words and characters of the text, not counting spaces. Chinese and japanese
+// characters are counted as words, as these languages don't separate words with spaces.
+// Reading time in minutes is rounded up, at least one minute for non-empty text.
+func textStats(text string) (words, chars, minutes int) {
+	var cjk, spaced int
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case isCJK(r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if !inWord {
+				spaced++
+			}
+			inWord = true
+		}
+		chars++
+	}
+	words = cjk + spaced
+	if words == 0 {
+		return 0, chars, 0
+	}
+	return words, chars, int(math.Ceil(float64(spaced)/wordsPerMinute + float64(cjk)/cjkCharsPerMinute))
+}
+
+// isCJK reports whether the rune is a chinese or japanese character. Korean is written with spaces
+// between words, so hangul is counted as regular words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// pageLanguage returns language declared by the page, from lang attribute of html or meta tags
+func pageLanguage(doc *goquery.Document) string {
+	if lang := languageCode(doc.Find("html").AttrOr("lang", "")); lang != "" {
+		return lang
+	}
+	if lang := languageCode(doc.Find("html").AttrOr("xml:lang", "")); lang != "" {
+		return lang
+	}
+	for _, sel := range langMetaSelectors {
+		if lang := languageCode(doc.Find(sel).First().AttrOr("content", "")); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// languageCode returns primary language subtag of language tag or locale, like "en" for "en-US" or "pt_BR".
+// Returns empty string for values which are not language codes.
+func languageCode(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, ",;"); i >= 0 { // content-language may list several languages
+		tag = tag[:i]
+	}
+	code, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	code = strings.ToLower(code)
+	if len(code) < 2 || len(code) > 3 {
+		return ""
+	}
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return code
+}
+
+// detectLanguage guesses language of the text by its script, by stop words for latin script
+// and by specific letters for cyrillic.
+// Returns empty string if language can't be detected reliably.
+func detectLanguage(text string) string {
+	if runes := []rune(text); len(runes) > languageSampleSize {
+		text = string(runes[:languageSampleSize])
+	}
+	scripts := map[string]int{}
+	for _, r := range text {
+		if script := letterScript(r); script != "" {
+			scripts[script]++
+		}
+	}
+	script, best := "", 0
+	for s, n := range scripts {
+		if n > best || (n == best && s < script) {
+			script, best = s, n
+		}
+	}
+
+	switch script {
+	case "":
+		return ""
+	case "kana", "han":
+		if scripts["kana"]*10 > scripts["han"] { // japanese mixes kana with kanji, chinese has no kana
+			return "ja"
+		}
+		return "zh"
+	case "cyrillic":
+		return cyrillicLanguage(text)
+	case "arabic":
+		if strings.ContainsAny(text, "پچژگ") {
+			return "fa"
+		}
+		return "ar"
+	case "latin":
+		return latinLanguage(text)
+	}
+	return script // other scripts are used by a single language and named by it
+}
+
+// letterScript returns script of the letter, named by language for scripts used by a single language
+func letterScript(r rune) string {
+	switch {
+	case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+		return "kana"
+	case unicode.Is(unicode.Han, r):
+		return "han"
+	case unicode.Is(unicode.Hangul, r):
+		return "ko"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "el"
+	case unicode.Is(unicode.Arabic, r):
+		return "arabic"
+	case unicode.Is(unicode.Hebrew, r):
+		return "he"
+	case unicode.Is(unicode.Thai, r):
+		return "th"
+	case unicode.Is(unicode.Devanagari, r):
+		return "hi"
+	case unicode.Is(unicode.Armenian, r):
+		return "hy"
+	case unicode.Is(unicode.Georgian, r):
+		return "ka"
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	}
+	return ""
+}
+
+// cyrillicLanguage tells belarusian, ukrainian and serbian from russian by letters only they use
+func cyrillicLanguage(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "ў"):
+		return "be"
+	case strings.ContainsAny(lower, "їєґ"), strings.Contains(lower, "і") && !strings.ContainsAny(lower, "ыэ"):
+		return "uk"
+	case strings.ContainsAny(lower, "ђћџљњј"):
+		return "sr"
+	}
+	return "ru"
+}
+
+// latinLanguage returns language with the most stop words in the text, if it is ahead of the others
+func latinLanguage(text string) string {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, lang := range stopWordLangs[word] {
+			counts[lang]++
+		}
+	}
+	lang, best, second := "", 0, 0
+	for l, n := range counts {
+		switch {
+		case n > best || (n == best && l < lang):
+			lang, best, second = l, n, max(best, second)
+		case n > second:
+			second = n
+		}
+	}
+	if best < minLanguageWords || best == second {
+		return ""
+	}
+	return lang
+}
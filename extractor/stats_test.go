@@ -0,0 +1,130 @@
+package extractor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextStats(t *testing.T) {
+	tbl := []struct {
+		text                  string
+		words, chars, minutes int
+	}{
+		{"", 0, 0, 0},
+		{"  \n ", 0, 0, 0},
+		{"Hello, world!", 2, 12, 1},
+		{"It's 2024 - the year\tof e-mail.", 6, 25, 1},
+		{"Привет, мир", 2, 10, 1},
+		{"日本語の文章です。", 8, 9, 1},
+		{"Go言語 is fun", 5, 9, 1},
+		{"안녕하세요 세계", 2, 7, 1},
+		{strings.Repeat("word ", 461), 461, 1844, 3},
+		{strings.Repeat("字", 1001), 1001, 1001, 3},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			words, chars, minutes := textStats(tt.text)
+			assert.Equal(t, tt.words, words, "words")
+			assert.Equal(t, tt.chars, chars, "chars")
+			assert.Equal(t, tt.minutes, minutes, "minutes")
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tbl := []struct {
+		text, lang string
+	}{
+		{"The quick brown fox jumps over the lazy dog, and it was fun to see that.", "en"},
+		{"Der schnelle braune Fuchs springt über den faulen Hund, und das ist nicht schlecht.", "de"},
+		{"Le renard brun rapide saute par-dessus le chien paresseux, et c'est pour les enfants.", "fr"},
+		{"El rápido zorro marrón salta sobre el perro perezoso, y es para los niños que lo ven.", "es"},
+		{"Быстрая коричневая лиса прыгает через ленивую собаку.", "ru"},
+		{"Швидка бура лисиця стрибає через лінивого собаку і їсть.", "uk"},
+		{"Хуткая бурая ліса скача праз ляніўага сабаку.", "be"},
+		{"敏捷的棕色狐狸跳过了懒狗。", "zh"},
+		{"素早い茶色の狐が怠け者の犬を飛び越える。", "ja"},
+		{"빠른 갈색 여우가 게으른 개를 뛰어넘는다.", "ko"},
+		{"Η γρήγορη καφέ αλεπού πηδάει πάνω από τον τεμπέλη σκύλο.", "el"},
+		{"الثعلب البني السريع يقفز فوق الكلب الكسول", "ar"},
+		{"Статья про Go и Kubernetes, написанная по-русски.", "ru"},
+		{"Lorem ipsum dolor sit amet", ""},
+		{"12345 !!!", ""},
+		{"", ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.lang+" "+tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.lang, detectLanguage(tt.text))
+		})
+	}
+}
+
+func TestPageLanguage(t *testing.T) {
+	tbl := []struct {
+		html, lang string
+	}{
+		{`<html lang="en-US"><head></head></html>`, "en"},
+		{`<html lang="DE"><head><meta http-equiv="content-language" content="fr"></head></html>`, "de"},
+		{`<html xml:lang="ru"><head></head></html>`, "ru"},
+		{`<html><head><meta http-equiv="Content-Language" content="fr, en"></head></html>`, "fr"},
+		{`<html><head><meta property="og:locale" content="pt_BR"></head></html>`, "pt"},
+		{`<html lang="{{lang}}"><head><meta name="language" content="es"></head></html>`, "es"},
+		{`<html lang="x"><head></head></html>`, ""},
+		{`<html><head></head></html>`, ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.html, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			require.NoError(t, err)
+			assert.Equal(t, tt.lang, pageLanguage(doc))
+		})
+	}
+}
+
+func TestExtractStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := ""
+		if r.URL.Path == "/declared" {
+			lang = ` lang="fr-FR"`
+		}
+		extra := map[string]string{"/list": "<ol><li>First item of the list</li><li>Second item</li></ol>",
+			"/quote": "<blockquote><p>The quoted words, with commas, of somebody else.</p></blockquote>"}[r.URL.Path]
+		_, _ = w.Write([]byte(`<html` + lang + `><head><title>Post</title></head><body><article>
+			<p>The article text is long enough, with commas, to be extracted, and it is in english.</p>` + extra + `
+			<p>The second paragraph, with more commas, so the content is kept for the stats.</p>
+			</article></body></html>`))
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second, SnippetSize: 200}
+	res, err := lr.Extract(context.Background(), ts.URL+"/detected")
+	require.NoError(t, err)
+	words, chars, _ := textStats(res.Content)
+	assert.Equal(t, words, res.WordCount)
+	assert.Equal(t, chars, res.CharCount)
+	assert.Greater(t, res.WordCount, 25)
+	assert.Equal(t, 1, res.ReadingTime)
+	assert.Equal(t, "en", res.Language, "detected from the text")
+
+	res, err = lr.Extract(context.Background(), ts.URL+"/declared")
+	require.NoError(t, err)
+	assert.Equal(t, "fr", res.Language, "declared by the page")
+
+	for _, path := range []string{"/list", "/quote"} {
+		structured, err := lr.ExtractWithOptions(context.Background(), ts.URL+path, ExtractOptions{TextWidth: 30})
+		require.NoError(t, err)
+		flat, err := lr.ExtractWithOptions(context.Background(), ts.URL+path, ExtractOptions{Text: TextFlat})
+		require.NoError(t, err)
+		assert.NotEqual(t, flat.Content, structured.Content)
+		assert.Equal(t, flat.WordCount, structured.WordCount, "same for any text format")
+		assert.Equal(t, flat.CharCount, structured.CharCount, "same for any text format")
+	}
+}
@@ -0,0 +1,378 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"golang.org/x/net/html"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+// suggestIdxAttr numbers elements of the page, to find the best scored node in the unmodified copy of the page
+const suggestIdxAttr = "data-ukeeper-idx"
+
+// maxSuggestExcludes limits the number of suggested exclude selectors
+const maxSuggestExcludes = 10
+
+var (
+	// reStableName matches hand-written id or class, generated ones like "css-1x2y3z" or "post-12345" usually have digits
+	reStableName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z_-]*[a-zA-Z0-9]?$`)
+	// reBoilerplate matches class or id of blocks which are not a part of the article
+	reBoilerplate = regexp.MustCompile(`(?i)share|social|related|comment|disqus|promo|sponsor|advert|(^|[\s_-])ads?([\s_-]|$)|` +
+		`banner|newsletter|subscri|breadcrumb|tags|author-?bio|widget|sidebar|popup|modal|cookie|recommend|read-?more`)
+	// boilerplateTags are elements excluded by tag name if they have no stable class or id
+	boilerplateTags = []string{"aside", "nav", "form", "footer"}
+	// blockTags are elements checked for boilerplate inside the content
+	blockTags = "div,section,aside,nav,form,footer,header,ul,ol,p,table,figure,blockquote"
+)
+
+// Suggestion is a rule proposed from sample pages
+type Suggestion struct {
+	Content  string             `json:"content"`  // selector of the best scored node, shared by most samples
+	Excludes []string           `json:"excludes"` // selectors of boilerplate blocks inside the content, recurring on samples
+	Matched  int                `json:"matched"`  // number of samples where the content selector matches the best scored node
+	Samples  []SuggestionSample `json:"samples"`
+}
+
+// SuggestionSample is the result of a single sample page
+type SuggestionSample struct {
+	URL     string `json:"url"`
+	Path    string `json:"path,omitempty"` // css-like path of the best scored node
+	Matched bool   `json:"matched"`        // content selector matches the best scored node
+	Error   string `json:"error,omitempty"`
+}
+
+// suggestSample is a fetched sample page with its best scored node
+type suggestSample struct {
+	res  *SuggestionSample
+	doc  *goquery.Document // unmodified page
+	node *goquery.Selection
+}
+
+// SuggestRule fetches sample pages with the fetch settings of the rule, finds the node readability scores highest
+// on each page and proposes a content selector matching these nodes on as many samples as possible, preferring
+// ids and classes to element positions. Blocks inside the content looking like boilerplate, like sharing buttons,
+// comments, link lists or blocks with the same text on all pages, are proposed as excludes if they recur on
+// most samples. Samples are fetched concurrently, the ones failed or not fetched before ctx is done have Error set.
+func (f *UReadability) SuggestRule(ctx context.Context, urls []string, rule *datastore.Rule) (*Suggestion, error) {
+	res := &Suggestion{Samples: []SuggestionSample{}}
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u != "" {
+			res.Samples = append(res.Samples, SuggestionSample{URL: u})
+		}
+	}
+	if len(res.Samples) == 0 {
+		return nil, errors.New("no sample urls")
+	}
+
+	fetched := make([]suggestSample, len(res.Samples))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, archiveConcurrency)
+	for i := range res.Samples {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			sample, err := f.suggestSample(ctx, &res.Samples[i], rule)
+			if err != nil {
+				if ctx.Err() != nil {
+					err = fmt.Errorf("timed out: %w", err)
+				}
+				log.Printf("[WARN] can't use %s as rule sample, %v", res.Samples[i].URL, err)
+				res.Samples[i].Error = err.Error()
+				return
+			}
+			fetched[i] = sample
+		})
+	}
+	wg.Wait()
+	samples := make([]suggestSample, 0, len(fetched)) // in order of urls, first samples win ties
+	for _, s := range fetched {
+		if s.res != nil {
+			samples = append(samples, s)
+		}
+	}
+	if len(samples) == 0 {
+		return res, errors.New("no content found on sample pages")
+	}
+
+	res.Content = sharedSelector(samples)
+	for _, s := range samples {
+		if s.res.Matched = matchesOnly(s.doc, res.Content, s.node); s.res.Matched {
+			res.Matched++
+		}
+	}
+	res.Excludes = suggestExcludes(samples, res.Content)
+	log.Printf("[INFO] suggested rule content=%q, excludes=%v, matched %d of %d samples",
+		res.Content, res.Excludes, res.Matched, len(res.Samples))
+	return res, nil
+}
+
+// suggestSample fetches the page and finds its best scored node
+func (f *UReadability) suggestSample(ctx context.Context, sample *SuggestionSample, rule *datastore.Rule) (suggestSample, error) {
+	_, body, err := f.FetchPage(ctx, sample.URL, rule)
+	if err != nil {
+		return suggestSample{}, err
+	}
+	scored, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return suggestSample{}, fmt.Errorf("parse page: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return suggestSample{}, fmt.Errorf("parse page: %w", err)
+	}
+	for _, d := range []*goquery.Document{scored, doc} {
+		d.Find("*").Each(func(i int, s *goquery.Selection) { s.SetAttr(suggestIdxAttr, strconv.Itoa(i)) })
+	}
+
+	nodes := scoreNodes(scored)
+	if len(nodes) == 0 {
+		return suggestSample{}, errors.New("no content candidates")
+	}
+	node := doc.Find("[" + suggestIdxAttr + "=\"" + nodes[0].sel.AttrOr(suggestIdxAttr, "") + "\"]")
+	doc.Find("*").RemoveAttr(suggestIdxAttr)
+	if node.Length() != 1 {
+		return suggestSample{}, errors.New("best scored node not found")
+	}
+	sample.Path = nodePath(node)
+	return suggestSample{res: sample, doc: doc, node: node}, nil
+}
+
+// sharedSelector returns the selector matching the best scored node on the most samples. Candidates of the first
+// samples and more stable candidates win ties.
+func sharedSelector(samples []suggestSample) string {
+	best, bestMatched := "", -1
+	seen := map[string]bool{}
+	for _, s := range samples {
+		for _, sel := range selectorCandidates(s.node) {
+			if seen[sel] {
+				continue
+			}
+			seen[sel] = true
+			matched := 0
+			for _, t := range samples {
+				if matchesOnly(t.doc, sel, t.node) {
+					matched++
+				}
+			}
+			if matched > bestMatched {
+				best, bestMatched = sel, matched
+			}
+		}
+	}
+	return best
+}
+
+// selectorCandidates returns selectors of the node, most stable first: id, classes, tag of semantic elements,
+// the same under parent's id or class, and the position from body as the last resort
+func selectorCandidates(s *goquery.Selection) []string {
+	var res []string
+	own := ownSelectors(s)
+	res = append(res, own...)
+	tag := goquery.NodeName(s)
+	if tag == "article" || tag == "main" {
+		res = append(res, tag)
+	}
+	if parent := s.Parent(); parent.Length() > 0 && !parent.Is("html,body") {
+		child := tag
+		if len(own) > 0 && !strings.HasPrefix(own[0], "#") {
+			child = own[0]
+		}
+		for _, p := range ownSelectors(parent) {
+			res = append(res, p+" > "+child)
+		}
+	}
+	res = append(res, positionSelector(s))
+	return slices.Compact(res)
+}
+
+// ownSelectors returns selectors made of stable id and classes of the node
+func ownSelectors(s *goquery.Selection) []string {
+	var res []string
+	if id := s.AttrOr("id", ""); reStableName.MatchString(id) {
+		res = append(res, "#"+id)
+	}
+	tag := goquery.NodeName(s)
+	var classes []string
+	for c := range strings.FieldsSeq(s.AttrOr("class", "")) {
+		if reStableName.MatchString(c) {
+			classes = append(classes, c)
+			res = append(res, tag+"."+c)
+		}
+	}
+	if len(classes) > 1 {
+		res = append(res, tag+"."+strings.Join(classes, "."))
+	}
+	return res
+}
+
+// positionSelector returns selector of the node by its position from body, like body > div:nth-of-type(2) > article
+func positionSelector(s *goquery.Selection) string {
+	var parts []string
+	for n := s.Get(0); n != nil && n.Type == html.ElementNode && n.Data != "body" && n.Data != "html"; n = n.Parent {
+		pos, count := 0, 0
+		for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == n.Data {
+				count++
+				if c == n {
+					pos = count
+				}
+			}
+		}
+		part := n.Data
+		if count > 1 {
+			part += ":nth-of-type(" + strconv.Itoa(pos) + ")"
+		}
+		parts = append(parts, part)
+	}
+	parts = append(parts, "body")
+	slices.Reverse(parts)
+	return strings.Join(parts, " > ")
+}
+
+// matchesOnly checks if selector matches the node and nothing else in the document
+func matchesOnly(doc *goquery.Document, sel string, node *goquery.Selection) bool {
+	m := doc.Find(sel)
+	return m.Length() == 1 && m.Get(0) == node.Get(0)
+}
+
+// suggestExcludes returns selectors of boilerplate blocks inside the content, found on more than half of samples
+func suggestExcludes(samples []suggestSample, content string) []string {
+	// texts of blocks on each sample, the same text on all samples is a boilerplate like a subscription form
+	texts := make([]map[string]bool, len(samples))
+	roots := make([]*goquery.Selection, len(samples))
+	for i, s := range samples {
+		if roots[i] = s.doc.Find(content); roots[i].Length() == 0 {
+			roots[i] = s.node
+		}
+		texts[i] = map[string]bool{}
+		roots[i].Find(blockTags).Each(func(_ int, b *goquery.Selection) { texts[i][blockText(b)] = true })
+	}
+	repeated := func(text string) bool {
+		if len(samples) < 2 || len(text) < 20 {
+			return false
+		}
+		for _, t := range texts {
+			if !t[text] {
+				return false
+			}
+		}
+		return true
+	}
+
+	counts := map[string]int{}
+	var order []string
+	for i := range samples {
+		rootText := len(blockText(roots[i]))
+		found := map[string]bool{}
+		var walk func(s *goquery.Selection)
+		walk = func(s *goquery.Selection) {
+			s.Children().Each(func(_ int, c *goquery.Selection) {
+				if !c.Is(blockTags) || !isBoilerplate(c, repeated) {
+					walk(c)
+					return
+				}
+				sel := excludeSelector(c)
+				if sel == "" || found[sel] {
+					walk(c)
+					return
+				}
+				// excluded blocks should not take away the content itself
+				removed := 0
+				roots[i].Find(sel).Each(func(_ int, e *goquery.Selection) { removed += len(blockText(e)) })
+				if roots[i].Is(sel) || roots[i].ParentsFiltered(sel).Length() > 0 || removed*2 > rootText {
+					walk(c)
+					return
+				}
+				found[sel] = true
+				if counts[sel]++; counts[sel] == 1 {
+					order = append(order, sel)
+				}
+			})
+		}
+		walk(roots[i])
+	}
+
+	var found []string
+	for _, sel := range order {
+		if counts[sel]*2 > len(samples) {
+			found = append(found, sel)
+		}
+	}
+	// drop excludes nested in other excludes on the first sample
+	res := []string{}
+	for _, sel := range found {
+		if !nestedIn(roots[0].Find(sel), sel, found) && len(res) < maxSuggestExcludes {
+			res = append(res, sel)
+		}
+	}
+	return res
+}
+
+// nestedIn checks if all elements of the selection are inside elements matched by other selectors
+func nestedIn(s *goquery.Selection, sel string, selectors []string) bool {
+	if s.Length() == 0 {
+		return false
+	}
+	for _, other := range selectors {
+		if other == sel {
+			continue
+		}
+		inside := s.FilterFunction(func(_ int, e *goquery.Selection) bool { return e.ParentsFiltered(other).Length() > 0 })
+		if inside.Length() == s.Length() {
+			return true
+		}
+	}
+	return false
+}
+
+// isBoilerplate checks if the block inside the content looks like it's not a part of the article
+func isBoilerplate(s *goquery.Selection, repeated func(text string) bool) bool {
+	if slices.Contains(boilerplateTags, goquery.NodeName(s)) || reBoilerplate.MatchString(s.AttrOr("class", "")+" "+s.AttrOr("id", "")) {
+		return true
+	}
+	text := blockText(s)
+	if len(text) >= 20 && s.Find("a").Length() >= 3 && linkDensity(s) > 0.5 {
+		return true
+	}
+	return repeated(text)
+}
+
+// excludeSelector returns generic selector of the boilerplate block, by id, class or tag, empty if there is none
+func excludeSelector(s *goquery.Selection) string {
+	if id := s.AttrOr("id", ""); reStableName.MatchString(id) {
+		return "#" + id
+	}
+	var classes []string
+	for c := range strings.FieldsSeq(s.AttrOr("class", "")) {
+		if reStableName.MatchString(c) {
+			classes = append(classes, c)
+		}
+	}
+	for _, c := range classes {
+		if reBoilerplate.MatchString(c) {
+			return "." + c
+		}
+	}
+	if len(classes) > 0 {
+		return "." + classes[0]
+	}
+	if tag := goquery.NodeName(s); slices.Contains(boilerplateTags, tag) {
+		return tag
+	}
+	return ""
+}
+
+// blockText returns the text of the block with spaces collapsed
+func blockText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
@@ -0,0 +1,128 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+func TestSuggestRule(t *testing.T) {
+	paragraph := func(n, i int) string {
+		return fmt.Sprintf("<p>Paragraph %d of article %d is long enough, with commas, and many words, to be scored as "+
+			"a meaningful part of the article text, not as a navigation or a caption.</p>", i, n)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/post/%d", &n); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var body strings.Builder
+		for i := range 3 + n {
+			body.WriteString(paragraph(n, i))
+		}
+		_, _ = fmt.Fprintf(w, `<html><head><title>Post %d</title></head><body>
+			<div class="layout"><div class="menu"><a href="/">Home</a> <a href="/news">News</a></div>
+			<div class="content-%d">
+				<article class="post-body" id="post-%d0000">%s
+					<div class="share-buttons"><a href="/s/1">Twitter</a> <a href="/s/2">Facebook</a> <a href="/s/3">VK</a></div>
+					<div class="promo-%d">Subscribe to our newsletter and get the best articles every week</div>
+				</article>
+			</div></div></body></html>`, n, n, n, body.String(), n)
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	rule := &datastore.Rule{Domain: "example.com"}
+
+	t.Run("shared selector", func(t *testing.T) {
+		res, err := lr.SuggestRule(t.Context(), []string{ts.URL + "/post/1", " ", ts.URL + "/post/2", ts.URL + "/post/3"}, rule)
+		require.NoError(t, err)
+		assert.Equal(t, "article.post-body", res.Content)
+		assert.Equal(t, 3, res.Matched)
+		require.Len(t, res.Samples, 3, "empty url is skipped")
+		for _, s := range res.Samples {
+			assert.True(t, s.Matched, s.URL)
+			assert.Empty(t, s.Error)
+			assert.Contains(t, s.Path, "article.post-body")
+		}
+		assert.Equal(t, []string{".share-buttons"}, res.Excludes, "promo block has a different class on each page")
+	})
+
+	t.Run("failed sample", func(t *testing.T) {
+		res, err := lr.SuggestRule(t.Context(), []string{ts.URL + "/post/1", ts.URL + "/missing"}, rule)
+		require.NoError(t, err)
+		assert.Equal(t, "article.post-body", res.Content)
+		assert.Equal(t, 1, res.Matched)
+		require.Len(t, res.Samples, 2)
+		assert.NotEmpty(t, res.Samples[1].Error)
+		assert.False(t, res.Samples[1].Matched)
+	})
+
+	t.Run("slow sample timed out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+		defer cancel()
+		st := time.Now()
+		res, err := lr.SuggestRule(ctx, []string{ts.URL + "/post/1", ts.URL + "/slow", ts.URL + "/post/2"}, rule)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(st), 5*time.Second)
+		assert.Equal(t, "article.post-body", res.Content)
+		assert.Equal(t, 2, res.Matched)
+		require.Len(t, res.Samples, 3)
+		assert.Contains(t, res.Samples[1].Error, "timed out")
+		assert.True(t, res.Samples[2].Matched, "samples keep order of urls")
+	})
+
+	t.Run("no urls", func(t *testing.T) {
+		_, err := lr.SuggestRule(t.Context(), []string{"", " "}, rule)
+		require.EqualError(t, err, "no sample urls")
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		res, err := lr.SuggestRule(t.Context(), []string{ts.URL + "/missing"}, rule)
+		require.EqualError(t, err, "no content found on sample pages")
+		require.NotNil(t, res)
+		assert.NotEmpty(t, res.Samples[0].Error)
+	})
+}
+
+func TestSuggestRuleRepeatedText(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<html><body><div id="main"><h1>%[1]s</h1>
+			<p>The article at %[1]s starts here, and it is long enough, with commas, to get a good readability score.</p>
+			<p>Second paragraph of %[1]s adds more text, with more commas, so the block is the best candidate.</p>
+			<div class="note">All materials are copyrighted, reprints are allowed with a link only</div>
+			</div></body></html>`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	lr := UReadability{TimeOut: 30 * time.Second}
+	res, err := lr.SuggestRule(t.Context(), []string{ts.URL + "/a", ts.URL + "/b"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#main", res.Content)
+	assert.Equal(t, 2, res.Matched)
+	assert.Equal(t, []string{".note"}, res.Excludes, "the same text on every sample")
+}
+
+func TestSelectorCandidates(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body><div id="wrap"><div class="col"></div>
+		<div class="col"><main class="text big x-123456"></main></div></div></body></html>`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.text", "main.big", "main.text.big", "main", "div.col > main.text",
+		"body > div > div:nth-of-type(2) > main"}, selectorCandidates(doc.Find("main")))
+	assert.Equal(t, []string{"#wrap", "body > div"}, selectorCandidates(doc.Find("#wrap")))
+}
@@ -3,7 +3,10 @@ package extractor
 import (
 	"io"
 	"net/http"
+	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	log "github.com/go-pkgz/lgr"
 
@@ -21,13 +24,13 @@ const (
 
 // get clean text from html content
 func (f *UReadability) getText(content, title string) string {
-	cleanText := sanitize.HTML(content)
-	cleanText = strings.Replace(cleanText, title, "", 1) // get rid of title in snippet
+	cleanText := sanitize.HTML(reBlockEnd.ReplaceAllString(content, "$0 ")) // words of adjacent blocks are not joined
 	cleanText = strings.ReplaceAll(cleanText, "\t", " ")
 	cleanText = strings.TrimSpace(cleanText)
 
 	// replace multiple spaces by one space
 	cleanText = reSpaces.ReplaceAllString(cleanText, " ")
+	cleanText = stripTitle(cleanText, title)
 
 	// fix joined sentences due lack of \n
 	matches := reDot.FindAllStringSubmatch(cleanText, -1)
@@ -39,23 +42,43 @@ func (f *UReadability) getText(content, title string) string {
 	return cleanText
 }
 
-// get snippet from clean text content
-func (f *UReadability) getSnippet(cleanText string) string {
-	cleanText = strings.ReplaceAll(cleanText, "\n", " ")
-	size := min(len([]rune(cleanText)), f.SnippetSize)
-	snippet := []rune(cleanText)[:size]
-	// go back in snippet and found first space
-	for i := len(snippet) - 1; i >= 0; i-- {
-		if snippet[i] == ' ' {
-			snippet = snippet[:i]
-			break
+// reBlockEnd matches closing tags of block elements, sanitize.HTML breaks lines on paragraphs only
+var reBlockEnd = regexp.MustCompile(`(?i)</(h[1-6]|li|div|blockquote|dd|dt|td|th|tr|pre|section|article|figcaption)>`)
+
+// titleSeparators split page title into the article title and the site name, like "Post • Blog"
+var titleSeparators = []string{" | ", " • ", " - ", " – ", " — ", " :: ", " / "}
+
+// stripTitle removes the title heading from the start of the text. Page title often has the site name
+// added, so the article part of the title is stripped if the full title isn't there.
+func stripTitle(text, title string) string {
+	title = reSpaces.ReplaceAllString(strings.TrimSpace(title), " ")
+	if title == "" {
+		return text
+	}
+	candidates := []string{title}
+	for _, sep := range titleSeparators {
+		if parts := strings.Split(title, sep); len(parts) > 1 {
+			candidates = append(candidates, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[len(parts)-1]))
+		}
+	}
+	for _, c := range candidates {
+		rest, ok := strings.CutPrefix(text, c)
+		if next, _ := utf8.DecodeRuneInString(rest); c == "" || !ok || unicode.IsLetter(next) || unicode.IsDigit(next) {
+			continue // not the whole title, just starts the same
 		}
+		return strings.TrimSpace(rest)
 	}
-	return string(snippet) + " ..."
+	return text
 }
 
 // detect encoding, content type and convert content to utf8
 func (f *UReadability) toUtf8(content []byte, header http.Header) (contentType, origEncoding, result string) {
+	contentType, origEncoding, result, _ = f.decodeBody(content, header)
+	return contentType, origEncoding, result
+}
+
+// decodeBody is toUtf8 also reporting how content type and charset were detected
+func (f *UReadability) decodeBody(content []byte, header http.Header) (contentType, origEncoding, result string, info CharsetDiagnostics) {
 	getContentTypeAndEncoding := func(str string) (contentType, encoding string) { // from "text/html; charset=windows-1251"
 		elems := strings.Split(str, ";")
 		contentType = strings.TrimSpace(elems[0])
@@ -70,20 +93,24 @@ func (f *UReadability) toUtf8(content []byte, header http.Header) (contentType,
 	result = body
 	contentType = DefaultContentType
 	origEncoding = DefaultEncoding
+	info.Source = "default"
+	defer func() { info.Charset = origEncoding }()
 
 	if h := header.Get("Content-Type"); h != "" {
 		contentType, origEncoding = getContentTypeAndEncoding(h)
+		info.HeaderContentType, info.Source = h, "header"
 	}
 
 	dbody, err := goquery.NewDocumentFromReader(strings.NewReader(body))
 	if err != nil {
-		return contentType, origEncoding, result
+		return contentType, origEncoding, result, info
 	}
 
 	dbody.Find("head meta").Each(func(_ int, s *goquery.Selection) {
 		if strings.EqualFold(s.AttrOr("http-equiv", ""), "Content-Type") {
 			contentTypeStr := s.AttrOr("content", "")
 			contentType, origEncoding = getContentTypeAndEncoding(contentTypeStr)
+			info.MetaContentType, info.Source = contentTypeStr, "meta"
 		}
 	})
 
@@ -92,15 +119,18 @@ func (f *UReadability) toUtf8(content []byte, header http.Header) (contentType,
 		rr, err := charset.NewReader(strings.NewReader(body), origEncoding)
 		if err != nil {
 			log.Printf("[WARN] charset reader failed, %v", err)
-			return contentType, origEncoding, result
+			info.Error = err.Error()
+			return contentType, origEncoding, result, info
 		}
 		conv2utf8, err := io.ReadAll(rr)
 		if err != nil {
 			log.Printf("[WARN] convert to utf-8 failed, %v", err)
-			return contentType, origEncoding, result
+			info.Error = err.Error()
+			return contentType, origEncoding, result, info
 		}
 		result = string(conv2utf8)
+		info.Converted = true
 	}
 
-	return contentType, origEncoding, result
+	return contentType, origEncoding, result, info
 }
@@ -18,6 +18,10 @@ func TestGetText(t *testing.T) {
 	}{
 		{name: "simple html", content: "<p>hello world</p>", title: "", want: "hello world"},
 		{name: "removes title", content: "<p>My Title some text</p>", title: "My Title", want: "some text"},
+		{name: "removes title heading", content: "<h1>My  Title</h1>\n<p>some text</p>", title: "My Title", want: "some text"},
+		{name: "removes title without site name", content: "<h1>My Title</h1>\n<p>text</p>", title: "My Title • Blog", want: "text"},
+		{name: "keeps title inside text", content: "<p>Text about My Title</p>", title: "My Title", want: "Text about My Title"},
+		{name: "keeps longer word", content: "<p>My Titles are here</p>", title: "My Title", want: "My Titles are here"},
 		{name: "collapses whitespace", content: "<p>hello    world</p>", title: "", want: "hello world"},
 		{name: "trims tabs", content: "<p>\thello\tworld</p>", title: "", want: "hello world"},
 		{name: "fixes joined sentences", content: "<p>first sentence.Second sentence</p>", title: "", want: "first sentence. Second sentence"},
@@ -32,28 +36,6 @@ func TestGetText(t *testing.T) {
 	}
 }
 
-func TestGetSnippet(t *testing.T) {
-	lr := UReadability{SnippetSize: 20}
-
-	tests := []struct {
-		name string
-		text string
-		want string
-	}{
-		{name: "short text", text: "hello", want: "hello ..."},
-		{name: "truncates at word boundary", text: "hello world this is a long text", want: "hello world this is ..."},
-		{name: "replaces newlines", text: "hello\nworld this is longer text", want: "hello world this is ..."},
-		{name: "empty", text: "", want: " ..."},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := lr.getSnippet(tt.text)
-			assert.Equal(t, tt.want, got)
-		})
-	}
-}
-
 func TestToUtf8(t *testing.T) {
 	lr := UReadability{}
 
@@ -97,3 +79,25 @@ func TestToUtf8(t *testing.T) {
 		assert.Contains(t, body, "hello")
 	})
 }
+
+func TestDecodeBody(t *testing.T) {
+	lr := UReadability{}
+
+	_, _, _, info := lr.decodeBody([]byte("<html><body>hello</body></html>"), http.Header{})
+	assert.Equal(t, CharsetDiagnostics{Source: "default", Charset: "utf-8"}, info)
+
+	h := http.Header{}
+	h.Set("Content-Type", "text/html; charset=unknown-xyz")
+	_, _, body, info := lr.decodeBody([]byte("<html><body>hello</body></html>"), h)
+	assert.Contains(t, body, "hello")
+	assert.Equal(t, "header", info.Source)
+	assert.Equal(t, "unknown-xyz", info.Charset)
+	assert.Empty(t, info.Error, "unknown label decoded with charset detected from content")
+
+	html := "<html><head><meta http-equiv=\"content-type\" content=\"text/html; charset=windows-1251\"></head><body>\xcf\xf0\xe8</body></html>"
+	_, enc, body, info := lr.decodeBody([]byte(html), h)
+	assert.Equal(t, "windows-1251", enc)
+	assert.Contains(t, body, "При")
+	assert.Equal(t, CharsetDiagnostics{HeaderContentType: "text/html; charset=unknown-xyz",
+		MetaContentType: "text/html; charset=windows-1251", Source: "meta", Charset: "windows-1251", Converted: true}, info)
+}
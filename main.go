@@ -3,6 +3,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,6 +16,7 @@ import (
 	"github.com/ukeeper/ukeeper-readability/datastore"
 	"github.com/ukeeper/ukeeper-readability/extractor"
 	"github.com/ukeeper/ukeeper-readability/rest"
+	"github.com/ukeeper/ukeeper-readability/tracing"
 )
 
 var revision string
@@ -23,14 +26,60 @@ var opts struct {
 	Port        int               `long:"port" env:"UKEEPER_PORT" default:"8080" description:"port"`
 	FrontendDir string            `long:"frontend-dir" env:"FRONTEND_DIR" default:"/srv/web" description:"directory with frontend templates and static/ directory for static assets"`
 	Credentials map[string]string `long:"creds" env:"CREDS" description:"credentials for protected calls (POST, DELETE /rules)"`
+	Users       bool              `long:"users" env:"USERS" description:"keep admin UI users with roles in mongo, creds are imported as admins on first start"`
+	SessionKey  string            `long:"session-secret" env:"SESSION_SECRET" description:"secret to sign login sessions, random if not set"`
 	Token       string            `long:"token" env:"UKEEPER_TOKEN" description:"token for API endpoint auth"`
+	APIKeys     bool              `long:"api-keys" env:"API_KEYS" description:"require per-client API keys managed on /keys page, token works as a master key"`
 	MongoURI    string            `short:"m" long:"mongo-uri" env:"MONGO_URI" required:"true" description:"MongoDB connection string"`
-	MongoDelay  time.Duration     `long:"mongo-delay" env:"MONGO_DELAY" default:"0" description:"mongo initial delay"`
+	MongoWait   time.Duration     `long:"mongo-wait" env:"MONGO_WAIT" default:"30s" description:"max time to wait for mongo to become reachable on start"`
+	MongoDelay  time.Duration     `long:"mongo-delay" env:"MONGO_DELAY" default:"0" description:"deprecated, use mongo-wait"`
 	MongoDB     string            `long:"mongo-db" env:"MONGO_DB" default:"ureadability" description:"mongo database name"`
 	CFAccountID string            `long:"cf-account-id" env:"CF_ACCOUNT_ID" description:"Cloudflare account ID for Browser Rendering API"`
 	CFAPIToken  string            `long:"cf-api-token" env:"CF_API_TOKEN" description:"Cloudflare API token with Browser Rendering Edit permission"`
 	CFRouteAll  bool              `long:"cf-route-all" env:"CF_ROUTE_ALL" description:"route every request through Cloudflare Browser Rendering (requires cf-account-id and cf-api-token)"`
-	Debug       bool              `long:"dbg" env:"DEBUG" description:"debug mode"`
+
+	HealthCheckCF bool `long:"health-check-cf" env:"HEALTH_CHECK_CF" description:"verify Cloudflare API token in readiness check"`
+
+	OIDCIssuer       string            `long:"oidc-issuer" env:"OIDC_ISSUER" description:"OpenID Connect issuer url for admin UI single sign-on"`
+	OIDCClientID     string            `long:"oidc-client-id" env:"OIDC_CLIENT_ID" description:"OpenID Connect client id"`
+	OIDCClientSecret string            `long:"oidc-client-secret" env:"OIDC_CLIENT_SECRET" description:"OpenID Connect client secret, empty for public clients"`
+	OIDCRedirectURL  string            `long:"oidc-redirect-url" env:"OIDC_REDIRECT_URL" description:"callback url, like https://example.com/auth/oidc/callback"`
+	OIDCScopes       []string          `long:"oidc-scope" env:"OIDC_SCOPES" env-delim:"," description:"extra scope to request, like groups"`
+	OIDCGroupsClaim  string            `long:"oidc-groups-claim" env:"OIDC_GROUPS_CLAIM" default:"groups" description:"ID token claim with user's groups"`
+	OIDCGroupRoles   map[string]string `long:"oidc-group-role" env:"OIDC_GROUP_ROLES" env-delim:"," description:"group to role mapping, group:role"`
+	OIDCDefaultRole  string            `long:"oidc-default-role" env:"OIDC_DEFAULT_ROLE" description:"role of users without mapped groups, login is denied if empty"`
+
+	HTTPProxy        string            `long:"http-proxy" env:"HTTP_PROXY_URL" description:"proxy for page fetching, http://, https:// or socks5:// URL"`
+	HTTPUserAgent    string            `long:"http-user-agent" env:"HTTP_USER_AGENT" description:"User-Agent for page fetching"`
+	HTTPHeaders      map[string]string `long:"http-header" env:"HTTP_HEADERS" env-delim:"," description:"extra header for page fetching, name:value"`
+	HTTPCookieJar    bool              `long:"http-cookie-jar" env:"HTTP_COOKIE_JAR" description:"keep cookies between page fetches"`
+	HTTPCACert       string            `long:"http-ca-cert" env:"HTTP_CA_CERT" description:"PEM file with extra root CAs for page fetching"`
+	HTTPMaxRedirects int               `long:"http-max-redirects" env:"HTTP_MAX_REDIRECTS" default:"10" description:"max redirects to follow, negative disables redirects"`
+
+	MaxPageSize    int      `long:"max-page-size" env:"MAX_PAGE_SIZE" default:"10" description:"max page size to fetch, in MB"`
+	MaxImageSize   int      `long:"max-image-size" env:"MAX_IMAGE_SIZE" default:"20" description:"max image size to probe, in MB"`
+	MaxArchiveSize int      `long:"max-archive-size" env:"MAX_ARCHIVE_SIZE" default:"50" description:"max total size of images of archived article, in MB"`
+	AllowedTypes   []string `long:"allowed-type" env:"ALLOWED_TYPES" env-delim:"," description:"accepted page content type (default: html, xhtml, plain text, xml and pdf)"`
+	MaxPages       int      `long:"max-pages" env:"MAX_PAGES" default:"1" description:"max pages of multi-page article to stitch, 1 disables following pages"`
+
+	Sanitize       string   `long:"sanitize" env:"SANITIZE" choice:"strict" choice:"default" choice:"permissive" default:"default" description:"allowlist of elements and attributes kept in rich content"`
+	SanitizeEmbeds []string `long:"sanitize-embed" env:"SANITIZE_EMBEDS" env-delim:"," description:"host of allowed iframe embeds, like www.youtube.com or player.vimeo.com"`
+
+	ImgProxyURL    string `long:"img-proxy-url" env:"IMG_PROXY_URL" description:"public url of the service for proxied images, like https://ukeeper.example.com; enables image proxy"`
+	ImgProxySecret string `long:"img-proxy-secret" env:"IMG_PROXY_SECRET" description:"secret to sign proxied image urls"`
+	ImgProxyCache  int    `long:"img-proxy-cache" env:"IMG_PROXY_CACHE" default:"64" description:"max size of proxied images cache, in MB, 0 disables cache"`
+	ImgProxyWidths []int  `long:"img-proxy-width" env:"IMG_PROXY_WIDTHS" env-delim:"," description:"width proxied images can be resized to"`
+
+	OutboundAllowPrivate bool     `long:"outbound-allow-private" env:"OUTBOUND_ALLOW_PRIVATE" description:"allow fetching from private, loopback and link-local addresses"`
+	OutboundAllow        []string `long:"outbound-allow" env:"OUTBOUND_ALLOW" env-delim:"," description:"host or CIDR always allowed for fetching"`
+	OutboundDeny         []string `long:"outbound-deny" env:"OUTBOUND_DENY" env-delim:"," description:"host or CIDR never allowed for fetching"`
+
+	OTLPEndpoint    string  `long:"otlp-endpoint" env:"OTLP_ENDPOINT" description:"OTLP/HTTP collector url for traces, like http://localhost:4318; tracing is disabled if empty"`
+	OTLPSampleRatio float64 `long:"otlp-sample-ratio" env:"OTLP_SAMPLE_RATIO" default:"1" description:"fraction of new traces to sample, 0 to 1"`
+
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" env:"SHUTDOWN_TIMEOUT" default:"30s" description:"max time to wait for in-flight requests on shutdown"`
+
+	Debug bool `long:"dbg" env:"DEBUG" description:"debug mode"`
 }
 
 func main() {
@@ -45,22 +94,83 @@ func main() {
 	log.Setup(options...)
 
 	log.Printf("[INFO] started ukeeper-readability service %s", revision)
-	db, err := datastore.New(opts.MongoURI, opts.MongoDB, opts.MongoDelay)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    opts.OTLPEndpoint,
+		ServiceName: "ukeeper-readability",
+		Version:     revision,
+		SampleRatio: opts.OTLPSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("[ERROR] can't set up tracing %v", err)
+	}
+	defer func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil {
+			log.Printf("[WARN] failed to flush traces, %v", shutdownErr)
+		}
+	}()
+	if opts.OTLPEndpoint != "" {
+		log.Printf("[INFO] tracing enabled, otlp endpoint %s", opts.OTLPEndpoint)
+	}
+
+	if opts.MongoDelay > 0 {
+		log.Print("[WARN] --mongo-delay is deprecated, mongo is pinged with retries up to --mongo-wait")
+	}
+	db, err := datastore.New(opts.MongoURI, opts.MongoDB, max(opts.MongoWait, opts.MongoDelay))
 	if err != nil {
 		log.Fatalf("[ERROR] can't connect to mongo %v", err)
 	}
+	defer func() {
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer closeCancel()
+		if closeErr := db.Close(closeCtx); closeErr != nil {
+			log.Printf("[WARN] %v", closeErr)
+		}
+		log.Print("[INFO] mongo connection closed")
+	}()
 	stores := db.GetStores()
 
+	policy := &extractor.OutboundPolicy{
+		AllowPrivate: opts.OutboundAllowPrivate,
+		AllowHosts:   opts.OutboundAllow,
+		DenyHosts:    opts.OutboundDeny,
+	}
+	if opts.OutboundAllowPrivate {
+		log.Print("[WARN] fetching from private and loopback addresses is allowed")
+	}
+
 	// default retriever is always HTTP; CF is optional and, when configured, acts as a
 	// second retriever available for per-rule routing or global route-all.
-	httpRetriever := &extractor.HTTPRetriever{Timeout: 30 * time.Second}
+	httpRetriever := &extractor.HTTPRetriever{
+		Timeout:      30 * time.Second,
+		UserAgent:    opts.HTTPUserAgent,
+		Headers:      opts.HTTPHeaders,
+		Proxy:        opts.HTTPProxy,
+		CACertFile:   opts.HTTPCACert,
+		MaxRedirects: opts.HTTPMaxRedirects,
+		CookieJar:    opts.HTTPCookieJar,
+		Policy:       policy,
+		MaxBodySize:  int64(opts.MaxPageSize) << 20,
+		AllowedTypes: opts.AllowedTypes,
+	}
+	if err := httpRetriever.Validate(); err != nil {
+		log.Fatalf("[ERROR] invalid http proxy or CA settings, %v", err)
+	}
+	healthChecks := []*rest.HealthCheck{{Name: "mongo", Check: db.Ping}}
 	var cfRetriever extractor.Retriever
 	if opts.CFAccountID != "" && opts.CFAPIToken != "" {
-		cfRetriever = &extractor.CloudflareRetriever{
-			AccountID:  opts.CFAccountID,
-			APIToken:   opts.CFAPIToken,
-			Timeout:    30 * time.Second,
-			MaxRetries: extractor.CFDefaultMaxRetries,
+		cf := &extractor.CloudflareRetriever{
+			AccountID:   opts.CFAccountID,
+			APIToken:    opts.CFAPIToken,
+			Timeout:     30 * time.Second,
+			MaxRetries:  extractor.CFDefaultMaxRetries,
+			MaxBodySize: int64(opts.MaxPageSize) << 20,
+		}
+		cfRetriever = cf
+		if opts.HealthCheckCF {
+			healthChecks = append(healthChecks, &rest.HealthCheck{Name: "cloudflare", Check: cf.VerifyToken, Optional: true,
+				CacheTTL: 10 * time.Minute})
 		}
 		if opts.CFRouteAll {
 			log.Printf("[INFO] Cloudflare Browser Rendering enabled, account=%s, mode=route-all", opts.CFAccountID)
@@ -79,16 +189,56 @@ func main() {
 
 	srv := rest.Server{
 		Readability: extractor.UReadability{
-			TimeOut:     30 * time.Second,
-			SnippetSize: 300,
-			Rules:       stores.Rules,
-			Retriever:   httpRetriever,
-			CFRetriever: cfRetriever,
-			CFRouteAll:  opts.CFRouteAll,
+			TimeOut:        30 * time.Second,
+			SnippetSize:    300,
+			Rules:          stores.Rules,
+			Retriever:      httpRetriever,
+			CFRetriever:    cfRetriever,
+			CFRouteAll:     opts.CFRouteAll,
+			Policy:         policy,
+			MaxImageSize:   int64(opts.MaxImageSize) << 20,
+			MaxPages:       opts.MaxPages,
+			MaxArchiveSize: int64(opts.MaxArchiveSize) << 20,
+			Sanitizer:      &extractor.SanitizePolicy{Level: opts.Sanitize, EmbedHosts: opts.SanitizeEmbeds},
 		},
-		Token:       opts.Token,
-		Credentials: opts.Credentials,
-		Version:     revision,
+		Token:           opts.Token,
+		Credentials:     opts.Credentials,
+		Version:         revision,
+		HealthChecks:    healthChecks,
+		ShutdownTimeout: opts.ShutdownTimeout,
+	}
+	if opts.ImgProxyURL != "" {
+		if opts.ImgProxySecret == "" {
+			log.Fatalf("[ERROR] --img-proxy-secret is required for image proxy")
+		}
+		srv.Readability.ImageProxy = &extractor.ImageProxy{
+			BaseURL:   opts.ImgProxyURL,
+			Secret:    []byte(opts.ImgProxySecret),
+			Policy:    policy,
+			MaxSize:   int64(opts.MaxImageSize) << 20,
+			CacheSize: int64(opts.ImgProxyCache) << 20,
+			Widths:    opts.ImgProxyWidths,
+		}
+		log.Printf("[INFO] image proxy enabled, base url %s", opts.ImgProxyURL)
+	}
+	if opts.APIKeys {
+		srv.Keys = stores.Keys
+		log.Print("[INFO] api keys enabled")
+	}
+	if opts.Users {
+		if err = importCredentials(context.Background(), stores.Users, opts.Credentials); err != nil {
+			log.Fatalf("[ERROR] can't import credentials, %v", err)
+		}
+		srv.Users = stores.Users
+		srv.SessionSecret = []byte(opts.SessionKey)
+		log.Print("[INFO] admin UI users enabled")
+	}
+	if opts.OIDCIssuer != "" {
+		if srv.OIDC, err = oidcConfig(); err != nil {
+			log.Fatalf("[ERROR] invalid oidc configuration, %v", err)
+		}
+		srv.SessionSecret = []byte(opts.SessionKey)
+		log.Printf("[INFO] oidc single sign-on with %s enabled", opts.OIDCIssuer)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -102,3 +252,63 @@ func main() {
 
 	srv.Run(ctx, opts.Address, opts.Port, opts.FrontendDir)
 }
+
+// importCredentials creates admin users from static credentials if there are no users yet,
+// so switching to stored users keeps the existing logins working
+func importCredentials(ctx context.Context, users datastore.UsersDAO, creds map[string]string) error {
+	count, err := users.Count(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		if len(creds) > 0 {
+			log.Print("[WARN] --creds are ignored, users are stored in mongo")
+		}
+		return nil
+	}
+	if len(creds) == 0 {
+		log.Print("[WARN] no users, set --creds to create the first admin")
+		return nil
+	}
+	for name, password := range creds {
+		user := datastore.User{Name: name, Role: datastore.RoleAdmin}
+		if err = user.SetPassword(password); err != nil {
+			return fmt.Errorf("user %s: %w", name, err)
+		}
+		if _, err = users.Save(ctx, user); err != nil {
+			return err
+		}
+		log.Printf("[INFO] admin user %s imported from credentials", name)
+	}
+	return nil
+}
+
+// oidcConfig makes single sign-on configuration from options
+func oidcConfig() (*rest.OIDC, error) {
+	if opts.OIDCClientID == "" || opts.OIDCRedirectURL == "" {
+		return nil, errors.New("oidc-client-id and oidc-redirect-url are required")
+	}
+	res := &rest.OIDC{
+		Issuer:       opts.OIDCIssuer,
+		ClientID:     opts.OIDCClientID,
+		ClientSecret: opts.OIDCClientSecret,
+		RedirectURL:  opts.OIDCRedirectURL,
+		Scopes:       opts.OIDCScopes,
+		GroupsClaim:  opts.OIDCGroupsClaim,
+		GroupRoles:   map[string]datastore.Role{},
+		DefaultRole:  datastore.Role(opts.OIDCDefaultRole),
+	}
+	if res.DefaultRole != "" && !res.DefaultRole.Valid() {
+		return nil, fmt.Errorf("unknown default role %q", res.DefaultRole)
+	}
+	for group, role := range opts.OIDCGroupRoles {
+		if !datastore.Role(role).Valid() {
+			return nil, fmt.Errorf("unknown role %q of group %s", role, group)
+		}
+		res.GroupRoles[group] = datastore.Role(role)
+	}
+	if len(res.GroupRoles) == 0 && res.DefaultRole == "" {
+		log.Print("[WARN] no oidc-group-role and oidc-default-role set, nobody can log in with oidc")
+	}
+	return res, nil
+}
@@ -55,6 +55,11 @@ func Test_Main(t *testing.T) {
 	body, err := io.ReadAll(resp.Body)
 	require.NoError(t, err)
 	assert.Equal(t, "pong", string(body))
+
+	ready, err := http.Get(fmt.Sprintf("http://localhost:%d/health/ready", port))
+	require.NoError(t, err)
+	defer ready.Body.Close()
+	assert.Equal(t, 200, ready.StatusCode)
 }
 
 func chooseRandomUnusedPort() (port int) {
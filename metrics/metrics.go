@@ -0,0 +1,130 @@
+// Package metrics defines prometheus metrics of extraction, retrievers, rules and datastore,
+// and the handler exposing them
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ukeeper"
+
+// rule extraction results, see ObserveRule
+const (
+	RuleHit      = "rule"     // content extracted with custom rule
+	RuleFallback = "fallback" // custom rule failed, general parser used
+	RuleNone     = "general"  // no custom rule, general parser used
+)
+
+// cloudflare request statuses, see ObserveCloudflare
+const (
+	CloudflareOK          = "ok"
+	CloudflareRateLimited = "rate_limited"
+	CloudflareError       = "error"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	extractTotal = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "extract_total",
+		Help:      "Number of article extractions by retriever and outcome.",
+	}, []string{"retriever", "outcome"})
+
+	extractDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "extract_duration_seconds",
+		Help:      "Article extraction latency by retriever and outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"retriever", "outcome"})
+
+	cloudflareRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_requests_total",
+		Help:      "Number of Cloudflare Browser Rendering requests by status: ok, rate_limited (429) or error.",
+	}, []string{"status"})
+
+	cloudflareRetries = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_retries_total",
+		Help:      "Number of Cloudflare Browser Rendering retries after 429.",
+	})
+
+	ruleExtractions = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_extractions_total",
+		Help:      "Number of content extractions by rule id and result: rule, fallback to general parser or general.",
+	}, []string{"rule", "result"})
+
+	imageFetches = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_fetches_total",
+		Help:      "Number of image fetches by result.",
+	}, []string{"result"})
+
+	imageProxyRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_proxy_requests_total",
+		Help:      "Number of image proxy requests by result: cached or result of the image fetch.",
+	}, []string{"result"})
+
+	mongoDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_query_duration_seconds",
+		Help:      "Mongo query latency by operation.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"op"})
+)
+
+func init() {
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Handler returns http handler exposing all metrics in prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveExtract records extraction outcome and latency. Requested domains are not recorded,
+// as they come from clients and would make the number of series unbounded.
+func ObserveExtract(retriever, outcome string, d time.Duration) {
+	extractTotal.WithLabelValues(retriever, outcome).Inc()
+	extractDuration.WithLabelValues(retriever, outcome).Observe(d.Seconds())
+}
+
+// ObserveCloudflare records status of a single Cloudflare request
+func ObserveCloudflare(status string) {
+	cloudflareRequests.WithLabelValues(status).Inc()
+}
+
+// ObserveCloudflareRetry records retry of rate limited Cloudflare request
+func ObserveCloudflareRetry() {
+	cloudflareRetries.Inc()
+}
+
+// ObserveRule records whether content was extracted by custom rule, see RuleHit, RuleFallback and RuleNone.
+// ruleID is id of the stored rule, empty for general parser and rules not saved yet.
+func ObserveRule(ruleID, result string) {
+	ruleExtractions.WithLabelValues(ruleID, result).Inc()
+}
+
+// ObserveImage records image fetch result
+func ObserveImage(result string) {
+	imageFetches.WithLabelValues(result).Inc()
+}
+
+// ObserveImageProxy records result of image proxy request
+func ObserveImageProxy(result string) {
+	imageProxyRequests.WithLabelValues(result).Inc()
+}
+
+// ObserveMongo records latency of mongo operation started at given time
+func ObserveMongo(op string, started time.Time) {
+	mongoDuration.WithLabelValues(op).Observe(time.Since(started).Seconds())
+}
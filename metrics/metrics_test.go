@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserve(t *testing.T) {
+	ObserveExtract("http", "success", 150*time.Millisecond)
+	ObserveExtract("http", "success", 2*time.Second)
+	ObserveCloudflare(CloudflareRateLimited)
+	ObserveCloudflareRetry()
+	ObserveRule("5f1e3a6b9c2d4e0012345678", RuleFallback)
+	ObserveImage("ok")
+	ObserveImageProxy("cached")
+	ObserveMongo("get", time.Now().Add(-10*time.Millisecond))
+
+	assert.InDelta(t, 2, testutil.ToFloat64(extractTotal.WithLabelValues("http", "success")), 0)
+	assert.Equal(t, 1, testutil.CollectAndCount(extractDuration))
+	assert.InDelta(t, 1, testutil.ToFloat64(cloudflareRequests.WithLabelValues(CloudflareRateLimited)), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(cloudflareRetries), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(ruleExtractions.WithLabelValues("5f1e3a6b9c2d4e0012345678", RuleFallback)), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(imageFetches.WithLabelValues("ok")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(imageProxyRequests.WithLabelValues("cached")), 0)
+	assert.Equal(t, 1, testutil.CollectAndCount(mongoDuration))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveExtract("cloudflare", "error", time.Second)
+
+	ts := httptest.NewServer(Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `ukeeper_extract_total{outcome="error",retriever="cloudflare"} 1`)
+	assert.Contains(t, string(body), `ukeeper_extract_duration_seconds_bucket{outcome="error",retriever="cloudflare",le="1"} 1`)
+	assert.Contains(t, string(body), "go_goroutines")
+	assert.Contains(t, string(body), "process_start_time_seconds")
+}
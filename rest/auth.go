@@ -0,0 +1,386 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+//go:generate moq -out mocks/users.go -pkg mocks -skip-ensure -fmt goimports . UserStore
+
+// UserStore defines access to admin UI users
+type UserStore interface {
+	Get(ctx context.Context, name string) (datastore.User, bool)
+	All(ctx context.Context) []datastore.User
+	Save(ctx context.Context, user datastore.User) (datastore.User, error)
+	Delete(ctx context.Context, name string) error
+}
+
+const (
+	sessionCookie = "session"
+	csrfCookie    = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+	sessionTTL    = 24 * time.Hour
+)
+
+var reUserName = regexp.MustCompile(`^[\w.@-]{1,64}$`)
+
+type ctxUserKey struct{}
+
+// currentUser returns user of the session, set by authorize
+func currentUser(ctx context.Context) (datastore.User, bool) {
+	user, ok := ctx.Value(ctxUserKey{}).(datastore.User)
+	return user, ok
+}
+
+// authorize returns middleware allowing access only to logged-in users with the role or a more privileged one,
+// and checking CSRF token of unsafe requests. Without user store and single sign-on it falls back to basic auth
+// with static credentials, which grants everything.
+func (s *Server) authorize(role datastore.Role) func(http.Handler) http.Handler {
+	if !s.loginEnabled() {
+		return basicAuth("ureadability", s.Credentials)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, session, ok := s.sessionUser(r)
+			if !ok {
+				loginRequired(w, r)
+				return
+			}
+			if !user.Role.Allows(role) {
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && !validCSRF(r, s.csrfToken(session)) {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxUserKey{}, user)))
+		})
+	}
+}
+
+// loginEnabled checks admin UI uses login sessions, with stored users or single sign-on
+func (s *Server) loginEnabled() bool {
+	return s.Users != nil || s.OIDC != nil
+}
+
+// loginRequired redirects page requests to the login page and rejects others
+func loginRequired(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// handleLogin renders login page
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s.renderLogin(w, http.StatusOK, r.URL.Query().Get("next"), "")
+}
+
+// login checks user's password and starts session
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	name, next := strings.TrimSpace(r.FormValue("name")), r.FormValue("next")
+	user, found := s.Users.Get(r.Context(), name)
+	if !found || !user.CheckPassword(r.FormValue("password")) {
+		log.Printf("[WARN] failed login of %q from %s", name, r.RemoteAddr)
+		s.renderLogin(w, http.StatusUnauthorized, next, "Неверное имя пользователя или пароль")
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	s.startSession(w, r, s.sessionValue(user, expires.Unix()), expires)
+	log.Printf("[INFO] user %s (%s) logged in", user.Name, user.Role)
+	http.Redirect(w, r, localRedirect(next), http.StatusSeeOther)
+}
+
+// startSession sets session and CSRF cookies
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, session string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/", Expires: expires,
+		HttpOnly: true, Secure: isSecure(r), SameSite: http.SameSiteLaxMode})
+	// csrf cookie is readable by page scripts, which send it back in the header of htmx requests
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: s.csrfToken(session), Path: "/", Expires: expires,
+		Secure: isSecure(r), SameSite: http.SameSiteStrictMode})
+}
+
+// isSecure checks request came over https, directly or through proxy
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// localRedirect returns next if it's a local path, or the root page otherwise
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// logout ends session
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1})
+	}
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, status int, next, errMsg string) {
+	data := struct {
+		Title    string
+		Next     string
+		Error    string
+		Password bool // login with stored user's password
+		SSO      bool // login with identity provider
+	}{
+		Title:    "Вход",
+		Next:     next,
+		Error:    errMsg,
+		Password: s.Users != nil,
+		SSO:      s.OIDC != nil,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.loginPage.ExecuteTemplate(w, "base.gohtml", data); err != nil {
+		log.Printf("[WARN] failed to render login template, %v", err)
+	}
+}
+
+// sessionValue makes signed session cookie value, name.expires.signature. The signature covers the password hash,
+// so changing the password ends all user's sessions.
+func (s *Server) sessionValue(user datastore.User, expires int64) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user.Name)) + "." + strconv.FormatInt(expires, 10)
+	return payload + "." + s.sign(payload, user.PasswordHash)
+}
+
+// ssoSessionValue makes signed session cookie value for user authenticated by identity provider,
+// name.role.expires.signature. The role is kept in the session, as such users aren't stored.
+func (s *Server) ssoSessionValue(name string, role datastore.Role, expires int64) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(name)) + "." + string(role) + "." + strconv.FormatInt(expires, 10)
+	return payload + "." + s.sign(payload, "sso")
+}
+
+// sessionUser returns user of valid unexpired session and the session cookie value
+func (s *Server) sessionUser(r *http.Request) (user datastore.User, session string, ok bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return datastore.User{}, "", false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) == 4 && s.OIDC != nil {
+		return s.ssoSessionUser(parts, cookie.Value)
+	}
+	if len(parts) != 3 || s.Users == nil {
+		return datastore.User{}, "", false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return datastore.User{}, "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return datastore.User{}, "", false
+	}
+	user, found := s.Users.Get(r.Context(), string(name))
+	if !found {
+		return datastore.User{}, "", false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(parts[0]+"."+parts[1], user.PasswordHash))) {
+		return datastore.User{}, "", false
+	}
+	return user, cookie.Value, true
+}
+
+// ssoSessionUser returns user of valid unexpired single sign-on session
+func (s *Server) ssoSessionUser(parts []string, session string) (user datastore.User, _ string, ok bool) {
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(s.sign(payload, "sso"))) {
+		return datastore.User{}, "", false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return datastore.User{}, "", false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return datastore.User{}, "", false
+	}
+	return datastore.User{Name: string(name), Role: datastore.Role(parts[1])}, session, true
+}
+
+// csrfToken derives CSRF token from the session
+func (s *Server) csrfToken(session string) string {
+	return s.sign("csrf", session)
+}
+
+// validCSRF checks CSRF token passed in the header or form field
+func validCSRF(r *http.Request, expected string) bool {
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfCookie)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// sign returns hex HMAC of the values with the session secret
+func (s *Server) sign(values ...string) string {
+	s.secretOnce.Do(func() {
+		if len(s.SessionSecret) > 0 {
+			return
+		}
+		// random secret invalidates sessions on restart and doesn't work with multiple instances
+		s.SessionSecret = make([]byte, 32)
+		if _, err := rand.Read(s.SessionSecret); err != nil {
+			log.Printf("[ERROR] can't generate session secret, %v", err)
+		}
+	})
+	mac := hmac.New(sha256.New, s.SessionSecret)
+	for _, v := range values {
+		mac.Write([]byte(v))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// userRow is user with data needed to render users page row
+type userRow struct {
+	datastore.User
+	Roles   []datastore.Role
+	Current bool // row of the logged-in user, who can't change own role or delete self
+}
+
+// handleUsers renders users page
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	current, _ := currentUser(r.Context())
+	users := s.Users.All(r.Context())
+	rows := make([]userRow, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, userRow{User: u, Roles: datastore.Roles, Current: u.Name == current.Name})
+	}
+	data := struct {
+		Title string
+		Users []userRow
+		Roles []datastore.Role
+	}{
+		Title: "Пользователи",
+		Users: rows,
+		Roles: datastore.Roles,
+	}
+	if err := s.usersPage.ExecuteTemplate(w, "base.gohtml", data); err != nil {
+		log.Printf("[WARN] failed to render users template, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// saveUser creates user or updates password and role of the existing one
+func (s *Server) saveUser(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	name, password := strings.TrimSpace(r.FormValue("name")), r.FormValue("password")
+	role := datastore.Role(r.FormValue("role"))
+	if !reUserName.MatchString(name) {
+		http.Error(w, "Invalid user name", http.StatusBadRequest)
+		return
+	}
+	if !role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	if current, _ := currentUser(r.Context()); current.Name == name && role != current.Role {
+		http.Error(w, "Can't change own role", http.StatusBadRequest)
+		return
+	}
+
+	user, found := s.Users.Get(r.Context(), name)
+	if !found && password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+	user.Name, user.Role = name, role
+	if password != "" {
+		if err := user.SetPassword(password); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := s.Users.Save(r.Context(), user); err != nil {
+		log.Printf("[ERROR] failed to save user %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] user %s saved, role %s", name, role)
+	w.Header().Set("HX-Refresh", "true")
+	w.WriteHeader(http.StatusOK)
+}
+
+// setUserRole changes role of the user
+func (s *Server) setUserRole(w http.ResponseWriter, r *http.Request) {
+	name, role := r.PathValue("name"), datastore.Role(r.FormValue("role"))
+	if !role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	if current, _ := currentUser(r.Context()); current.Name == name {
+		http.Error(w, "Can't change own role", http.StatusBadRequest)
+		return
+	}
+	user, found := s.Users.Get(r.Context(), name)
+	if !found {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	user.Role = role
+	saved, err := s.Users.Save(r.Context(), user)
+	if err != nil {
+		log.Printf("[ERROR] failed to save user %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] user %s role changed to %s", name, role)
+	if err = s.usersPage.ExecuteTemplate(w, "user-row", userRow{User: saved, Roles: datastore.Roles}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// deleteUser removes the user, responding with empty body to remove the row
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if current, _ := currentUser(r.Context()); current.Name == name {
+		http.Error(w, "Can't delete self", http.StatusBadRequest)
+		return
+	}
+	if err := s.Users.Delete(r.Context(), name); err != nil {
+		log.Printf("[WARN] failed to delete user %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("[INFO] user %s deleted", name)
+	w.WriteHeader(http.StatusOK)
+}
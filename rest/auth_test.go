@@ -0,0 +1,394 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/extractor"
+	"github.com/ukeeper/ukeeper-readability/rest/mocks"
+)
+
+func TestServer_Login(t *testing.T) {
+	ts, _, _ := startupUsersT(t)
+	defer ts.Close()
+
+	client := newSessionClient(t)
+	resp, err := client.Get(ts.URL + "/edit/123")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "/login", resp.Request.URL.Path, "redirected to login page")
+	assert.Equal(t, "/edit/123", resp.Request.URL.Query().Get("next"))
+
+	// wrong password
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"name": {"viewer"}, "password": {"wrong"}, "next": {"/"}})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, string(body), "Неверное имя пользователя или пароль")
+
+	// unknown user
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"name": {"nobody"}, "password": {"viewer-pass"}})
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// login redirects to the requested page
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"name": {"viewer"}, "password": {"viewer-pass"}, "next": {"/add/"}})
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/add/", resp.Request.URL.Path)
+	assert.Contains(t, string(body), "Добавление правила")
+
+	// no open redirects
+	for _, next := range []string{"https://example.com/", "//example.com/", "/\\example.com"} {
+		req, reqErr := http.NewRequest(http.MethodPost, ts.URL+"/login",
+			strings.NewReader(url.Values{"name": {"viewer"}, "password": {"viewer-pass"}, "next": {next}}.Encode()))
+		require.NoError(t, reqErr)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err = http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "/", resp.Header.Get("Location"), next)
+	}
+
+	// logout ends session
+	resp, err = sessionPost(t, client, ts.URL+"/logout", "")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "/login", resp.Request.URL.Path)
+	resp, err = client.Get(ts.URL + "/")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "/login", resp.Request.URL.Path)
+}
+
+func TestServer_RolePermissions(t *testing.T) {
+	ts, _, _ := startupUsersT(t)
+	defer ts.Close()
+
+	tbl := []struct {
+		user                           string
+		preview, saveRule, usersPage   int
+		toggleRule, createKey, keyPage int
+	}{
+		{"viewer", http.StatusOK, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden,
+			http.StatusForbidden},
+		{"editor", http.StatusOK, http.StatusOK, http.StatusForbidden, http.StatusNotFound, http.StatusForbidden,
+			http.StatusForbidden},
+		{"admin", http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusOK, http.StatusOK},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.user, func(t *testing.T) {
+			client := login(t, ts, tt.user, tt.user+"-pass")
+			status := func(resp *http.Response, err error) int {
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+				return resp.StatusCode
+			}
+			assert.Equal(t, http.StatusOK, status(client.Get(ts.URL+"/")))
+			assert.Equal(t, tt.preview, status(sessionPost(t, client, ts.URL+"/api/preview", "test_urls=")))
+			assert.Equal(t, tt.saveRule, status(sessionPost(t, client, ts.URL+"/api/rule",
+				"domain="+tt.user+".example.com&content=article")))
+			assert.Equal(t, tt.toggleRule, status(sessionPost(t, client, ts.URL+"/api/toggle-rule/000000000000000000000000", "")))
+			assert.Equal(t, tt.usersPage, status(client.Get(ts.URL+"/users")))
+			assert.Equal(t, tt.keyPage, status(client.Get(ts.URL+"/keys")))
+			assert.Equal(t, tt.createKey, status(sessionPost(t, client, ts.URL+"/api/keys", "name="+tt.user)))
+		})
+	}
+}
+
+func TestServer_SaveRuleSetsUser(t *testing.T) {
+	ts, srv, _ := startupUsersT(t)
+	defer ts.Close()
+
+	client := login(t, ts, "editor", "editor-pass")
+	resp, err := sessionPost(t, client, ts.URL+"/api/rule", "domain=example.com&content=article")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	rule, found := srv.Readability.Rules.Get(context.Background(), "https://example.com/page")
+	require.True(t, found)
+	assert.Equal(t, "editor", rule.User)
+}
+
+func TestServer_CSRF(t *testing.T) {
+	ts, _, _ := startupUsersT(t)
+	defer ts.Close()
+	client := login(t, ts, "editor", "editor-pass")
+
+	post := func(token string, form url.Values) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/rule", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set(csrfHeader, token)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	form := url.Values{"domain": {"csrf.example.com"}, "content": {"article"}}
+	assert.Equal(t, http.StatusForbidden, post("", form), "no token")
+	assert.Equal(t, http.StatusForbidden, post("bad", form), "wrong token")
+	assert.Equal(t, http.StatusOK, post(csrfFromJar(t, client, ts.URL), form), "token in header")
+	form.Set(csrfCookie, csrfFromJar(t, client, ts.URL))
+	assert.Equal(t, http.StatusOK, post("", form), "token in form")
+}
+
+func TestServer_SessionInvalidation(t *testing.T) {
+	ts, srv, users := startupUsersT(t)
+	defer ts.Close()
+	client := login(t, ts, "viewer", "viewer-pass")
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	session := ""
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == sessionCookie {
+			session = c.Value
+		}
+	}
+	require.NotEmpty(t, session)
+
+	check := func(value string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+		user, _, ok := srv.sessionUser(req)
+		if !ok {
+			return ""
+		}
+		return user.Name
+	}
+	assert.Equal(t, "viewer", check(session))
+
+	parts := strings.Split(session, ".")
+	assert.Empty(t, check(parts[0]+"."+parts[1]+".00"), "bad signature")
+	assert.Empty(t, check("YWRtaW4."+parts[1]+"."+parts[2]), "other user name")
+	assert.Empty(t, check(parts[0]+".99999999999."+parts[2]), "changed expiration")
+	assert.Empty(t, check("garbage"))
+
+	viewer, found := users.Get(context.Background(), "viewer")
+	require.True(t, found)
+	assert.Empty(t, check(srv.sessionValue(viewer, time.Now().Add(-time.Minute).Unix())), "expired")
+
+	require.NoError(t, viewer.SetPassword("new-pass"))
+	_, err = users.Save(context.Background(), viewer)
+	require.NoError(t, err)
+	assert.Empty(t, check(session), "password change ends session")
+}
+
+func TestServer_ManageUsers(t *testing.T) {
+	ts, _, users := startupUsersT(t)
+	defer ts.Close()
+	client := login(t, ts, "admin", "admin-pass")
+
+	call := func(path, body string) (int, string, http.Header) {
+		resp, err := sessionPost(t, client, ts.URL+path, body)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(b), resp.Header
+	}
+
+	// create user
+	code, _, header := call("/api/users", "name=new.user&password=secret&role=editor")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "true", header.Get("HX-Refresh"))
+	user, found := users.Get(context.Background(), "new.user")
+	require.True(t, found)
+	assert.Equal(t, datastore.RoleEditor, user.Role)
+	assert.True(t, user.CheckPassword("secret"))
+	assert.NotContains(t, user.PasswordHash, "secret")
+
+	page, err := client.Get(ts.URL + "/users")
+	require.NoError(t, err)
+	b, err := io.ReadAll(page.Body)
+	require.NoError(t, err)
+	require.NoError(t, page.Body.Close())
+	assert.Contains(t, string(b), "new.user")
+	assert.Contains(t, string(b), `hx-post="/api/delete-user/new.user"`)
+	assert.NotContains(t, string(b), `hx-post="/api/delete-user/admin"`, "can't delete self")
+
+	// update without password keeps it
+	code, _, _ = call("/api/users", "name=new.user&role=viewer")
+	require.Equal(t, http.StatusOK, code)
+	user, _ = users.Get(context.Background(), "new.user")
+	assert.Equal(t, datastore.RoleViewer, user.Role)
+	assert.True(t, user.CheckPassword("secret"))
+
+	// change role
+	code, body, _ := call("/api/user-role/new.user", "role=admin")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<option value="admin" selected>`)
+	user, _ = users.Get(context.Background(), "new.user")
+	assert.Equal(t, datastore.RoleAdmin, user.Role)
+
+	// bad requests
+	for _, tt := range []struct{ path, body string }{
+		{"/api/users", "name=no+spaces&password=x&role=viewer"},
+		{"/api/users", "name=another&password=x&role=root"},
+		{"/api/users", "name=another&role=viewer"},
+		{"/api/users", "name=admin&role=viewer"},
+		{"/api/user-role/admin", "role=viewer"},
+		{"/api/user-role/new.user", "role=root"},
+		{"/api/delete-user/admin", ""},
+	} {
+		code, _, _ = call(tt.path, tt.body)
+		assert.Equal(t, http.StatusBadRequest, code, tt)
+	}
+	code, _, _ = call("/api/user-role/nobody", "role=viewer")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// delete user
+	code, body, _ = call("/api/delete-user/new.user", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body)
+	_, found = users.Get(context.Background(), "new.user")
+	assert.False(t, found)
+	code, _, _ = call("/api/delete-user/new.user", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestServer_LegacyAuth(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	_, code := get(t, ts.URL+"/")
+	assert.Equal(t, http.StatusOK, code, "rules pages are public without users")
+	_, code = get(t, ts.URL+"/login")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	resp, err := http.Post(ts.URL+"/api/rule", "application/x-www-form-urlencoded", strings.NewReader("domain=example.com"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Basic")
+}
+
+// startupUsersT runs testing server with users store, containing admin, editor and viewer with "<name>-pass" passwords
+func startupUsersT(t *testing.T) (*httptest.Server, *Server, *mocks.UserStoreMock) {
+	t.Helper()
+	users := newUserStoreMock()
+	for _, role := range datastore.Roles {
+		user := datastore.User{Name: string(role), Role: role}
+		require.NoError(t, user.SetPassword(string(role)+"-pass"))
+		_, err := users.Save(context.Background(), user)
+		require.NoError(t, err)
+	}
+
+	srv := Server{
+		Readability: extractor.UReadability{TimeOut: 30 * time.Second, SnippetSize: 300, Rules: newRulesStoreMock()},
+		Keys:        newKeyStoreMock(),
+		Users:       users,
+		Version:     "dev-test",
+	}
+	webDir := "../web"
+	templates := template.Must(template.ParseGlob(filepath.Join(webDir, "components", "*.gohtml")))
+	srv.indexPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "index.gohtml")))
+	srv.rulePage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "rule.gohtml")))
+	srv.keysPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "keys.gohtml")))
+	srv.loginPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "login.gohtml")))
+	srv.usersPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "users.gohtml")))
+	return httptest.NewServer(srv.routes(webDir)), &srv, users
+}
+
+func newSessionClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	return &http.Client{Jar: jar, Timeout: 5 * time.Second}
+}
+
+// login returns client with session of the user
+func login(t *testing.T, ts *httptest.Server, name, password string) *http.Client {
+	t.Helper()
+	client := newSessionClient(t)
+	resp, err := client.PostForm(ts.URL+"/login", url.Values{"name": {name}, "password": {password}})
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, csrfFromJar(t, client, ts.URL))
+	return client
+}
+
+func csrfFromJar(t *testing.T, client *http.Client, base string) string {
+	u, err := url.Parse(base)
+	require.NoError(t, err)
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == csrfCookie {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// sessionPost makes form post with session's CSRF token, as htmx does
+func sessionPost(t *testing.T, client *http.Client, u, body string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrfHeader, csrfFromJar(t, client, u))
+	return client.Do(req)
+}
+
+// newUserStoreMock creates a moq-generated UserStoreMock with in-memory behavior
+func newUserStoreMock() *mocks.UserStoreMock {
+	var mu sync.Mutex
+	users := map[string]datastore.User{}
+
+	return &mocks.UserStoreMock{
+		GetFunc: func(_ context.Context, name string) (datastore.User, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			u, ok := users[name]
+			return u, ok
+		},
+		AllFunc: func(context.Context) []datastore.User {
+			mu.Lock()
+			defer mu.Unlock()
+			res := make([]datastore.User, 0, len(users))
+			for _, u := range users {
+				res = append(res, u)
+			}
+			return res
+		},
+		SaveFunc: func(_ context.Context, user datastore.User) (datastore.User, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if user.CreatedAt.IsZero() {
+				user.CreatedAt = time.Now()
+			}
+			users[user.Name] = user
+			return user, nil
+		},
+		DeleteFunc: func(_ context.Context, name string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := users[name]; !ok {
+				return errors.New("user not found")
+			}
+			delete(users, name)
+			return nil
+		},
+	}
+}
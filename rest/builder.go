@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/go-pkgz/lgr"
+	"golang.org/x/net/html"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+// builderStripped are elements removed from the page shown in the rule builder, as they run code,
+// load other documents or navigate away
+const builderStripped = "script, noscript, iframe, frame, frameset, object, embed, applet, base, meta[http-equiv], " +
+	"link[rel=preload], link[rel=prefetch], link[rel=modulepreload]"
+
+// handleBuilder shows the rule builder, with the page of url parameter or the first test url of the rule
+func (s *Server) handleBuilder(w http.ResponseWriter, r *http.Request) {
+	var rule datastore.Rule
+	if id := r.URL.Query().Get("id"); id != "" {
+		found, ok := s.Readability.Rules.GetByID(r.Context(), getBid(id))
+		if !ok {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		rule = found
+	}
+	pageURL := strings.TrimSpace(r.URL.Query().Get("url"))
+	if pageURL == "" {
+		for _, u := range rule.TestURLs {
+			if pageURL = strings.TrimSpace(u); pageURL != "" {
+				break
+			}
+		}
+	}
+	if pageURL != "" && !strings.Contains(pageURL, "://") {
+		pageURL = "https://" + pageURL
+	}
+
+	data := struct {
+		Title    string
+		URL      string
+		Rule     datastore.Rule
+		Excludes []string
+	}{
+		Title: "Конструктор правила",
+		URL:   pageURL,
+		Rule:  rule,
+	}
+	for _, e := range rule.Excludes {
+		if e = strings.TrimSpace(e); e != "" {
+			data.Excludes = append(data.Excludes, e)
+		}
+	}
+	if err := s.builderPage.ExecuteTemplate(w, "base.gohtml", data); err != nil {
+		log.Printf("[WARN] failed to render builder template, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// builderFrame fetches the page for the rule builder through the configured retriever and returns its sandboxed copy.
+// Scripts and frames of the page are removed, and the builder script highlighting and picking blocks is added.
+// The copy is served with CSP sandbox, so it runs in an opaque origin and can't reach the admin UI.
+func (s *Server) builderFrame(w http.ResponseWriter, r *http.Request) {
+	pageURL := r.URL.Query().Get("url")
+	var rule *datastore.Rule
+	if id := r.URL.Query().Get("id"); id != "" {
+		if found, ok := s.Readability.Rules.GetByID(r.Context(), getBid(id)); ok {
+			rule = &found
+		}
+	}
+	finalURL, body, err := s.Readability.FetchPage(r.Context(), pageURL, rule)
+	if err != nil {
+		log.Printf("[WARN] failed to fetch %s for rule builder, %v", pageURL, err)
+		http.Error(w, "Failed to fetch page: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		http.Error(w, "Failed to parse page: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	doc.Find(builderStripped).Remove()
+	doc.Find("*").Each(func(_ int, sel *goquery.Selection) {
+		for _, node := range sel.Nodes {
+			node.Attr = slices.DeleteFunc(node.Attr, func(a html.Attribute) bool {
+				return strings.HasPrefix(strings.ToLower(a.Key), "on") ||
+					strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:")
+			})
+		}
+	})
+	doc.Find("head").PrependHtml("<base>").Find("base").SetAttr("href", finalURL) // relative links and images resolve to the site
+
+	nonce := randomString()
+	var script bytes.Buffer
+	if err = s.builderPage.ExecuteTemplate(&script, "builder-frame", struct{ Nonce string }{nonce}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	doc.Find("body").AppendHtml(script.String())
+
+	res, err := doc.Html()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "sandbox allow-scripts; script-src 'nonce-"+nonce+"'; "+
+		"form-action 'none'; frame-ancestors 'self'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	_, _ = w.Write([]byte(res))
+}
+
+// builderValues fills rule form with selectors made in the rule builder, passed as query parameters
+func builderValues(r *http.Request, rule *datastore.Rule) {
+	q := r.URL.Query()
+	if q.Has("content") {
+		rule.Content = q.Get("content")
+	}
+	if q.Has("excludes") {
+		rule.Excludes = nil
+		for _, e := range strings.Split(q.Get("excludes"), "\n") {
+			if e = strings.TrimSpace(e); e != "" {
+				rule.Excludes = append(rule.Excludes, e)
+			}
+		}
+	}
+	testURL := strings.TrimSpace(q.Get("test_url"))
+	if testURL == "" {
+		return
+	}
+	if !slices.Contains(rule.TestURLs, testURL) {
+		rule.TestURLs = append(slices.DeleteFunc(rule.TestURLs, func(u string) bool { return strings.TrimSpace(u) == "" }), testURL)
+	}
+	if u, err := url.Parse(testURL); err == nil && rule.Domain == "" {
+		rule.Domain = u.Host
+	}
+}
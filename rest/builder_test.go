@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+func TestServer_Builder(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "builder-agent", r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Page</title><script>alert(1)</script>
+			<meta http-equiv="refresh" content="0;url=https://example.com"><link rel="stylesheet" href="/main.css"></head>
+			<body onload="steal()"><div id="main"><article class="post"><p>text</p><a href="javascript:alert(1)">x</a>
+			<a href="/other" onclick="go()">other</a></article><iframe src="https://example.com/ad"></iframe>
+			<aside class="share">share</aside></div></body></html>`))
+	}))
+	defer site.Close()
+
+	ts, srv := startupT(t)
+	defer ts.Close()
+	host := strings.TrimPrefix(site.URL, "http://")
+	rule, err := srv.Readability.Rules.Save(t.Context(), datastore.Rule{Domain: host, Content: "article", UserAgent: "builder-agent",
+		Excludes: []string{" .share", ""}, TestURLs: []string{"", site.URL + "/article"}, Enabled: true})
+	require.NoError(t, err)
+
+	getAuth := func(u string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, u, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	t.Run("page with rule", func(t *testing.T) {
+		resp, body := getAuth(ts.URL + "/builder?id=" + rule.ID.Hex())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, "Конструктор правила")
+		assert.Contains(t, body, `value="`+site.URL+`/article"`, "first test url is loaded")
+		assert.Contains(t, body, `src="/api/builder/page?url=`+strings.ToLower(url.QueryEscape(site.URL+"/article"))+`&id=`+rule.ID.Hex())
+		assert.Contains(t, body, `<textarea name="excludes" class="form__input form__input_big builder__excludes">.share</textarea>`)
+		assert.Contains(t, body, `name="user_agent" value="builder-agent"`)
+		assert.Contains(t, body, `data-base="/edit/`+rule.ID.Hex()+`"`)
+	})
+
+	t.Run("page without url", func(t *testing.T) {
+		resp, body := getAuth(ts.URL + "/builder")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotContains(t, body, "builder__frame")
+	})
+
+	t.Run("page of unknown rule", func(t *testing.T) {
+		resp, _ := getAuth(ts.URL + "/builder?id=" + strings.Repeat("0", 23) + "1")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("requires auth", func(t *testing.T) {
+		_, code := get(t, ts.URL+"/builder")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		_, code = get(t, ts.URL+"/api/builder/page?url="+url.QueryEscape(site.URL))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("sandboxed frame", func(t *testing.T) {
+		resp, body := getAuth(ts.URL + "/api/builder/page?id=" + rule.ID.Hex() + "&url=" + url.QueryEscape(site.URL+"/article"))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		csp := resp.Header.Get("Content-Security-Policy")
+		assert.True(t, strings.HasPrefix(csp, "sandbox allow-scripts; script-src 'nonce-"), csp)
+		_, nonce, _ := strings.Cut(csp, "'nonce-")
+		nonce, _, _ = strings.Cut(nonce, "'")
+		require.NotEmpty(t, nonce)
+
+		assert.Contains(t, body, `<base href="`+site.URL+`/article"/>`)
+		assert.Contains(t, body, `<link rel="stylesheet" href="/main.css"/>`, "styles are kept")
+		assert.Contains(t, body, `<article class="post">`)
+		assert.Contains(t, body, `<a href="/other">other</a>`)
+		assert.Equal(t, 1, strings.Count(body, "<script"), "only the builder script is left")
+		assert.Contains(t, body, `<script nonce="`+nonce+`">`)
+		for _, s := range []string{"alert(1)", "steal()", "go()", "<iframe", "http-equiv"} {
+			assert.NotContains(t, body, s)
+		}
+	})
+
+	t.Run("frame fetch failure", func(t *testing.T) {
+		resp, body := getAuth(ts.URL + "/api/builder/page?url=" + url.QueryEscape("http://127.0.0.1:1/article"))
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.Contains(t, body, "Failed to fetch page")
+	})
+
+	t.Run("preview with excludes", func(t *testing.T) {
+		resp, err := postFormUrlencoded(t, ts.URL+"/api/preview", url.Values{"test_urls": {site.URL + "/article"},
+			"content": {"#main"}, "excludes": {".share\n  iframe"}, "user_agent": {"builder-agent"}}.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "text")
+		assert.NotContains(t, string(body), "share")
+	})
+}
+
+func TestServer_RuleFormFromBuilder(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	q := url.Values{"content": {"#main, article"}, "excludes": {".share\n\n .ads "}, "test_url": {"https://example.com/post"}}
+	body, code := get(t, ts.URL+"/add/?"+q.Encode())
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `name="domain" class="form__input rule__domain" value="example.com"`)
+	assert.Contains(t, body, `required>#main, article</textarea>`)
+	assert.Contains(t, body, ".share\n")
+	assert.Contains(t, body, ".ads\n")
+	assert.Contains(t, body, "https://example.com/post</textarea>")
+	assert.Contains(t, body, `href="/builder"`)
+
+	resp, err := postFormUrlencoded(t, ts.URL+"/api/rule", "domain=example.com&content=article&test_urls=https://example.com/old")
+	require.NoError(t, err)
+	var rule datastore.Rule
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rule))
+	require.NoError(t, resp.Body.Close())
+
+	body, code = get(t, ts.URL+"/edit/"+rule.ID.Hex()+"?"+q.Encode())
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `value="example.com"`)
+	assert.Contains(t, body, `required>#main, article</textarea>`)
+	assert.Contains(t, body, "https://example.com/old\nhttps://example.com/post</textarea>")
+	assert.Contains(t, body, `href="/builder?id=`+rule.ID.Hex()+`"`)
+}
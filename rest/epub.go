@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/go-pkgz/rest"
+
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+// maxEPUBURLs limits number of articles in EPUB book
+const maxEPUBURLs = 50
+
+// epubRequest is a request to make EPUB book of articles
+type epubRequest struct {
+	Title string   `json:"title"`
+	URLs  []string `json:"urls"`
+}
+
+// makeEPUB extracts articles of the request and returns them as EPUB book. Numbers of included and skipped
+// articles are reported in X-Articles and X-Skipped headers.
+func (s *Server) makeEPUB(w http.ResponseWriter, r *http.Request) {
+	req := epubRequest{}
+	if err := rest.DecodeJSON(r, &req); err != nil {
+		rest.SendErrorJSON(w, r, log.Default(), http.StatusBadRequest, err, "can't parse request")
+		return
+	}
+	var urls []string
+	for _, u := range req.URLs {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		rest.SendErrorJSON(w, r, log.Default(), http.StatusBadRequest, nil, "urls parameter is required")
+		return
+	}
+	if len(urls) > maxEPUBURLs {
+		rest.SendErrorJSON(w, r, log.Default(), http.StatusBadRequest, nil, fmt.Sprintf("too many urls, max %d", maxEPUBURLs))
+		return
+	}
+
+	ctx, cancel := s.batchContext(r) // articles not extracted in time are skipped
+	defer cancel()
+	book, err := s.Readability.EPUB(ctx, req.Title, urls)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, extractor.ErrNoArticles) {
+			code = http.StatusBadRequest
+		}
+		rest.SendErrorJSON(w, r, log.Default(), code, err, "can't make epub")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": book.Title + ".epub"}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(book.Data)))
+	w.Header().Set("X-Articles", strconv.Itoa(len(book.Articles)))
+	w.Header().Set("X-Skipped", strconv.Itoa(len(book.Skipped)))
+	if _, err = w.Write(book.Data); err != nil {
+		log.Printf("[WARN] failed to send epub, %v", err)
+	}
+}
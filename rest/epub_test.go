@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_EPUB(t *testing.T) {
+	ts, srv := startupT(t)
+	defer ts.Close()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>Статья</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, ", 10) + `</p></div></body></html>`))
+	}))
+	defer site.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	post := func(body string) *http.Response {
+		resp, err := client.Post(ts.URL+"/api/epub", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := post(`{"urls": ["` + site.URL + `/1", " ", "http://bad host/"]}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/epub+zip", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "attachment; filename*=utf-8''%D0%A1%D1%82%D0%B0%D1%82%D1%8C%D1%8F.epub", resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "1", resp.Header.Get("X-Articles"))
+	assert.Equal(t, "1", resp.Header.Get("X-Skipped"))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "mimetype", zr.File[0].Name)
+
+	tbl := []struct {
+		name, body string
+		code       int
+	}{
+		{name: "no urls", body: `{"urls": []}`, code: http.StatusBadRequest},
+		{name: "bad json", body: `{"urls": `, code: http.StatusBadRequest},
+		{name: "too many", body: `{"urls": ["` + strings.Repeat(site.URL+`", "`, maxEPUBURLs) + site.URL + `"]}`,
+			code: http.StatusBadRequest},
+		{name: "nothing extracted", body: `{"urls": ["http://bad host/"]}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(tt.body)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+
+	t.Run("slow articles skipped after batch timeout", func(t *testing.T) {
+		srv.BatchTimeout = 500 * time.Millisecond
+		defer func() { srv.BatchTimeout = 0 }()
+		st := time.Now()
+		resp := post(`{"urls": ["` + site.URL + `/1", "` + site.URL + `/slow"]}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Less(t, time.Since(st), 5*time.Second)
+		assert.Equal(t, "1", resp.Header.Get("X-Articles"))
+		assert.Equal(t, "1", resp.Header.Get("X-Skipped"))
+	})
+}
@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/rest"
+)
+
+// healthCheckTimeout limits a single dependency check
+const healthCheckTimeout = 5 * time.Second
+
+// HealthCheck is a dependency check reported by /health/ready
+type HealthCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error
+	Optional bool          // failed optional check is reported, but doesn't make the service not ready
+	CacheTTL time.Duration // reuse the last result for this long, for checks calling rate limited APIs
+
+	mu      sync.Mutex
+	checked time.Time
+	lastErr error
+}
+
+// HealthStatus is a result of a single check in the readiness report
+type HealthStatus struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"` // ok or fail
+	Error      string  `json:"error,omitempty"`
+	Optional   bool    `json:"optional,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	Cached     bool    `json:"cached,omitempty"`
+}
+
+// HealthReport is the readiness report
+type HealthReport struct {
+	Status  string         `json:"status"` // ok if all required checks passed, fail otherwise
+	Version string         `json:"version"`
+	Checks  []HealthStatus `json:"checks"`
+}
+
+// run makes the check, or returns the cached result if it is still fresh
+func (c *HealthCheck) run(ctx context.Context) HealthStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := HealthStatus{Name: c.Name, Status: "ok", Optional: c.Optional}
+	if c.CacheTTL > 0 && !c.checked.IsZero() && time.Since(c.checked) < c.CacheTTL {
+		res.Cached = true
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		started := time.Now()
+		c.lastErr = c.Check(ctx)
+		c.checked = time.Now()
+		res.DurationMS = float64(time.Since(started).Microseconds()) / 1000
+	}
+	if c.lastErr != nil {
+		res.Status, res.Error = "fail", c.lastErr.Error()
+	}
+	return res
+}
+
+// healthLive reports the process is up and serving requests
+func (s *Server) healthLive(w http.ResponseWriter, _ *http.Request) {
+	rest.RenderJSON(w, JSON{"status": "ok", "version": s.Version})
+}
+
+// healthReady runs all dependency checks in parallel and reports them, responds with 503 if any required check failed
+func (s *Server) healthReady(w http.ResponseWriter, r *http.Request) {
+	checks := append([]*HealthCheck{{Name: "templates", Check: s.checkTemplates}}, s.HealthChecks...)
+	report := HealthReport{Status: "ok", Version: s.Version, Checks: make([]HealthStatus, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Go(func() { report.Checks[i] = c.run(r.Context()) })
+	}
+	wg.Wait()
+
+	for _, c := range report.Checks {
+		if c.Status != "ok" && !c.Optional {
+			report.Status = "fail"
+		}
+	}
+	if report.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	rest.RenderJSON(w, report)
+}
+
+// checkTemplates verifies page templates are loaded
+func (s *Server) checkTemplates(context.Context) error {
+	if s.indexPage == nil || s.rulePage == nil || s.builderPage == nil || (s.Keys != nil && s.keysPage == nil) ||
+		(s.Users != nil && s.usersPage == nil) || (s.loginEnabled() && s.loginPage == nil) {
+		return errors.New("templates not loaded")
+	}
+	return nil
+}
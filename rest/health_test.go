@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_HealthLive(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	b, code := get(t, ts.URL+"/health/live")
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok","version":"dev-test"}`, b)
+}
+
+func TestServer_HealthReady(t *testing.T) {
+	ts, srv := startupT(t)
+	defer ts.Close()
+
+	var mongoDown atomic.Bool
+	var cfCalls atomic.Int32
+	srv.HealthChecks = []*HealthCheck{
+		{Name: "mongo", Check: func(context.Context) error {
+			if mongoDown.Load() {
+				return errors.New("server selection timeout")
+			}
+			return nil
+		}},
+		{Name: "cloudflare", Optional: true, CacheTTL: time.Minute, Check: func(context.Context) error {
+			cfCalls.Add(1)
+			return errors.New("token is expired")
+		}},
+	}
+
+	ready := func() (HealthReport, int) {
+		b, code := get(t, ts.URL+"/health/ready")
+		var report HealthReport
+		require.NoError(t, json.Unmarshal([]byte(b), &report), b)
+		return report, code
+	}
+
+	report, code := ready()
+	require.Equal(t, http.StatusOK, code, "optional check failure doesn't affect readiness")
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, "dev-test", report.Version)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, HealthStatus{Name: "templates", Status: "ok", DurationMS: report.Checks[0].DurationMS}, report.Checks[0])
+	assert.Equal(t, "mongo", report.Checks[1].Name)
+	assert.Equal(t, "ok", report.Checks[1].Status)
+	assert.Equal(t, HealthStatus{Name: "cloudflare", Status: "fail", Error: "token is expired", Optional: true,
+		DurationMS: report.Checks[2].DurationMS}, report.Checks[2])
+
+	mongoDown.Store(true)
+	report, code = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, "server selection timeout", report.Checks[1].Error)
+	assert.True(t, report.Checks[2].Cached)
+	assert.Equal(t, int32(1), cfCalls.Load(), "cached result reused")
+}
+
+func TestServer_HealthReadyTemplates(t *testing.T) {
+	srv := Server{Version: "v1"}
+	ts := httptest.NewServer(srv.routes("../web"))
+	defer ts.Close()
+
+	b, code := get(t, ts.URL+"/health/ready")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, b, `"error":"templates not loaded"`)
+}
+
+func TestHealthCheck_Timeout(t *testing.T) {
+	c := &HealthCheck{Name: "slow", Check: func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(healthCheckTimeout), deadline, time.Second)
+		return nil
+	}}
+	assert.Equal(t, "ok", c.run(context.Background()).Status)
+}
@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+// proxyImage serves image of extracted content by signed url made by extractor.ImageProxy.
+// Optional w parameter resizes the image down to one of configured widths.
+func (s *Server) proxyImage(w http.ResponseWriter, r *http.Request) {
+	proxy := s.Readability.ImageProxy
+	src := r.URL.Query().Get("u")
+	if src == "" || !proxy.Verify(src, r.URL.Query().Get("sig")) {
+		http.Error(w, "invalid image signature", http.StatusForbidden)
+		return
+	}
+	width := 0
+	if ws := r.URL.Query().Get("w"); ws != "" {
+		var err error
+		if width, err = strconv.Atoi(ws); err != nil || !slices.Contains(proxy.Widths, width) {
+			http.Error(w, "unsupported image width", http.StatusBadRequest)
+			return
+		}
+	}
+
+	img, err := proxy.Fetch(r.Context(), src, width)
+	if err != nil {
+		log.Printf("[WARN] can't proxy image %s, %v", src, err)
+		http.Error(w, "can't get image", imageErrorCode(err))
+		return
+	}
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if _, err = w.Write(img.Data); err != nil {
+		log.Printf("[WARN] failed to send image %s, %v", src, err)
+	}
+}
+
+// imageErrorCode maps image fetch error to http status, failures of the origin are reported as bad gateway
+func imageErrorCode(err error) int {
+	if errors.Is(err, extractor.ErrForbiddenTarget) || errors.Is(err, extractor.ErrContentTooLarge) ||
+		errors.Is(err, extractor.ErrUnsupportedContent) {
+		return extractErrorCode(err)
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+func TestServer_ProxyImage(t *testing.T) {
+	var pngData bytes.Buffer
+	require.NoError(t, png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 100, 100))))
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pic.png":
+			_, _ = w.Write(pngData.Bytes())
+		case "/page.html":
+			_, _ = w.Write([]byte("<html><body>not an image</body></html>"))
+		case "/post":
+			_, _ = w.Write([]byte(`<html><head><title>Post</title></head><body><article><p>` +
+				strings.Repeat("Some text long enough for the parser, ", 10) + `</p><img src="/pic.png"></article></body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer site.Close()
+
+	proxy := &extractor.ImageProxy{Secret: []byte("secret"), CacheSize: 1 << 20, Widths: []int{50}}
+	srv := Server{Readability: extractor.UReadability{TimeOut: 30 * time.Second, ImageProxy: proxy}}
+	ts := httptest.NewServer(srv.routes("../web"))
+	defer ts.Close()
+	proxy.BaseURL = ts.URL
+
+	resp, err := http.Get(proxy.URL(site.URL + "/pic.png"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+	cfg, _, err := image.DecodeConfig(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 100, cfg.Width)
+
+	resp, err = http.Get(proxy.URL(site.URL+"/pic.png") + "&w=50")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cfg, _, err = image.DecodeConfig(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.Width)
+
+	tbl := []struct {
+		name string
+		url  string
+		code int
+	}{
+		{name: "no signature", url: ts.URL + "/img?u=" + site.URL + "/pic.png", code: http.StatusForbidden},
+		{name: "wrong signature", url: strings.Replace(proxy.URL(site.URL+"/pic.png"), "pic.png", "other.png", 1),
+			code: http.StatusForbidden},
+		{name: "width not allowed", url: proxy.URL(site.URL+"/pic.png") + "&w=70", code: http.StatusBadRequest},
+		{name: "bad width", url: proxy.URL(site.URL+"/pic.png") + "&w=big", code: http.StatusBadRequest},
+		{name: "not an image", url: proxy.URL(site.URL + "/page.html"), code: http.StatusUnsupportedMediaType},
+		{name: "origin error", url: proxy.URL(site.URL + "/missing.png"), code: http.StatusBadGateway},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			_, code := get(t, tt.url)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+
+	t.Run("extract with proxy_images", func(t *testing.T) {
+		b, code := get(t, ts.URL+"/api/content/v1/parser?proxy_images=true&url="+site.URL+"/post")
+		require.Equal(t, http.StatusOK, code, b)
+		res := extractor.Response{}
+		require.NoError(t, json.Unmarshal([]byte(b), &res))
+		assert.Equal(t, proxy.URL(site.URL+"/pic.png"), res.Image)
+		assert.Contains(t, res.Rich, ts.URL+"/img?u=")
+	})
+}
+
+func TestServer_ProxyImageDisabled(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+	_, code := get(t, ts.URL+"/img?u=http://example.com/a.png&sig=x")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,292 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/go-pkgz/rest"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+//go:generate moq -out mocks/keys.go -pkg mocks -skip-ensure -fmt goimports . KeyStore
+
+// KeyStore defines access to API keys and their usage counters
+type KeyStore interface {
+	Create(ctx context.Context, key datastore.APIKey) (datastore.APIKey, error)
+	GetByHash(ctx context.Context, hash string) (datastore.APIKey, bool)
+	GetByID(ctx context.Context, id bson.ObjectID) (datastore.APIKey, bool)
+	All(ctx context.Context) []datastore.APIKey
+	SetEnabled(ctx context.Context, id bson.ObjectID, enabled bool) error
+	IncUsage(ctx context.Context, id bson.ObjectID, day string, limit int) (int64, error)
+	Usage(ctx context.Context, day string) map[bson.ObjectID]int64
+}
+
+// endpoints which can be allowed for API key
+const (
+	endpointParser  = "parser"  // GET /api/content/v1/parser
+	endpointExtract = "extract" // POST /api/extract
+	endpointEPUB    = "epub"    // POST /api/epub
+)
+
+// keyPrefixLen is the length of key prefix kept in storage to tell keys apart
+const keyPrefixLen = 11
+
+// apiAuth checks access to extraction endpoint. With key store set it requires API key, passed as bearer token or
+// token query parameter, and applies key's endpoint restrictions, rate limit and daily quota. The shared token
+// is accepted as a key without limits. Without key store every endpoint checks the shared token, if set.
+func (s *Server) apiAuth(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Keys == nil {
+			if s.checkAPIToken(w, r, endpoint) {
+				next(w, r)
+			}
+			return
+		}
+
+		key := requestKey(r)
+		if key == "" {
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusUnauthorized, nil, "no api key passed")
+			return
+		}
+		if s.Token != "" && subtle.ConstantTimeCompare([]byte(s.Token), []byte(key)) == 1 {
+			next(w, r)
+			return
+		}
+		apiKey, found := s.Keys.GetByHash(r.Context(), datastore.HashKey(key))
+		if !found || !apiKey.Enabled {
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusUnauthorized, nil, "invalid api key")
+			return
+		}
+		if len(apiKey.Endpoints) > 0 && !slices.Contains(apiKey.Endpoints, endpoint) {
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusForbidden, nil, "api key is not allowed to access "+endpoint)
+			return
+		}
+		if ok, retryAfter := s.limiter.allow(apiKey.ID, apiKey.RateLimit, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusTooManyRequests, nil, "rate limit exceeded")
+			return
+		}
+		// the counter isn't incremented past the quota, so rejected requests don't count as usage
+		_, err := s.Keys.IncUsage(r.Context(), apiKey.ID, time.Now().UTC().Format(time.DateOnly), apiKey.DailyQuota)
+		if errors.Is(err, datastore.ErrQuotaExceeded) {
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusTooManyRequests, nil, "daily quota exceeded")
+			return
+		}
+		if err != nil { // usage tracking failure shouldn't block requests
+			log.Printf("[WARN] can't count usage of key %s, %v", apiKey.Name, err)
+		}
+		log.Printf("[DEBUG] request to %s with api key %s", endpoint, apiKey.Name)
+		next(w, r)
+	}
+}
+
+// checkAPIToken checks the shared token, if set, when API keys are disabled. The parser endpoint keeps its
+// responses of checkToken, other endpoints accept the token as bearer header or token query parameter.
+func (s *Server) checkAPIToken(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	if endpoint == endpointParser {
+		return s.checkToken(w, r)
+	}
+	if s.Token == "" {
+		return true
+	}
+	token := requestKey(r)
+	if token == "" {
+		rest.SendErrorJSON(w, r, log.Default(), http.StatusUnauthorized, nil, "no token passed")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(s.Token), []byte(token)) == 0 {
+		rest.SendErrorJSON(w, r, log.Default(), http.StatusUnauthorized, nil, "wrong token passed")
+		return false
+	}
+	return true
+}
+
+// requestKey returns API key from Authorization bearer header or token query parameter
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// keyRow is API key with today's usage, for keys page
+type keyRow struct {
+	datastore.APIKey
+	UsedToday int64
+}
+
+// handleKeys renders API keys page
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	usage := s.Keys.Usage(r.Context(), time.Now().UTC().Format(time.DateOnly))
+	keys := s.Keys.All(r.Context())
+	rows := make([]keyRow, 0, len(keys))
+	for _, k := range keys {
+		rows = append(rows, keyRow{APIKey: k, UsedToday: usage[k.ID]})
+	}
+	data := struct {
+		Title string
+		Keys  []keyRow
+	}{
+		Title: "Ключи API",
+		Keys:  rows,
+	}
+	if err := s.keysPage.ExecuteTemplate(w, "base.gohtml", data); err != nil {
+		log.Printf("[WARN] failed to render keys template, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// createKey issues new API key. The key is shown once, only its hash is stored
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	rateLimit, err := formInt(r, "rate_limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dailyQuota, err := formInt(r, "daily_quota")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var endpoints []string
+	for _, e := range r.Form["endpoints"] {
+		if e != endpointParser && e != endpointExtract && e != endpointEPUB {
+			http.Error(w, "Unknown endpoint "+e, http.StatusBadRequest)
+			return
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apiKey, err := s.Keys.Create(r.Context(), datastore.APIKey{
+		Name:       name,
+		Hash:       datastore.HashKey(key),
+		Prefix:     key[:keyPrefixLen],
+		Enabled:    true,
+		Endpoints:  endpoints,
+		RateLimit:  rateLimit,
+		DailyQuota: dailyQuota,
+	})
+	if err != nil {
+		log.Printf("[ERROR] failed to create key %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] api key %s (%s) issued", apiKey.Name, apiKey.Prefix)
+
+	data := struct {
+		Key string
+		Row keyRow
+	}{Key: key, Row: keyRow{APIKey: apiKey}}
+	if err = s.keysPage.ExecuteTemplate(w, "key-created", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// toggleKey revokes enabled key or enables revoked one
+func (s *Server) toggleKey(w http.ResponseWriter, r *http.Request) {
+	id := getBid(r.PathValue("id"))
+	apiKey, found := s.Keys.GetByID(r.Context(), id)
+	if !found {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	apiKey.Enabled = !apiKey.Enabled
+	if err := s.Keys.SetEnabled(r.Context(), id, apiKey.Enabled); err != nil {
+		log.Printf("[ERROR] failed to toggle key: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] api key %s (%s) enabled=%v", apiKey.Name, apiKey.Prefix, apiKey.Enabled)
+
+	usage := s.Keys.Usage(r.Context(), time.Now().UTC().Format(time.DateOnly))
+	if err := s.keysPage.ExecuteTemplate(w, "key-row", keyRow{APIKey: apiKey, UsedToday: usage[id]}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// formInt parses optional non-negative integer form value
+func formInt(r *http.Request, name string) (int, error) {
+	v := strings.TrimSpace(r.FormValue(name))
+	if v == "" {
+		return 0, nil
+	}
+	res, err := strconv.Atoi(v)
+	if err != nil || res < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return res, nil
+}
+
+// newAPIKey generates random API key
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return "uk_" + hex.EncodeToString(b), nil
+}
+
+// keyLimiter is in-memory per key rate limiter. Each key has a token bucket holding up to a minute worth of
+// requests, refilled continuously.
+type keyLimiter struct {
+	mu      sync.Mutex
+	buckets map[bson.ObjectID]*keyBucket
+}
+
+type keyBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// allow takes a token from key's bucket, returns false and time until the next token if the bucket is empty.
+// Zero or negative limit allows everything.
+func (l *keyLimiter) allow(id bson.ObjectID, perMinute int, now time.Time) (ok bool, retryAfter time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = map[bson.ObjectID]*keyBucket{}
+	}
+	rate := float64(perMinute) / time.Minute.Seconds() // tokens per second
+	b, found := l.buckets[id]
+	if !found {
+		b = &keyBucket{tokens: float64(perMinute), updated: now}
+		l.buckets[id] = b
+	}
+	b.tokens = min(float64(perMinute), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
@@ -0,0 +1,324 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/extractor"
+	"github.com/ukeeper/ukeeper-readability/rest/mocks"
+)
+
+func TestServer_APIAuthKeys(t *testing.T) {
+	keys := newKeyStoreMock()
+	add := func(key string, k datastore.APIKey) datastore.APIKey {
+		k.Hash, k.Enabled = datastore.HashKey(key), true
+		res, err := keys.Create(context.Background(), k)
+		require.NoError(t, err)
+		return res
+	}
+	add("uk_full", datastore.APIKey{Name: "full"})
+	add("uk_parser", datastore.APIKey{Name: "parser only", Endpoints: []string{endpointParser}})
+	quota := add("uk_quota", datastore.APIKey{Name: "quota", DailyQuota: 2})
+	add("uk_rate", datastore.APIKey{Name: "rate", RateLimit: 1})
+	disabled := add("uk_disabled", datastore.APIKey{Name: "disabled"})
+	require.NoError(t, keys.SetEnabled(context.Background(), disabled.ID, false))
+
+	srv := &Server{Token: "master", Keys: keys}
+	call := func(endpoint string, r *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.apiAuth(endpoint, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })(rr, r)
+		return rr
+	}
+	withToken := func(token string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/content/v1/parser?url=http://example.com&token="+token, http.NoBody)
+	}
+	withBearer := func(key string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/extract", http.NoBody)
+		r.Header.Set("Authorization", "Bearer "+key)
+		return r
+	}
+
+	tbl := []struct {
+		name     string
+		endpoint string
+		req      *http.Request
+		code     int
+		err      string
+	}{
+		{"no key", endpointParser, withToken(""), http.StatusUnauthorized, "no api key passed"},
+		{"unknown key", endpointParser, withToken("uk_unknown"), http.StatusUnauthorized, "invalid api key"},
+		{"disabled key", endpointExtract, withBearer("uk_disabled"), http.StatusUnauthorized, "invalid api key"},
+		{"master token", endpointExtract, withBearer("master"), http.StatusOK, ""},
+		{"key in query", endpointParser, withToken("uk_full"), http.StatusOK, ""},
+		{"bearer key", endpointExtract, withBearer("uk_full"), http.StatusOK, ""},
+		{"allowed endpoint", endpointParser, withToken("uk_parser"), http.StatusOK, ""},
+		{"not allowed endpoint", endpointExtract, withBearer("uk_parser"), http.StatusForbidden,
+			"api key is not allowed to access extract"},
+		{"within quota 1", endpointParser, withToken("uk_quota"), http.StatusOK, ""},
+		{"within quota 2", endpointExtract, withBearer("uk_quota"), http.StatusOK, ""},
+		{"quota exceeded", endpointParser, withToken("uk_quota"), http.StatusTooManyRequests, "daily quota exceeded"},
+		{"within rate limit", endpointParser, withToken("uk_rate"), http.StatusOK, ""},
+		{"rate limit exceeded", endpointParser, withToken("uk_rate"), http.StatusTooManyRequests, "rate limit exceeded"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := call(tt.endpoint, tt.req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.err != "" {
+				assert.Contains(t, rr.Body.String(), tt.err)
+			}
+			if tt.code == http.StatusTooManyRequests && tt.err == "rate limit exceeded" {
+				assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+
+	usage := keys.Usage(context.Background(), time.Now().UTC().Format(time.DateOnly))
+	assert.Len(t, usage, 4, "usage counted for full, parser, quota and rate keys")
+	assert.Equal(t, int64(2), usage[quota.ID], "request over quota is not counted")
+}
+
+func TestServer_APIAuthLegacy(t *testing.T) {
+	srv := &Server{Token: "secret"}
+	call := func(endpoint, target string) int {
+		rr := httptest.NewRecorder()
+		srv.apiAuth(endpoint, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })(rr,
+			httptest.NewRequest(http.MethodGet, target, http.NoBody))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusExpectationFailed, call(endpointParser, "/api/content/v1/parser"))
+	assert.Equal(t, http.StatusUnauthorized, call(endpointParser, "/api/content/v1/parser?token=wrong"))
+	assert.Equal(t, http.StatusOK, call(endpointParser, "/api/content/v1/parser?token=secret"))
+	assert.Equal(t, http.StatusUnauthorized, call(endpointExtract, "/api/extract"))
+	assert.Equal(t, http.StatusUnauthorized, call(endpointEPUB, "/api/epub?token=wrong"))
+	assert.Equal(t, http.StatusOK, call(endpointExtract, "/api/extract?token=secret"))
+	assert.Equal(t, http.StatusOK, call(endpointEPUB, "/api/epub?token=secret"))
+
+	noToken := &Server{}
+	rr := httptest.NewRecorder()
+	noToken.apiAuth(endpointExtract, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })(rr,
+		httptest.NewRequest(http.MethodPost, "/api/extract", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code, "no token configured")
+}
+
+func TestServer_KeysAdmin(t *testing.T) {
+	keys := newKeyStoreMock()
+	srv := Server{
+		Readability: extractor.UReadability{TimeOut: 30 * time.Second, SnippetSize: 300, Rules: newRulesStoreMock()},
+		Credentials: map[string]string{"admin": "password"},
+		Keys:        keys,
+	}
+	webDir := "../web"
+	templates := template.Must(template.ParseGlob(filepath.Join(webDir, "components", "*.gohtml")))
+	srv.keysPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "keys.gohtml")))
+	ts := httptest.NewServer(srv.routes(webDir))
+	defer ts.Close()
+
+	_, code := get(t, ts.URL+"/keys")
+	assert.Equal(t, http.StatusUnauthorized, code, "keys page requires auth")
+
+	// issue key
+	resp, err := postFormUrlencoded(t, ts.URL+"/api/keys", "name=reader+app&endpoints=parser&rate_limit=60&daily_quota=1000")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Contains(t, string(body), "reader app")
+
+	all := keys.All(context.Background())
+	require.Len(t, all, 1)
+	key := all[0]
+	assert.Equal(t, "reader app", key.Name)
+	assert.True(t, key.Enabled)
+	assert.Equal(t, []string{endpointParser}, key.Endpoints)
+	assert.Equal(t, 60, key.RateLimit)
+	assert.Equal(t, 1000, key.DailyQuota)
+	assert.True(t, strings.HasPrefix(key.Prefix, "uk_"))
+	assert.Len(t, key.Prefix, keyPrefixLen)
+	assert.NotContains(t, key.Hash, "uk_")
+
+	// plaintext key shown once and authorizes requests
+	idx := strings.Index(string(body), key.Prefix)
+	require.Positive(t, idx)
+	plain := string(body)[idx : idx+len("uk_")+48] // uk_ and 24 random bytes in hex
+	assert.Equal(t, key.Hash, datastore.HashKey(plain))
+
+	page, err := getWithAuth(t, ts.URL+"/keys")
+	require.NoError(t, err)
+	assert.Contains(t, page, "reader app")
+	assert.Contains(t, page, key.Prefix+"…")
+	assert.NotContains(t, page, plain, "key is not shown on the page")
+
+	// revoke key
+	resp, err = post(t, ts.URL+"/api/toggle-key/"+key.ID.Hex(), "")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "rules__row_disabled")
+	revoked, found := keys.GetByID(context.Background(), key.ID)
+	require.True(t, found)
+	assert.False(t, revoked.Enabled)
+
+	b, code := get(t, ts.URL+"/api/content/v1/parser?url="+url.QueryEscape("http://example.com")+"&token="+plain)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	var errResp map[string]string
+	require.NoError(t, json.Unmarshal([]byte(b), &errResp))
+	assert.Equal(t, "invalid api key", errResp["error"])
+
+	// bad requests
+	for _, form := range []string{"name=", "name=x&rate_limit=-1", "name=x&daily_quota=abc", "name=x&endpoints=admin"} {
+		resp, err = postFormUrlencoded(t, ts.URL+"/api/keys", form)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, form)
+	}
+	resp, err = post(t, ts.URL+"/api/toggle-key/"+bson.NewObjectID().Hex(), "")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_KeysDisabled(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	_, code := get(t, ts.URL+"/keys")
+	assert.Equal(t, http.StatusNotFound, code)
+	resp, err := postFormUrlencoded(t, ts.URL+"/api/keys", "name=test")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestKeyLimiter(t *testing.T) {
+	var l keyLimiter
+	id := bson.NewObjectID()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 3 {
+		ok, _ := l.allow(id, 3, now)
+		require.True(t, ok)
+	}
+	ok, retryAfter := l.allow(id, 3, now)
+	assert.False(t, ok, "burst of a minute worth of requests used")
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	ok, _ = l.allow(id, 3, now.Add(19*time.Second))
+	assert.False(t, ok)
+	ok, _ = l.allow(id, 3, now.Add(20*time.Second))
+	assert.True(t, ok, "token refilled")
+
+	ok, _ = l.allow(bson.NewObjectID(), 3, now)
+	assert.True(t, ok, "keys limited independently")
+	for range 100 {
+		ok, _ = l.allow(id, 0, now)
+		require.True(t, ok, "zero limit is unlimited")
+	}
+}
+
+func getWithAuth(t *testing.T, u string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, u, http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// newKeyStoreMock creates a moq-generated KeyStoreMock with in-memory behavior
+func newKeyStoreMock() *mocks.KeyStoreMock {
+	var mu sync.Mutex
+	var keys []datastore.APIKey
+	usage := map[string]map[bson.ObjectID]int64{}
+
+	return &mocks.KeyStoreMock{
+		CreateFunc: func(_ context.Context, key datastore.APIKey) (datastore.APIKey, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			key.ID = bson.NewObjectID()
+			key.CreatedAt = time.Now()
+			keys = append([]datastore.APIKey{key}, keys...)
+			return key, nil
+		},
+		GetByHashFunc: func(_ context.Context, hash string) (datastore.APIKey, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, k := range keys {
+				if k.Hash == hash {
+					return k, true
+				}
+			}
+			return datastore.APIKey{}, false
+		},
+		GetByIDFunc: func(_ context.Context, id bson.ObjectID) (datastore.APIKey, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, k := range keys {
+				if k.ID == id {
+					return k, true
+				}
+			}
+			return datastore.APIKey{}, false
+		},
+		AllFunc: func(context.Context) []datastore.APIKey {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]datastore.APIKey{}, keys...)
+		},
+		SetEnabledFunc: func(_ context.Context, id bson.ObjectID, enabled bool) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for i := range keys {
+				if keys[i].ID == id {
+					keys[i].Enabled = enabled
+					return nil
+				}
+			}
+			return assert.AnError
+		},
+		IncUsageFunc: func(_ context.Context, id bson.ObjectID, day string, limit int) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if usage[day] == nil {
+				usage[day] = map[bson.ObjectID]int64{}
+			}
+			if limit > 0 && usage[day][id] >= int64(limit) {
+				return 0, datastore.ErrQuotaExceeded
+			}
+			usage[day][id]++
+			return usage[day][id], nil
+		},
+		UsageFunc: func(_ context.Context, day string) map[bson.ObjectID]int64 {
+			mu.Lock()
+			defer mu.Unlock()
+			res := map[bson.ObjectID]int64{}
+			for id, n := range usage[day] {
+				res[id] = n
+			}
+			return res
+		},
+	}
+}
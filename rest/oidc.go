@@ -0,0 +1,229 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	log "github.com/go-pkgz/lgr"
+	"golang.org/x/oauth2"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	oidcInitTimeout = 10 * time.Second
+)
+
+// OIDC configures OpenID Connect single sign-on to the admin UI, with authorization code flow and PKCE
+type OIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string                    // callback url, like https://example.com/auth/oidc/callback
+	Scopes       []string                  // extra scopes; openid, profile and email are always requested
+	GroupsClaim  string                    // ID token claim with user's groups, "groups" if empty
+	GroupRoles   map[string]datastore.Role // group to role mapping, the most privileged matching role wins
+	DefaultRole  datastore.Role            // role of users without mapped groups, login is denied if empty
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+	oauth    *oauth2.Config
+}
+
+// oidcState is kept in a short-lived signed cookie between login redirect and callback
+type oidcState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Nonce    string `json:"nonce"`
+	Next     string `json:"next"`
+}
+
+// init discovers the provider on first use. Failed discovery is retried on the next login,
+// so the service starts even if the issuer is temporarily unreachable.
+func (o *OIDC) init(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.oauth != nil {
+		return o.oauth, o.verifier, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, oidcInitTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, o.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discover oidc provider %s: %w", o.Issuer, err)
+	}
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+	for _, s := range o.Scopes {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	o.oauth = &oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  o.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.ClientID})
+	return o.oauth, o.verifier, nil
+}
+
+// role returns the most privileged role mapped from user's groups, or the default one
+func (o *OIDC) role(groups []string) datastore.Role {
+	role := o.DefaultRole
+	for _, g := range groups {
+		if r, ok := o.GroupRoles[g]; ok && r.Allows(role) {
+			role = r
+		}
+	}
+	return role
+}
+
+// oidcLogin redirects to the identity provider
+func (s *Server) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	config, _, err := s.OIDC.init(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		s.renderLogin(w, http.StatusBadGateway, r.URL.Query().Get("next"), "Сервис входа недоступен")
+		return
+	}
+	st := oidcState{State: randomString(), Verifier: oauth2.GenerateVerifier(), Nonce: randomString(),
+		Next: r.URL.Query().Get("next")}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: value + "." + s.sign("oidc", value), Path: "/auth/oidc",
+		MaxAge: int(oidcStateTTL.Seconds()), HttpOnly: true, Secure: isSecure(r), SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, config.AuthCodeURL(st.State, oauth2.S256ChallengeOption(st.Verifier), oidc.Nonce(st.Nonce)),
+		http.StatusFound)
+}
+
+// oidcCallback exchanges authorization code for ID token, maps user's groups to role and starts session
+func (s *Server) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/auth/oidc", MaxAge: -1})
+	st, err := s.oidcState(r)
+	if err != nil {
+		log.Printf("[WARN] oidc callback rejected, %v", err)
+		s.renderLogin(w, http.StatusBadRequest, "", "Не удалось войти, попробуйте ещё раз")
+		return
+	}
+	name, role, err := s.oidcUser(r, st)
+	if err != nil {
+		log.Printf("[WARN] oidc login failed, %v", err)
+		s.renderLogin(w, http.StatusUnauthorized, st.Next, "Не удалось войти, попробуйте ещё раз")
+		return
+	}
+	if !role.Valid() {
+		log.Printf("[WARN] oidc user %s has no role", name)
+		s.renderLogin(w, http.StatusForbidden, st.Next, "У пользователя "+name+" нет доступа")
+		return
+	}
+	expires := time.Now().Add(sessionTTL)
+	s.startSession(w, r, s.ssoSessionValue(name, role, expires.Unix()), expires)
+	log.Printf("[INFO] user %s (%s) logged in with oidc", name, role)
+	http.Redirect(w, r, localRedirect(st.Next), http.StatusSeeOther)
+}
+
+// oidcState returns login state from the cookie, checking it matches the callback
+func (s *Server) oidcState(r *http.Request) (oidcState, error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return oidcState{}, errors.New("no state cookie")
+	}
+	value, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign("oidc", value))) {
+		return oidcState{}, errors.New("bad state cookie signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return oidcState{}, fmt.Errorf("decode state cookie: %w", err)
+	}
+	var st oidcState
+	if err = json.Unmarshal(payload, &st); err != nil {
+		return oidcState{}, fmt.Errorf("unmarshal state cookie: %w", err)
+	}
+	if q := r.URL.Query(); q.Get("error") != "" {
+		return oidcState{}, fmt.Errorf("identity provider error %s: %s", q.Get("error"), q.Get("error_description"))
+	}
+	if st.State == "" || r.URL.Query().Get("state") != st.State {
+		return oidcState{}, errors.New("state mismatch")
+	}
+	return st, nil
+}
+
+// oidcUser makes code exchange and returns user name and role from verified ID token
+func (s *Server) oidcUser(r *http.Request, st oidcState) (name string, role datastore.Role, err error) {
+	config, verifier, err := s.OIDC.init(r.Context())
+	if err != nil {
+		return "", "", err
+	}
+	token, err := config.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return "", "", fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", "", errors.New("no id_token in token response")
+	}
+	idToken, err := verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return "", "", fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != st.Nonce {
+		return "", "", errors.New("nonce mismatch")
+	}
+	var claims map[string]any
+	if err = idToken.Claims(&claims); err != nil {
+		return "", "", fmt.Errorf("parse claims: %w", err)
+	}
+
+	for _, c := range []string{"preferred_username", "email"} {
+		if v, ok := claims[c].(string); ok && v != "" {
+			name = v
+			break
+		}
+	}
+	if name == "" {
+		name = idToken.Subject
+	}
+	groupsClaim := s.OIDC.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	var groups []string
+	switch v := claims[groupsClaim].(type) {
+	case string:
+		groups = []string{v}
+	case []any:
+		for _, g := range v {
+			if gs, ok := g.(string); ok {
+				groups = append(groups, gs)
+			}
+		}
+	}
+	return name, s.OIDC.role(groups), nil
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,292 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/datastore"
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+func TestServer_OIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	defer issuer.Close()
+	ts, _ := startupOIDCT(t, issuer)
+	defer ts.Close()
+
+	t.Run("editor group", func(t *testing.T) {
+		issuer.setUser("jane", []string{"staff", "rule-editors"})
+		client := newSessionClient(t)
+		resp, err := client.Get(ts.URL + "/auth/oidc/login?next=" + url.QueryEscape("/add/"))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.Equal(t, "/add/", resp.Request.URL.Path)
+		assert.Contains(t, string(body), "Добавление правила")
+
+		auth := issuer.lastAuth()
+		assert.Equal(t, "S256", auth.Get("code_challenge_method"))
+		assert.NotEmpty(t, auth.Get("code_challenge"))
+		assert.NotEmpty(t, auth.Get("nonce"))
+		assert.Equal(t, "openid profile email groups", auth.Get("scope"))
+
+		resp, err = sessionPost(t, client, ts.URL+"/api/rule", "domain=example.com&content=article")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "editor saves rules")
+		resp, err = sessionPost(t, client, ts.URL+"/api/keys", "name=test")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "editor doesn't manage keys")
+	})
+
+	t.Run("most privileged group wins", func(t *testing.T) {
+		issuer.setUser("boss", []string{"rule-editors", "ureadability-admins"})
+		client := newSessionClient(t)
+		resp, err := client.Get(ts.URL + "/auth/oidc/login")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, "/", resp.Request.URL.Path)
+		resp, err = client.Get(ts.URL + "/keys")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("no mapped group", func(t *testing.T) {
+		issuer.setUser("stranger", []string{"staff"})
+		client := newSessionClient(t)
+		resp, err := client.Get(ts.URL + "/auth/oidc/login")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Contains(t, string(body), "У пользователя stranger нет доступа")
+		assert.Empty(t, csrfFromJar(t, client, ts.URL), "no session")
+	})
+
+	t.Run("pkce verifier mismatch", func(t *testing.T) {
+		issuer.setUser("jane", []string{"rule-editors"})
+		issuer.breakPKCE.Store(true)
+		defer issuer.breakPKCE.Store(false)
+		client := newSessionClient(t)
+		resp, err := client.Get(ts.URL + "/auth/oidc/login")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("callback without login", func(t *testing.T) {
+		client := newSessionClient(t)
+		resp, err := client.Get(ts.URL + "/auth/oidc/callback?code=abc&state=xyz")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		client := newSessionClient(t)
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := client.Get(ts.URL + "/auth/oidc/login")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		resp, err = client.Get(ts.URL + "/auth/oidc/callback?code=abc&state=forged")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("login page", func(t *testing.T) {
+		b, code := get(t, ts.URL+"/login?next=/edit/1")
+		require.Equal(t, http.StatusOK, code)
+		assert.Contains(t, b, `href="/auth/oidc/login?next=%2fedit%2f1"`)
+		assert.NotContains(t, b, `name="password"`, "no password login without users")
+	})
+}
+
+func TestServer_OIDCIssuerUnavailable(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.Close()
+	ts, _ := startupOIDCT(t, issuer)
+	defer ts.Close()
+
+	b, code := get(t, ts.URL+"/auth/oidc/login")
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.Contains(t, b, "Сервис входа недоступен")
+}
+
+func TestOIDC_Role(t *testing.T) {
+	o := OIDC{GroupRoles: map[string]datastore.Role{"admins": datastore.RoleAdmin, "editors": datastore.RoleEditor,
+		"viewers": datastore.RoleViewer}}
+	assert.Equal(t, datastore.Role(""), o.role(nil))
+	assert.Equal(t, datastore.Role(""), o.role([]string{"other"}))
+	assert.Equal(t, datastore.RoleViewer, o.role([]string{"viewers"}))
+	assert.Equal(t, datastore.RoleAdmin, o.role([]string{"admins", "viewers"}))
+	assert.Equal(t, datastore.RoleAdmin, o.role([]string{"viewers", "admins", "editors"}))
+
+	o.DefaultRole = datastore.RoleViewer
+	assert.Equal(t, datastore.RoleViewer, o.role([]string{"other"}))
+	assert.Equal(t, datastore.RoleEditor, o.role([]string{"editors"}))
+}
+
+// startupOIDCT runs testing server with single sign-on through the issuer and without stored users
+func startupOIDCT(t *testing.T, issuer *mockIssuer) (*httptest.Server, *Server) {
+	t.Helper()
+	srv := Server{
+		Readability: extractor.UReadability{TimeOut: 30 * time.Second, SnippetSize: 300, Rules: newRulesStoreMock()},
+		Keys:        newKeyStoreMock(),
+		OIDC: &OIDC{
+			Issuer:       issuer.URL,
+			ClientID:     "ureadability",
+			ClientSecret: "client-secret",
+			Scopes:       []string{"groups"},
+			GroupRoles: map[string]datastore.Role{"rule-editors": datastore.RoleEditor,
+				"ureadability-admins": datastore.RoleAdmin},
+		},
+		Version: "dev-test",
+	}
+	webDir := "../web"
+	templates := template.Must(template.ParseGlob(filepath.Join(webDir, "components", "*.gohtml")))
+	srv.indexPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "index.gohtml")))
+	srv.rulePage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "rule.gohtml")))
+	srv.keysPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "keys.gohtml")))
+	srv.loginPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "login.gohtml")))
+	ts := httptest.NewServer(srv.routes(webDir))
+	srv.OIDC.RedirectURL = ts.URL + "/auth/oidc/callback"
+	return ts, &srv
+}
+
+// mockIssuer is a minimal OpenID Connect provider, authorizing the configured user right away
+type mockIssuer struct {
+	*httptest.Server
+	t         *testing.T
+	key       *rsa.PrivateKey
+	breakPKCE atomic.Bool
+
+	mu     sync.Mutex
+	user   string
+	groups []string
+	auth   url.Values            // last authorization request
+	codes  map[string]url.Values // authorization requests by issued code
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockIssuer{t: t, key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("GET /authorize", m.authorize)
+	mux.HandleFunc("POST /token", m.token)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) setUser(name string, groups []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user, m.groups = name, groups
+}
+
+func (m *mockIssuer) lastAuth() url.Values {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.auth
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &m.key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+	}})
+}
+
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	code := randomString()
+	m.mu.Lock()
+	m.auth, m.codes[code] = q, q
+	m.mu.Unlock()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	require.NoError(m.t, err)
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(m.t, r.ParseForm())
+	m.mu.Lock()
+	auth, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	user, groups := m.user, m.groups
+	m.mu.Unlock()
+
+	clientID, secret, _ := r.BasicAuth()
+	if clientID == "" {
+		clientID, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	verifier := r.FormValue("code_verifier")
+	if m.breakPKCE.Load() {
+		verifier += "x"
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	if !ok || clientID != "ureadability" || secret != "client-secret" ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	require.NoError(m.t, err)
+	claims, err := json.Marshal(map[string]any{
+		"iss": m.URL, "sub": "id-" + user, "aud": clientID, "nonce": auth.Get("nonce"),
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		"preferred_username": user, "groups": groups,
+	})
+	require.NoError(m.t, err)
+	jws, err := signer.Sign(claims)
+	require.NoError(m.t, err)
+	idToken, err := jws.CompactSerialize()
+	require.NoError(m.t, err)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "token_type": "Bearer", "expires_in": 3600,
+		"id_token": idToken})
+}
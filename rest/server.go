@@ -4,12 +4,18 @@ package rest
 import (
 	"context"
 	"crypto/subtle"
+	"errors"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
@@ -17,9 +23,11 @@ import (
 	"github.com/go-pkgz/rest/logger"
 	"github.com/go-pkgz/routegroup"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"github.com/ukeeper/ukeeper-readability/datastore"
 	"github.com/ukeeper/ukeeper-readability/extractor"
+	"github.com/ukeeper/ukeeper-readability/metrics"
 )
 
 // Server is a basic rest server providing access to store and invoking parser
@@ -29,10 +37,29 @@ type Server struct {
 	Token       string
 	Credentials map[string]string
 
-	indexPage *template.Template
-	rulePage  *template.Template
+	HealthChecks    []*HealthCheck // dependency checks reported by /health/ready, like mongo connectivity
+	ShutdownTimeout time.Duration  // max time to wait for in-flight requests on shutdown; defaults to 30s
+	BatchTimeout    time.Duration  // max time of multi-url requests, EPUB and rule suggestion; defaults to 120s
+	Keys            KeyStore       // per-client API keys; if nil, only the shared token is checked
+	Users           UserStore      // admin UI users with roles; if nil, basic auth with Credentials is used
+	OIDC            *OIDC          // single sign-on to admin UI; can be used together with Users
+	SessionSecret   []byte         // key to sign login sessions; random if empty
+
+	indexPage   *template.Template
+	rulePage    *template.Template
+	keysPage    *template.Template
+	loginPage   *template.Template
+	usersPage   *template.Template
+	builderPage *template.Template
+	limiter     keyLimiter
+	secretOnce  sync.Once
+	draining    atomic.Bool  // set on shutdown, new requests are rejected
+	inFlight    atomic.Int64 // number of requests being served
 }
 
+// defaultBatchTimeout leaves the multi-url handlers time to respond within the server WriteTimeout
+const defaultBatchTimeout = 120 * time.Second
+
 // JSON is a map alias, just for convenience
 type JSON map[string]any
 
@@ -44,35 +71,55 @@ func (s *Server) Run(ctx context.Context, address string, port int, frontendDir
 	t := template.Must(template.ParseGlob(filepath.Join(frontendDir, "components", "*.gohtml")))
 	s.rulePage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "rule.gohtml")))
 	s.indexPage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "index.gohtml")))
+	s.keysPage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "keys.gohtml")))
+	s.loginPage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "login.gohtml")))
+	s.usersPage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "users.gohtml")))
+	s.builderPage = template.Must(template.Must(t.Clone()).ParseFiles(filepath.Join(frontendDir, "builder.gohtml")))
+	// requests get work context instead of ctx, so they aren't canceled at once on shutdown but only
+	// after the drain timeout
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 	httpServer := &http.Server{
 		Addr:              fmt.Sprintf("%s:%d", address, port),
 		Handler:           s.routes(frontendDir),
+		BaseContext:       func(net.Listener) context.Context { return workCtx },
 		ReadHeaderTimeout: 5 * time.Second,
 		// WriteTimeout is server-wide rather than per-route because the extraction endpoints
 		// are the only potentially long-running handlers (other handlers — static files, rule
 		// CRUD, /ping — finish in milliseconds and are unaffected by this ceiling). 150s covers
 		// the worst-case Cloudflare path: 1 initial request + 2 retries with 11s/22s exponential
 		// backoff + up to 30s per CF request. If extraction ever moves off the server-wide
-		// timeout, wrap only those routes with http.TimeoutHandler instead.
+		// timeout, wrap only those routes with http.TimeoutHandler instead. Multi-url handlers,
+		// EPUB and rule suggestion, stop their work after BatchTimeout to fit in it.
 		WriteTimeout: 150 * time.Second,
 		IdleTimeout:  30 * time.Second,
 	}
+	shutdownDone := make(chan struct{})
 	go func() {
 		// shutdown on context cancellation
+		defer close(shutdownDone)
 		<-ctx.Done()
-		if err := httpServer.Shutdown(ctx); err != nil {
-			log.Printf("[DEBUG] http shutdown error, %s", err)
-		}
+		s.drain(httpServer, cancelWork)
+		s.Readability.Wait() // background work may still use the store closed after Run
 		log.Print("[DEBUG] http server shutdown completed")
 	}()
 
-	log.Printf("[WARN] http server terminated, %s", httpServer.ListenAndServe())
+	err := httpServer.ListenAndServe()
+	log.Printf("[WARN] http server terminated, %s", err)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdownDone // ListenAndServe returns as soon as shutdown starts, wait for in-flight requests
+	}
 }
 
 func (s *Server) routes(frontendDir string) http.Handler {
 	router := routegroup.New(http.NewServeMux())
 
 	router.Use(rest.Recoverer(log.Default()))
+	router.Use(s.trackInFlight)
+	// continue trace from incoming traceparent header, if any, so extraction spans join the caller's trace
+	router.Use(otelhttp.NewMiddleware("ureadability", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	})))
 	router.Use(rest.RealIP)
 	router.Use(rest.AppInfo("ureadability", "Umputun", s.Version), rest.Ping)
 	router.Use(rest.Throttle(50))
@@ -80,22 +127,66 @@ func (s *Server) routes(frontendDir string) http.Handler {
 
 	router.Route(func(api *routegroup.Bundle) {
 		api.Mount("/api").Route(func(api *routegroup.Bundle) {
-			api.HandleFunc("GET /content/v1/parser", s.extractArticleEmulateReadability)
-			api.HandleFunc("POST /extract", s.extractArticle)
+			api.HandleFunc("GET /content/v1/parser", s.apiAuth(endpointParser, s.extractArticleEmulateReadability))
+			api.HandleFunc("POST /extract", s.apiAuth(endpointExtract, s.extractArticle))
+			api.HandleFunc("POST /epub", s.apiAuth(endpointEPUB, s.makeEPUB))
 			api.HandleFunc("POST /auth", s.authFake)
 
-			// add protected group with its own set of middlewares
-			protectedGroup := api.Group()
-			protectedGroup.Use(basicAuth("ureadability", s.Credentials))
-			protectedGroup.HandleFunc("POST /rule", s.saveRule)
-			protectedGroup.HandleFunc("POST /toggle-rule/{id}", s.toggleRule)
-			protectedGroup.HandleFunc("POST /preview", s.handlePreview)
+			// add protected groups with their own set of middlewares, one per role
+			viewerGroup := api.Group()
+			viewerGroup.Use(s.authorize(datastore.RoleViewer))
+			viewerGroup.HandleFunc("POST /preview", s.handlePreview)
+
+			editorGroup := api.Group()
+			editorGroup.Use(s.authorize(datastore.RoleEditor))
+			editorGroup.HandleFunc("POST /rule", s.saveRule)
+			editorGroup.HandleFunc("POST /toggle-rule/{id}", s.toggleRule)
+			editorGroup.HandleFunc("GET /builder/page", s.builderFrame)
+			editorGroup.HandleFunc("POST /suggest-rule", s.suggestRule)
+
+			adminGroup := api.Group()
+			adminGroup.Use(s.authorize(datastore.RoleAdmin))
+			if s.Keys != nil {
+				adminGroup.HandleFunc("POST /keys", s.createKey)
+				adminGroup.HandleFunc("POST /toggle-key/{id}", s.toggleKey)
+			}
+			if s.Users != nil {
+				adminGroup.HandleFunc("POST /users", s.saveUser)
+				adminGroup.HandleFunc("POST /user-role/{name}", s.setUserRole)
+				adminGroup.HandleFunc("POST /delete-user/{name}", s.deleteUser)
+			}
 		})
 	})
 
-	router.HandleFunc("GET /", s.handleIndex)
-	router.HandleFunc("GET /add/", s.handleAdd)
-	router.HandleFunc("GET /edit/{id}", s.handleEdit)
+	router.Handle("GET /metrics", metrics.Handler())
+	if s.Readability.ImageProxy != nil { // public, proxied urls are signed
+		router.HandleFunc("GET /img", s.proxyImage)
+	}
+	router.HandleFunc("GET /health/live", s.healthLive)
+	router.HandleFunc("GET /health/ready", s.healthReady)
+
+	router.Route(func(pages *routegroup.Bundle) {
+		if s.Users != nil {
+			pages.HandleFunc("POST /login", s.login)
+			pages.With(s.authorize(datastore.RoleAdmin)).HandleFunc("GET /users", s.handleUsers)
+		}
+		if s.OIDC != nil {
+			pages.HandleFunc("GET /auth/oidc/login", s.oidcLogin)
+			pages.HandleFunc("GET /auth/oidc/callback", s.oidcCallback)
+		}
+		if s.loginEnabled() { // rules pages are public without login
+			pages.HandleFunc("GET /login", s.handleLogin)
+			pages.With(s.authorize(datastore.RoleViewer)).HandleFunc("POST /logout", s.logout)
+			pages = pages.With(s.authorize(datastore.RoleViewer))
+		}
+		pages.HandleFunc("GET /", s.handleIndex)
+		pages.HandleFunc("GET /add/", s.handleAdd)
+		pages.HandleFunc("GET /edit/{id}", s.handleEdit)
+	})
+	router.With(s.authorize(datastore.RoleEditor)).HandleFunc("GET /builder", s.handleBuilder)
+	if s.Keys != nil {
+		router.With(s.authorize(datastore.RoleAdmin)).HandleFunc("GET /keys", s.handleKeys)
+	}
 
 	_ = os.Mkdir(filepath.Join(frontendDir, "static"), 0o700)
 	router.HandleFiles("/", http.Dir(filepath.Join(frontendDir, "static")))
@@ -103,15 +194,37 @@ func (s *Server) routes(frontendDir string) http.Handler {
 }
 
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	rules := s.Readability.Rules.All(r.Context())
+	filter := parseRulesFilter(r)
+	rules, total, err := s.Readability.Rules.List(r.Context(), filter.query())
+	if err != nil {
+		log.Printf("[WARN] failed to list rules, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	data := struct {
-		Title string
-		Rules []datastore.Rule
+		Title  string
+		Rules  []datastore.Rule
+		Filter rulesFilter
+		Users  []string
+		Total  int64
+		Pages  int
+		Prev   string // previous page url, empty on the first page
+		Next   string // next page url, empty on the last page
 	}{
-		Title: "Правила",
-		Rules: rules,
+		Title:  "Правила",
+		Rules:  rules,
+		Filter: filter,
+		Users:  s.Readability.Rules.Users(r.Context()),
+		Total:  total,
+		Pages:  max(int((total+int64(filter.pageSize)-1)/int64(filter.pageSize)), 1),
+	}
+	if filter.Page > 1 {
+		data.Prev = filter.url(min(filter.Page-1, data.Pages))
 	}
-	err := s.indexPage.ExecuteTemplate(w, "base.gohtml", data)
+	if filter.Page < data.Pages {
+		data.Next = filter.url(filter.Page + 1)
+	}
+	err = s.indexPage.ExecuteTemplate(w, "base.gohtml", data)
 	if err != nil {
 		log.Printf("[WARN] failed to render index template, %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -119,7 +232,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) handleAdd(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Title string
 		Rule  datastore.Rule
@@ -127,6 +240,7 @@ func (s *Server) handleAdd(w http.ResponseWriter, _ *http.Request) {
 		Title: "Добавление правила",
 		Rule:  datastore.Rule{}, // empty rule for the form
 	}
+	builderValues(r, &data.Rule)
 	err := s.rulePage.ExecuteTemplate(w, "base.gohtml", data)
 	if err != nil {
 		log.Printf("[WARN] failed to render add template, %v", err)
@@ -149,6 +263,7 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		Title: "Редактирование правила",
 		Rule:  rule,
 	}
+	builderValues(r, &data.Rule)
 	err := s.rulePage.ExecuteTemplate(w, "base.gohtml", data)
 	if err != nil {
 		log.Printf("[WARN] failed to render edit template, %v", err)
@@ -169,9 +284,9 @@ func (s *Server) extractArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := s.Readability.Extract(r.Context(), artRequest.URL)
+	res, err := s.Readability.ExtractWithOptions(r.Context(), artRequest.URL, extractOptions(r))
 	if err != nil {
-		rest.SendErrorJSON(w, r, log.Default(), http.StatusBadRequest, err, "can't extract content")
+		rest.SendErrorJSON(w, r, log.Default(), extractErrorCode(err), err, "can't extract content")
 		return
 	}
 
@@ -179,21 +294,22 @@ func (s *Server) extractArticle(w http.ResponseWriter, r *http.Request) {
 }
 
 // extractArticleEmulateReadability emulates readability API parse - https://www.readability.com/api/content/v1/parser?token=%s&url=%s
-// if token is not set for application, it won't be checked
+// token is checked by apiAuth. Content is flat text, as it always was for this endpoint, unless text format
+// or width is requested.
 func (s *Server) extractArticleEmulateReadability(w http.ResponseWriter, r *http.Request) {
-	if !s.checkToken(w, r) {
-		return
-	}
-
 	extractURL := r.URL.Query().Get("url")
 	if extractURL == "" {
 		rest.SendErrorJSON(w, r, log.Default(), http.StatusExpectationFailed, nil, "no url passed")
 		return
 	}
 
-	res, err := s.Readability.Extract(r.Context(), extractURL)
+	opts := extractOptions(r)
+	if opts.Text == "" && opts.TextWidth == 0 {
+		opts.Text = extractor.TextFlat
+	}
+	res, err := s.Readability.ExtractWithOptions(r.Context(), extractURL, opts)
 	if err != nil {
-		rest.SendErrorJSON(w, r, log.Default(), http.StatusBadRequest, err, "can't extract content")
+		rest.SendErrorJSON(w, r, log.Default(), extractErrorCode(err), err, "can't extract content")
 		return
 	}
 
@@ -217,22 +333,27 @@ func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 	var tempRule *datastore.Rule
 	if content != "" {
 		tempRule = &datastore.Rule{
-			Enabled: true,
-			Content: content,
+			Enabled:   true,
+			Content:   content,
+			Excludes:  strings.Split(r.FormValue("excludes"), "\n"),
+			UserAgent: strings.TrimSpace(r.FormValue("user_agent")),
+			Headers:   formLines(r, "headers"),
+			Cookies:   formLines(r, "cookies"),
+			NextPage:  strings.TrimSpace(r.FormValue("next_page")),
 		}
 	}
 
 	responses := make([]extractor.Response, 0, len(testURLs))
-	for _, url := range testURLs {
-		url = strings.TrimSpace(url)
-		if url == "" {
+	for _, testURL := range testURLs {
+		testURL = strings.TrimSpace(testURL)
+		if testURL == "" {
 			continue
 		}
 
-		log.Printf("[DEBUG] custom rule provided for %s: %v", url, tempRule)
-		result, e := s.Readability.ExtractByRule(r.Context(), url, tempRule)
+		log.Printf("[DEBUG] custom rule provided for %s: %v", testURL, tempRule)
+		result, e := s.Readability.ExtractByRule(r.Context(), testURL, tempRule)
 		if e != nil {
-			log.Printf("[WARN] failed to extract content for %s: %v", url, e)
+			log.Printf("[WARN] failed to extract content for %s: %v", testURL, e)
 			continue
 		}
 
@@ -242,10 +363,13 @@ func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 	// create a new type where Rich would be type template.HTML instead of string,
 	// to avoid escaping in the template
 	type result struct {
-		Title   string
-		Excerpt string
-		Rich    template.HTML
-		Content string
+		Title       string
+		Excerpt     string
+		Rich        template.HTML
+		Content     string
+		WordCount   int
+		ReadingTime int
+		Language    string
 	}
 
 	results := make([]result, 0, len(responses))
@@ -254,9 +378,12 @@ func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 		results = append(results, result{
 			Title:   r.Title,
 			Excerpt: r.Excerpt,
-			//nolint:gosec // this content is escaped by Extractor, so it's safe to use it as is
-			Rich:    template.HTML(r.Rich),
-			Content: r.Content,
+			//nolint:gosec // this content is sanitized by Extractor with an allowlist policy, so it's safe to use it as is
+			Rich:        template.HTML(r.Rich),
+			Content:     r.Content,
+			WordCount:   r.WordCount,
+			ReadingTime: r.ReadingTime,
+			Language:    r.Language,
 		})
 	}
 
@@ -280,16 +407,9 @@ func (s *Server) saveRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
-	rule := datastore.Rule{
-		Enabled:       true,
-		ID:            getBid(r.FormValue("id")),
-		Domain:        r.FormValue("domain"),
-		Author:        r.FormValue("author"),
-		Content:       r.FormValue("content"),
-		MatchURLs:     strings.Split(r.FormValue("match_url"), "\n"),
-		Excludes:      strings.Split(r.FormValue("excludes"), "\n"),
-		TestURLs:      strings.Split(r.FormValue("test_urls"), "\n"),
-		UseCloudflare: r.FormValue("use_cloudflare") == "true",
+	rule := ruleFromForm(r)
+	if user, ok := currentUser(r.Context()); ok {
+		rule.User = user.Name
 	}
 
 	// return error in case domain is not set
@@ -308,6 +428,36 @@ func (s *Server) saveRule(w http.ResponseWriter, r *http.Request) {
 	rest.RenderJSON(w, &srule)
 }
 
+// formLines returns non-empty trimmed lines of the form field, nil if there are none
+func formLines(r *http.Request, field string) []string {
+	var res []string
+	for line := range strings.SplitSeq(r.FormValue(field), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// ruleFromForm makes the rule from the submitted rule form
+func ruleFromForm(r *http.Request) datastore.Rule {
+	return datastore.Rule{
+		Enabled:       true,
+		ID:            getBid(r.FormValue("id")),
+		Domain:        r.FormValue("domain"),
+		Author:        r.FormValue("author"),
+		Content:       r.FormValue("content"),
+		MatchURLs:     strings.Split(r.FormValue("match_url"), "\n"),
+		Excludes:      strings.Split(r.FormValue("excludes"), "\n"),
+		TestURLs:      strings.Split(r.FormValue("test_urls"), "\n"),
+		UseCloudflare: r.FormValue("use_cloudflare") == "true",
+		UserAgent:     strings.TrimSpace(r.FormValue("user_agent")),
+		Headers:       formLines(r, "headers"),
+		Cookies:       formLines(r, "cookies"),
+		NextPage:      strings.TrimSpace(r.FormValue("next_page")),
+	}
+}
+
 func (s *Server) toggleRule(w http.ResponseWriter, r *http.Request) {
 	id := getBid(r.PathValue("id"))
 	rule, found := s.Readability.Rules.GetByID(r.Context(), id)
@@ -344,6 +494,82 @@ func (s *Server) authFake(w http.ResponseWriter, _ *http.Request) {
 	rest.RenderJSON(w, JSON{"pong": t.Format("20060102150405")})
 }
 
+// extractErrorCode maps extraction error to response status code
+func extractErrorCode(err error) int {
+	switch {
+	case errors.Is(err, extractor.ErrForbiddenTarget):
+		return http.StatusForbidden
+	case errors.Is(err, extractor.ErrContentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, extractor.ErrUnsupportedContent):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable // canceled on shutdown
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// rulesFilter is the state of rules index filters, sorting and pagination, taken from query parameters
+type rulesFilter struct {
+	Search     string // q
+	Enabled    string // enabled, "yes" or "no"
+	Cloudflare string // cf, "yes" or "no"
+	User       string
+	Health     string
+	Sort       string
+	Page       int
+
+	pageSize int
+}
+
+func parseRulesFilter(r *http.Request) rulesFilter {
+	q := r.URL.Query()
+	res := rulesFilter{Search: strings.TrimSpace(q.Get("q")), Enabled: q.Get("enabled"), Cloudflare: q.Get("cf"),
+		User: q.Get("user"), Health: q.Get("health"), Sort: q.Get("sort"), Page: 1, pageSize: datastore.RulesPageSize}
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 1 {
+		res.Page = page
+	}
+	if size, err := strconv.Atoi(q.Get("size")); err == nil && size > 0 {
+		res.pageSize = min(size, datastore.RulesMaxPageSize)
+	}
+	return res
+}
+
+// query makes datastore query from the filter
+func (f rulesFilter) query() datastore.RulesQuery {
+	yesNo := func(v string) *bool {
+		if v != "yes" && v != "no" {
+			return nil
+		}
+		res := v == "yes"
+		return &res
+	}
+	return datastore.RulesQuery{Search: f.Search, Enabled: yesNo(f.Enabled), Cloudflare: yesNo(f.Cloudflare), User: f.User,
+		Health: f.Health, Sort: f.Sort, Page: f.Page, PageSize: f.pageSize}
+}
+
+// url returns index page url with the same filters and the given page
+func (f rulesFilter) url(page int) string {
+	q := url.Values{}
+	for k, v := range map[string]string{"q": f.Search, "enabled": f.Enabled, "cf": f.Cloudflare, "user": f.User,
+		"health": f.Health, "sort": f.Sort} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if page > 1 {
+		q.Set("page", strconv.Itoa(page))
+	}
+	if f.pageSize != datastore.RulesPageSize {
+		q.Set("size", strconv.Itoa(f.pageSize))
+	}
+	if len(q) == 0 {
+		return "/"
+	}
+	return "/?" + q.Encode()
+}
+
 func getBid(id string) bson.ObjectID {
 	bid, err := bson.ObjectIDFromHex(id)
 	if err != nil {
@@ -352,6 +578,27 @@ func getBid(id string) bson.ObjectID {
 	return bid
 }
 
+// extractOptions returns extraction options from query parameters: debug asks for diagnostics, proxy_images
+// to rewrite images to proxied urls, and archive, inline or zip, for self-contained article
+func extractOptions(r *http.Request) extractor.ExtractOptions {
+	query := r.URL.Query()
+	debug, err := strconv.ParseBool(query.Get("debug"))
+	opts := extractor.ExtractOptions{Debug: err == nil && debug, Archive: query.Get("archive"), Text: query.Get("text")}
+	proxy, err := strconv.ParseBool(query.Get("proxy_images"))
+	opts.ProxyImages = err == nil && proxy
+	if size := query.Get("snippet_size"); size != "" {
+		if opts.SnippetSize, err = strconv.Atoi(size); err != nil {
+			opts.SnippetSize = -1 // rejected by extractor as out of range
+		}
+	}
+	if width := query.Get("text_width"); width != "" {
+		if opts.TextWidth, err = strconv.Atoi(width); err != nil {
+			opts.TextWidth = -1
+		}
+	}
+	return opts
+}
+
 // checkToken validates the token query parameter if the server has a token configured.
 // returns true if auth passed, false if the request was rejected.
 func (s *Server) checkToken(w http.ResponseWriter, r *http.Request) bool {
@@ -404,3 +651,12 @@ func basicAuth(realm string, credentials map[string]string) func(http.Handler) h
 		})
 	}
 }
+
+// batchContext returns request context limited by BatchTimeout
+func (s *Server) batchContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := s.BatchTimeout
+	if timeout <= 0 {
+		timeout = defaultBatchTimeout
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
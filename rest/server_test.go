@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -21,6 +23,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/ukeeper/ukeeper-readability/datastore"
 	"github.com/ukeeper/ukeeper-readability/extractor"
@@ -60,6 +67,46 @@ func TestServer_FileServer(t *testing.T) {
 	require.NoError(t, os.Remove(filepath.Join(dir, "static")))
 }
 
+func TestServer_Metrics(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	b, code := get(t, ts.URL+"/api/content/v1/parser?url=http://bad_url")
+	require.Equal(t, http.StatusBadRequest, code, b)
+
+	b, code = get(t, ts.URL+"/metrics")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, b, `ukeeper_extract_total{outcome="error",retriever="http"}`)
+	assert.Contains(t, b, "ukeeper_extract_duration_seconds_bucket")
+}
+
+func TestServer_TracePropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/content/v1/parser?url=http://bad_url", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	names := map[string]bool{}
+	for _, s := range recorder.Ended() {
+		assert.Equal(t, traceID, s.SpanContext().TraceID().String(), s.Name())
+		names[s.Name()] = true
+	}
+	assert.True(t, names["GET /api/content/v1/parser"], "server span")
+	assert.True(t, names["extract"], "extraction span")
+}
+
 func TestServer_Shutdown(t *testing.T) {
 	srv := Server{}
 	done := make(chan bool)
@@ -139,16 +186,30 @@ func TestServer_Extract(t *testing.T) {
 	response := extractor.Response{}
 	err = json.Unmarshal(b, &response)
 	require.NoError(t, err)
+	assert.Equal(t, "ru", response.Language)
+	assert.Positive(t, response.WordCount)
+	assert.Positive(t, response.ReadingTime)
+	assert.Contains(t, string(b), `"reading_time":`)
 
-	// legacy endpoint, same response is expected
+	// legacy endpoint, same response is expected with structured text
 	legacyBody, code := get(t, ts.URL+"/api/content/v1/parser"+
-		fmt.Sprintf(`?url=%s/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/`, tss.URL))
+		fmt.Sprintf(`?url=%s/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/&text=structured`, tss.URL))
 	require.Equal(t, http.StatusOK, code)
 	legacyResponse := extractor.Response{}
 	err = json.Unmarshal([]byte(legacyBody), &legacyResponse)
 	require.NoError(t, err)
 	assert.Equal(t, response.Content, legacyResponse.Content)
 
+	// legacy endpoint returns flat text by default, stats are the same
+	legacyBody, code = get(t, ts.URL+"/api/content/v1/parser"+
+		fmt.Sprintf(`?url=%s/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/`, tss.URL))
+	require.Equal(t, http.StatusOK, code)
+	legacyResponse = extractor.Response{}
+	require.NoError(t, json.Unmarshal([]byte(legacyBody), &legacyResponse))
+	assert.NotContains(t, legacyResponse.Content, "\n")
+	assert.Equal(t, response.WordCount, legacyResponse.WordCount)
+	assert.Equal(t, response.CharCount, legacyResponse.CharCount)
+
 	// wrong body
 	resp, err = post(t, ts.URL+"/api/extract", "wrong_body")
 	require.NoError(t, err)
@@ -174,6 +235,141 @@ func TestServer_Extract(t *testing.T) {
 	require.NoError(t, resp.Body.Close())
 }
 
+func TestServer_ExtractDebug(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	tss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>debug</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, ", 10) + `</p></div></body></html>`))
+	}))
+	defer tss.Close()
+
+	b, code := get(t, ts.URL+"/api/content/v1/parser?url="+tss.URL+"/page")
+	require.Equal(t, http.StatusOK, code, b)
+	assert.NotContains(t, b, `"diagnostics"`)
+
+	b, code = get(t, ts.URL+"/api/content/v1/parser?debug=true&url="+tss.URL+"/page")
+	require.Equal(t, http.StatusOK, code, b)
+	res := extractor.Response{}
+	require.NoError(t, json.Unmarshal([]byte(b), &res))
+	require.NotNil(t, res.Diagnostics)
+	assert.Equal(t, "general", res.Diagnostics.Parser)
+	assert.Equal(t, "http", res.Diagnostics.Retriever)
+	assert.False(t, res.Diagnostics.Rule.Matched)
+	assert.NotEmpty(t, res.Diagnostics.Stages)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(ts.URL+"/api/extract?debug=1", "application/json", strings.NewReader(`{"url": "`+tss.URL+`/page"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	res = extractor.Response{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NotNil(t, res.Diagnostics)
+	assert.Equal(t, "header", res.Diagnostics.Charset.Source)
+	assert.Equal(t, "utf-8", res.Diagnostics.Charset.Charset)
+}
+
+func TestServer_ExtractArchive(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	tss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pic.gif" {
+			_, _ = w.Write([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>archive</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, ", 10) + `<img src="/pic.gif"></p></div></body></html>`))
+	}))
+	defer tss.Close()
+
+	b, code := get(t, ts.URL+"/api/content/v1/parser?archive=inline&url="+tss.URL+"/page")
+	require.Equal(t, http.StatusOK, code, b)
+	res := extractor.Response{}
+	require.NoError(t, json.Unmarshal([]byte(b), &res))
+	require.NotNil(t, res.Archive)
+	assert.Equal(t, 1, res.Archive.Images)
+	assert.NotEmpty(t, res.Archive.Hash)
+	assert.Contains(t, res.Rich, `src="data:image/gif;base64,`)
+
+	b, code = get(t, ts.URL+"/api/content/v1/parser?archive=tar&url="+tss.URL+"/page")
+	assert.Equal(t, http.StatusBadRequest, code, b)
+}
+
+func TestServer_ExtractSnippetSize(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	tss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>snippet</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, with commas. ", 10) + `</p></div></body></html>`))
+	}))
+	defer tss.Close()
+
+	b, code := get(t, ts.URL+"/api/content/v1/parser?snippet_size=60&url="+tss.URL+"/page")
+	require.Equal(t, http.StatusOK, code, b)
+	res := extractor.Response{}
+	require.NoError(t, json.Unmarshal([]byte(b), &res))
+	assert.Equal(t, "Some text long enough for the parser, with commas.", res.Excerpt)
+
+	b, code = get(t, ts.URL+"/api/content/v1/parser?snippet_size=0&url="+tss.URL+"/page")
+	require.Equal(t, http.StatusOK, code, b)
+	require.NoError(t, json.Unmarshal([]byte(b), &res))
+	assert.Greater(t, len(res.Excerpt), 60, "default size")
+
+	b, code = get(t, ts.URL+"/api/content/v1/parser?snippet_size=abc&url="+tss.URL+"/page")
+	assert.Equal(t, http.StatusBadRequest, code, b)
+	b, code = get(t, ts.URL+"/api/content/v1/parser?snippet_size=100000&url="+tss.URL+"/page")
+	assert.Equal(t, http.StatusBadRequest, code, b)
+}
+
+func TestServer_ExtractTextFormat(t *testing.T) {
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	tss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>text</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, with commas. ", 5) + `</p><p>` +
+			strings.Repeat("The second paragraph, with commas too. ", 5) + `</p></div></body></html>`))
+	}))
+	defer tss.Close()
+
+	for _, tt := range []struct {
+		query string
+		check func(t *testing.T, content string)
+	}{
+		{"", func(t *testing.T, content string) { assert.NotContains(t, content, "\n") }},
+		{"&text=flat", func(t *testing.T, content string) { assert.NotContains(t, content, "\n") }},
+		{"&text=structured", func(t *testing.T, content string) { assert.Contains(t, content, "commas.\n\nThe second paragraph") }},
+		{"&text_width=40", func(t *testing.T, content string) {
+			for line := range strings.SplitSeq(content, "\n") {
+				assert.LessOrEqual(t, len(line), 40)
+			}
+		}},
+	} {
+		b, code := get(t, ts.URL+"/api/content/v1/parser?url="+tss.URL+"/page"+tt.query)
+		require.Equal(t, http.StatusOK, code, b)
+		res := extractor.Response{}
+		require.NoError(t, json.Unmarshal([]byte(b), &res))
+		tt.check(t, res.Content)
+	}
+
+	resp, err := post(t, ts.URL+"/api/extract", `{"url": "`+tss.URL+`/page"}`)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	res := extractor.Response{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Contains(t, res.Content, "commas.\n\nThe second paragraph", "structured by default on extract endpoint")
+
+	for _, query := range []string{"&text=html", "&text_width=5", "&text_width=abc", "&text=flat&text_width=40"} {
+		b, code := get(t, ts.URL+"/api/content/v1/parser?url="+tss.URL+"/page"+query)
+		assert.Equal(t, http.StatusBadRequest, code, query+" "+b)
+	}
+}
+
 func TestServer_LegacyExtract(t *testing.T) {
 	ts, srv := startupT(t)
 	defer ts.Close()
@@ -192,6 +388,11 @@ func TestServer_LegacyExtract(t *testing.T) {
 			assert.NoError(t, err)
 			return
 		}
+		if r.URL.Path == "/archive.zip" {
+			w.Header().Set("Content-Type", "application/zip")
+			_, _ = w.Write([]byte("PK\x03\x04"))
+			return
+		}
 	}))
 	defer tss.Close()
 
@@ -216,6 +417,23 @@ func TestServer_LegacyExtract(t *testing.T) {
 	b, code = get(t, ts.URL+"/api/content/v1/parser?url=http://bad_url")
 	assert.Equal(t, http.StatusBadRequest, code, b)
 
+	// private address refused by outbound policy
+	srv.Readability.Policy = &extractor.OutboundPolicy{}
+	b, code = get(t, ts.URL+"/api/content/v1/parser?url=http://169.254.169.254/latest/meta-data")
+	assert.Equal(t, http.StatusForbidden, code, b)
+	srv.Readability.Policy = nil
+
+	// unsupported content type
+	b, code = get(t, ts.URL+"/api/content/v1/parser?url="+tss.URL+"/archive.zip")
+	assert.Equal(t, http.StatusUnsupportedMediaType, code, b)
+
+	// page over the size limit
+	srv.Readability.Retriever = &extractor.HTTPRetriever{MaxBodySize: 1024}
+	b, code = get(t, ts.URL+"/api/content/v1/parser"+
+		fmt.Sprintf(`?url=%s/2015/11/26/vsiem-mirom-dlia-obshchiei-polzy/`, tss.URL))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code, b)
+	srv.Readability.Retriever = nil
+
 	// token
 	srv.Token = "secret"
 	// no token
@@ -243,6 +461,45 @@ func TestServer_LegacyExtract(t *testing.T) {
 	assert.NotEmpty(t, b)
 }
 
+func TestServer_ExtractToken(t *testing.T) {
+	ts, srv := startupT(t)
+	defer ts.Close()
+	tss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><title>token</title></head><body><div><p>` +
+			strings.Repeat("Some text long enough for the parser, ", 10) + `</p></div></body></html>`))
+	}))
+	defer tss.Close()
+	srv.Token = "secret"
+
+	post := func(path, token, body string) (string, int) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data), resp.StatusCode
+	}
+
+	b, code := post("/api/extract", "", `{"url": "`+tss.URL+`/page"}`)
+	assert.Equal(t, http.StatusUnauthorized, code, b)
+	assert.Contains(t, b, "no token passed")
+	b, code = post("/api/extract", "wrong", `{"url": "`+tss.URL+`/page"}`)
+	assert.Equal(t, http.StatusUnauthorized, code, b)
+	b, code = post("/api/epub", "", `{"urls": ["`+tss.URL+`/page"]}`)
+	assert.Equal(t, http.StatusUnauthorized, code, b)
+
+	b, code = post("/api/extract", "secret", `{"url": "`+tss.URL+`/page"}`)
+	assert.Equal(t, http.StatusOK, code, b)
+	b, code = post("/api/extract?token=secret", "", `{"url": "`+tss.URL+`/page"}`)
+	assert.Equal(t, http.StatusOK, code, b)
+}
+
 func TestServer_RuleHappyFlow(t *testing.T) {
 	ts, _ := startupT(t)
 	defer ts.Close()
@@ -365,6 +622,97 @@ func TestServer_HandleIndex(t *testing.T) {
 	assert.Contains(t, string(body), "Правила")
 }
 
+func TestServer_HandleIndexFilters(t *testing.T) {
+	ts, srv := startupT(t)
+	defer ts.Close()
+	for _, domain := range []string{"c.example.com", "a.example.com", "b.example.com", "other.org"} {
+		r, err := postFormUrlencoded(t, ts.URL+"/api/rule", "domain="+domain+"&content=article&enabled=true")
+		require.NoError(t, err)
+		require.NoError(t, r.Body.Close())
+	}
+	rulesMock := srv.Readability.Rules.(*mocks.RulesMock)
+
+	getIndex := func(query string) string {
+		resp, err := http.Get(ts.URL + "/" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return string(body)
+	}
+
+	t.Run("query passed to store", func(t *testing.T) {
+		getIndex("?q=+example+&enabled=no&cf=yes&user=admin&health=failing&sort=-created&page=3&size=20")
+		calls := rulesMock.ListCalls()
+		q := calls[len(calls)-1].Q
+		assert.Equal(t, "example", q.Search)
+		require.NotNil(t, q.Enabled)
+		assert.False(t, *q.Enabled)
+		require.NotNil(t, q.Cloudflare)
+		assert.True(t, *q.Cloudflare)
+		assert.Equal(t, "admin", q.User)
+		assert.Equal(t, datastore.RuleHealthFailing, q.Health)
+		assert.Equal(t, "-created", q.Sort)
+		assert.Equal(t, 3, q.Page)
+		assert.Equal(t, 20, q.PageSize)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		getIndex("?enabled=maybe&page=-1&size=100000")
+		calls := rulesMock.ListCalls()
+		q := calls[len(calls)-1].Q
+		assert.Nil(t, q.Enabled)
+		assert.Nil(t, q.Cloudflare)
+		assert.Equal(t, 1, q.Page)
+		assert.Equal(t, datastore.RulesMaxPageSize, q.PageSize)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		body := getIndex("?q=example")
+		assert.Contains(t, body, "a.example.com")
+		assert.NotContains(t, body, "other.org")
+		assert.Contains(t, body, `value="example"`)
+		assert.Contains(t, body, "1 из 1, всего 3")
+
+		body = getIndex("?q=nothing")
+		assert.Contains(t, body, "Ничего не найдено")
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		body := getIndex("?q=example&size=1")
+		assert.Contains(t, body, "a.example.com")
+		assert.NotContains(t, body, "b.example.com")
+		assert.Contains(t, body, "1 из 3, всего 3")
+		assert.Contains(t, body, `href="/?page=2&amp;q=example&amp;size=1"`)
+		assert.NotContains(t, body, "←")
+
+		body = getIndex("?q=example&size=1&page=2")
+		assert.Contains(t, body, "b.example.com")
+		assert.Contains(t, body, `href="/?q=example&amp;size=1"`)
+		assert.Contains(t, body, `href="/?page=3&amp;q=example&amp;size=1"`)
+
+		body = getIndex("?q=example&size=1&page=3")
+		assert.Contains(t, body, "c.example.com")
+		assert.NotContains(t, body, "→")
+	})
+
+	t.Run("health", func(t *testing.T) {
+		rules, _, err := rulesMock.List(context.Background(), datastore.RulesQuery{Search: "other.org"})
+		require.NoError(t, err)
+		require.Len(t, rules, 1)
+		err = rulesMock.SetHealth(context.Background(), rules[0].ID,
+			datastore.RuleHealth{OK: false, Error: "nothing extracted", CheckedAt: time.Now()})
+		require.NoError(t, err)
+
+		body := getIndex("?q=other.org")
+		assert.Contains(t, body, "rules__health_failing")
+		assert.Contains(t, body, "nothing extracted")
+		body = getIndex("?q=a.example.com")
+		assert.Contains(t, body, "не проверялось")
+	})
+}
+
 func TestServer_HandleAdd(t *testing.T) {
 	ts, _ := startupT(t)
 	defer ts.Close()
@@ -481,7 +829,8 @@ func TestServer_SaveRule(t *testing.T) {
 	randomDomainName := randStringBytesRmndr(42) + ".com"
 
 	// test saving a new rule
-	resp, err := postFormUrlencoded(t, ts.URL+"/api/rule", fmt.Sprintf(`domain=%s&content=test+content&author=test+author`, randomDomainName))
+	resp, err := postFormUrlencoded(t, ts.URL+"/api/rule", fmt.Sprintf(`domain=%s&content=test+content&author=test+author`+
+		`&headers=&cookies=%%0A+%%0Aconsent%%3Dyes%%0A`, randomDomainName))
 	require.NoError(t, err)
 	defer resp.Body.Close()
 
@@ -492,8 +841,11 @@ func TestServer_SaveRule(t *testing.T) {
 	var rule datastore.Rule
 	err = json.NewDecoder(resp.Body).Decode(&rule)
 	require.NoError(t, err)
+	assert.Nil(t, rule.Headers, "empty textarea")
+	assert.Equal(t, []string{"consent=yes"}, rule.Cookies, "empty lines dropped")
 
-	updatedRule := fmt.Sprintf(`id=%s&domain=%s&content=updated+content&author=updated+author`, rule.ID.Hex(), randomDomainName)
+	updatedRule := fmt.Sprintf(`id=%s&domain=%s&content=updated+content&author=updated+author&next_page=a.next-page`,
+		rule.ID.Hex(), randomDomainName)
 	resp, err = postFormUrlencoded(t, ts.URL+"/api/rule", updatedRule)
 
 	require.NoError(t, err)
@@ -513,6 +865,7 @@ func TestServer_SaveRule(t *testing.T) {
 	assert.NotContains(t, b, rule.Content)
 	assert.Contains(t, b, "updated content")
 	assert.Contains(t, b, "updated author")
+	assert.Contains(t, b, `name="next_page" class="form__input rule__next-page" value="a.next-page"`)
 
 	// try to save a rule with the new domain, supposed to fail as ID should be different and can't be altered
 	updatedRule = fmt.Sprintf(`id=%s&domain=another_domain&content=updated+content&author=updated+author`, rule.ID.Hex())
@@ -564,6 +917,7 @@ func TestServer_Preview(t *testing.T) {
 	require.Equal(t, http.StatusOK, resp.StatusCode, string(b))
 	require.NoError(t, resp.Body.Close())
 	assert.Contains(t, string(b), "<summary>Всем миром для общей пользы • Umputun тут был</summary>")
+	assert.Regexp(t, `\d+ слов, \d+ мин. чтения, язык: ru`, string(b))
 
 	// happy path with custom rule
 	resp, err = postFormUrlencoded(t, ts.URL+"/api/preview",
@@ -638,6 +992,10 @@ func startupT(t *testing.T) (*httptest.Server, *Server) {
 	templates := template.Must(template.ParseGlob(filepath.Join(webDir, "components", "*.gohtml")))
 	srv.indexPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "index.gohtml")))
 	srv.rulePage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "rule.gohtml")))
+	srv.keysPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "keys.gohtml")))
+	srv.loginPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "login.gohtml")))
+	srv.usersPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "users.gohtml")))
+	srv.builderPage = template.Must(template.Must(templates.Clone()).ParseFiles(filepath.Join(webDir, "builder.gohtml")))
 
 	return httptest.NewServer(srv.routes(webDir)), &srv
 }
@@ -717,6 +1075,48 @@ func newRulesStoreMock() *mocks.RulesMock {
 			copy(result, rules)
 			return result
 		},
+		ListFunc: func(_ context.Context, q datastore.RulesQuery) ([]datastore.Rule, int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			// only search, enabled filter and domain order, the rest is covered by datastore tests
+			result := []datastore.Rule{}
+			for _, r := range rules {
+				if q.Search != "" && !strings.Contains(r.Domain, q.Search) && !strings.Contains(r.Content, q.Search) {
+					continue
+				}
+				if q.Enabled != nil && r.Enabled != *q.Enabled {
+					continue
+				}
+				result = append(result, r)
+			}
+			slices.SortFunc(result, func(a, b datastore.Rule) int { return cmp.Compare(a.Domain, b.Domain) })
+			size, page := cmp.Or(q.PageSize, datastore.RulesPageSize), max(q.Page, 1)
+			total := len(result)
+			return result[min((page-1)*size, total):min(page*size, total)], int64(total), nil
+		},
+		UsersFunc: func(_ context.Context) []string {
+			mu.Lock()
+			defer mu.Unlock()
+			var result []string
+			for _, r := range rules {
+				if r.User != "" && !slices.Contains(result, r.User) {
+					result = append(result, r.User)
+				}
+			}
+			slices.Sort(result)
+			return result
+		},
+		SetHealthFunc: func(_ context.Context, id bson.ObjectID, health datastore.RuleHealth) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for i, r := range rules {
+				if r.ID == id {
+					rules[i].Health = &health
+					return nil
+				}
+			}
+			return fmt.Errorf("rule not found")
+		},
 	}
 }
 
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/go-pkgz/rest"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	cancelGracePeriod      = 2 * time.Second // time for canceled requests to respond before connections are closed
+)
+
+// drain stops accepting new requests and waits for in-flight ones up to ShutdownTimeout.
+// Requests still running after the timeout are canceled with cancelWork and the server is closed.
+func (s *Server) drain(httpServer *http.Server, cancelWork context.CancelFunc) {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	s.draining.Store(true)
+	log.Printf("[INFO] shutdown, draining %d in-flight requests, timeout %s", s.inFlight.Load(), timeout)
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), timeout)
+	defer drainCancel()
+	if err := httpServer.Shutdown(drainCtx); err == nil {
+		return
+	}
+
+	log.Printf("[WARN] drain timeout, canceling %d in-flight requests", s.inFlight.Load())
+	cancelWork()
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), cancelGracePeriod)
+	defer graceCancel()
+	if err := httpServer.Shutdown(graceCtx); err != nil {
+		log.Printf("[WARN] force close connections, %v", err)
+		_ = httpServer.Close()
+	}
+}
+
+// trackInFlight counts requests being served and rejects new ones with 503 while draining,
+// except liveness check, as the process is still alive
+func (s *Server) trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() && r.URL.Path != "/health/live" {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "5")
+			rest.SendErrorJSON(w, r, log.Default(), http.StatusServiceUnavailable, nil, "server is shutting down")
+			return
+		}
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+func TestServer_ShutdownDrain(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`<html><head><title>slow</title></head><body><p>slow page content</p></body></html>`))
+	}))
+	defer page.Close()
+
+	t.Run("in-flight request completes", func(t *testing.T) {
+		srv := &Server{Readability: extractor.UReadability{TimeOut: 30 * time.Second, SnippetSize: 300}, ShutdownTimeout: 5 * time.Second}
+		addr, cancel, done := runServer(t, srv)
+
+		respCh := make(chan int, 1)
+		go func() { respCh <- getStatus(t, addr+"/api/content/v1/parser?url="+url.QueryEscape(page.URL+"/slow")) }()
+		require.Eventually(t, func() bool { return srv.inFlight.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+		st := time.Now()
+		cancel()
+		assert.Equal(t, http.StatusOK, <-respCh)
+		<-done
+		assert.Less(t, time.Since(st), 2*time.Second)
+	})
+
+	t.Run("request canceled after drain timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer slow.Close()
+		srv := &Server{Readability: extractor.UReadability{TimeOut: 30 * time.Second, SnippetSize: 300},
+			ShutdownTimeout: 100 * time.Millisecond}
+		addr, cancel, done := runServer(t, srv)
+
+		respCh := make(chan int, 1)
+		go func() { respCh <- getStatus(t, addr+"/api/content/v1/parser?url="+url.QueryEscape(slow.URL+"/hang")) }()
+		require.Eventually(t, func() bool { return srv.inFlight.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+		st := time.Now()
+		cancel()
+		assert.Equal(t, http.StatusServiceUnavailable, <-respCh)
+		<-done
+		assert.Less(t, time.Since(st), time.Second)
+	})
+}
+
+func TestServer_TrackInFlight(t *testing.T) {
+	srv := &Server{}
+	h := srv.trackInFlight(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		assert.Equal(t, int64(1), srv.inFlight.Load())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/content/v1/parser", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Zero(t, srv.inFlight.Load())
+
+	srv.draining.Store(true)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/content/v1/parser", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "close", rr.Header().Get("Connection"))
+	assert.Contains(t, rr.Body.String(), "server is shutting down")
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health/live", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code, "liveness is served while draining")
+}
+
+// runServer starts srv on a free port and returns its url, function to stop it and channel closed when Run returns
+func runServer(t *testing.T, srv *Server) (addr string, cancel context.CancelFunc, done chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done = make(chan struct{})
+	go func() {
+		srv.Run(ctx, "127.0.0.1", port, "../web")
+		close(done)
+	}()
+	addr = fmt.Sprintf("http://127.0.0.1:%d", port)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(addr + "/health/live")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return addr, cancel, done
+}
+
+func getStatus(t *testing.T, u string) int {
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Logf("request failed, %v", err)
+		return 0
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/ukeeper/ukeeper-readability/extractor"
+)
+
+// maxSuggestURLs limits number of sample pages fetched for rule suggestion
+const maxSuggestURLs = 10
+
+// suggestRule proposes content selector and excludes from test urls of the submitted rule form and returns the form
+// pre-filled with them, for review before saving. Results of each sample are shown out of band, under the form.
+func (s *Server) suggestRule(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	rule := ruleFromForm(r)
+
+	data := struct {
+		*extractor.Suggestion
+		Error string
+	}{}
+	var err error
+	if n := countURLs(rule.TestURLs); n > maxSuggestURLs {
+		err = fmt.Errorf("too many sample urls %d, max %d", n, maxSuggestURLs)
+	} else {
+		ctx, cancel := s.batchContext(r)
+		data.Suggestion, err = s.Readability.SuggestRule(ctx, rule.TestURLs, &rule)
+		cancel()
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to suggest rule for %s, %v", rule.Domain, err)
+		data.Error = err.Error()
+	} else {
+		rule.Content = data.Suggestion.Content
+		rule.Excludes = data.Suggestion.Excludes
+	}
+
+	if err = s.rulePage.ExecuteTemplate(w, "rule-form", rule); err != nil {
+		log.Printf("[WARN] failed to render rule form, %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = s.rulePage.ExecuteTemplate(w, "rule-suggestion", data); err != nil {
+		log.Printf("[WARN] failed to render rule suggestion, %v", err)
+	}
+}
+
+// countURLs returns number of non-empty urls
+func countURLs(urls []string) (res int) {
+	for _, u := range urls {
+		if strings.TrimSpace(u) != "" {
+			res++
+		}
+	}
+	return res
+}
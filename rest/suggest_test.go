@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SuggestRule(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "suggest-agent", r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprintf(w, `<html><body><div class="menu"><a href="/">Home</a></div><div class="story">
+			<p>Story %[1]s begins here, and this paragraph is long enough, with commas, to get a good score.</p>
+			<p>Story %[1]s continues with the second paragraph, again with commas, and more words in it.</p>
+			<div class="social"><a href="/1">one</a> <a href="/2">two</a> <a href="/3">three</a></div></div></body></html>`,
+			r.URL.Path)
+	}))
+	defer site.Close()
+
+	ts, _ := startupT(t)
+	defer ts.Close()
+
+	post := func(form url.Values) string {
+		resp, err := postFormUrlencoded(t, ts.URL+"/api/suggest-rule", form.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("form pre-filled", func(t *testing.T) {
+		body := post(url.Values{"domain": {"example.com"}, "content": {"old"}, "user_agent": {"suggest-agent"},
+			"test_urls": {site.URL + "/a\n" + site.URL + "/b\n" + "http://127.0.0.1:1/c"}})
+		assert.Contains(t, body, `<div id="rule" class="rule form page__rule">`)
+		assert.Contains(t, body, `value="example.com"`)
+		assert.Contains(t, body, `required>div.story</textarea>`)
+		assert.Contains(t, body, ".social\n")
+		assert.Contains(t, body, `<div id="rule__suggestion" class="suggestion" hx-swap-oob="true">`)
+		assert.Contains(t, body, "на 2 из 3 страниц")
+		assert.Contains(t, body, site.URL+"/b")
+		assert.Contains(t, body, `<li class="suggestion__sample suggestion__sample_unmatched">`, "failed sample")
+		assert.Contains(t, body, "connection refused")
+	})
+
+	t.Run("no test urls", func(t *testing.T) {
+		body := post(url.Values{"domain": {"example.com"}, "content": {"old"}})
+		assert.Contains(t, body, `required>old</textarea>`, "form is kept")
+		assert.Contains(t, body, "Не удалось предложить правило: no sample urls")
+	})
+
+	t.Run("too many test urls", func(t *testing.T) {
+		body := post(url.Values{"domain": {"example.com"}, "content": {"old"}, "user_agent": {"suggest-agent"},
+			"test_urls": {strings.Repeat(site.URL+"/a\n", maxSuggestURLs) + site.URL + "/b"}})
+		assert.Contains(t, body, `required>old</textarea>`, "form is kept")
+		assert.Contains(t, body, fmt.Sprintf("too many sample urls %d, max %d", maxSuggestURLs+1, maxSuggestURLs))
+		assert.NotContains(t, body, `class="suggestion__samples"`, "samples not fetched")
+	})
+
+	t.Run("requires auth", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/api/suggest-rule", "application/x-www-form-urlencoded",
+			strings.NewReader("test_urls="+url.QueryEscape(site.URL)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
@@ -0,0 +1,56 @@
+// Package tracing sets up OpenTelemetry tracing with OTLP exporter and trace context propagation
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+// Config defines OTLP exporter parameters
+type Config struct {
+	Endpoint    string  // OTLP/HTTP collector url, like http://localhost:4318; empty disables tracing
+	ServiceName string  // service.name resource attribute
+	Version     string  // service.version resource attribute
+	SampleRatio float64 // fraction of new traces sampled, incoming sampled traces are always continued
+}
+
+// Setup installs W3C trace context and baggage propagation and, if endpoint is set, global tracer provider
+// exporting spans over OTLP/HTTP. Without endpoint the default no-op provider is kept, so spans cost nothing.
+// Returned shutdown flushes pending spans and should be called on exit.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// exporter only logs malformed endpoint, so it is checked here to fail on start
+	if u, parseErr := url.Parse(cfg.Endpoint); parseErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q, http(s)://host:port expected", cfg.Endpoint)
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName), semconv.ServiceVersion(cfg.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("create otel resource: %w", err)
+	}
+
+	ratio := min(max(cfg.SampleRatio, 0), 1)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("no endpoint", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{})
+		require.NoError(t, err)
+		require.NoError(t, shutdown(context.Background()))
+
+		carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+		_, span := otel.Tracer("test").Start(ctx, "noop")
+		defer span.End()
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), "trace context propagated")
+		assert.False(t, span.IsRecording(), "no-op provider")
+	})
+
+	t.Run("otlp endpoint", func(t *testing.T) {
+		var exported atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+				exported.Add(1)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer ts.Close()
+
+		shutdown, err := Setup(context.Background(), Config{Endpoint: ts.URL, ServiceName: "test", Version: "v1", SampleRatio: 1})
+		require.NoError(t, err)
+		_, span := otel.Tracer("test").Start(context.Background(), "exported")
+		assert.True(t, span.IsRecording())
+		span.End()
+		require.NoError(t, shutdown(context.Background()), "flushes pending spans")
+		assert.Equal(t, int32(1), exported.Load())
+	})
+
+	t.Run("zero ratio samples only continued traces", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{Endpoint: "http://127.0.0.1:4318"})
+		require.NoError(t, err)
+		defer func() { _ = shutdown(context.Background()) }()
+
+		_, span := otel.Tracer("test").Start(context.Background(), "new")
+		assert.False(t, span.IsRecording(), "new trace not sampled")
+		span.End()
+
+		carrier := propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+		_, span = otel.Tracer("test").Start(ctx, "continued")
+		assert.True(t, span.IsRecording(), "sampled parent continued")
+		span.End()
+	})
+
+	t.Run("bad endpoint", func(t *testing.T) {
+		_, err := Setup(context.Background(), Config{Endpoint: "://bad"})
+		require.Error(t, err)
+	})
+}